@@ -0,0 +1,143 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/grafana/k6deps"
+)
+
+// maxConcurrentPlatforms limits the number of platforms built and downloaded concurrently by GetBinaries
+const maxConcurrentPlatforms = 4
+
+// GetBinaries returns the custom k6 binaries that satisfy the given dependencies for each of the
+// given platforms (in the os/arch form), keyed by platform.
+//
+// The binaries are obtained concurrently, as described in [Provider.GetBinary]. If obtaining any of
+// the binaries fails, the errors are aggregated and returned together with the binaries that were
+// successfully obtained.
+func (p *Provider) GetBinaries(
+	ctx context.Context,
+	deps k6deps.Dependencies,
+	platforms []string,
+) (map[string]K6Binary, error) {
+	if p.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	for _, platform := range platforms {
+		if !slices.Contains(supportedPlatforms, platform) {
+			return nil, NewWrappedError(
+				ErrInvalidParameters,
+				fmt.Errorf("unsupported platform %q. Valid values are %s", platform, strings.Join(supportedPlatforms, ", ")),
+			)
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		errs     []error
+		binaries = map[string]K6Binary{}
+		limit    = make(chan struct{}, maxConcurrentPlatforms)
+	)
+
+	// a platform requested more than once is obtained only once
+	unique := slices.Clone(platforms)
+	slices.Sort(unique)
+	unique = slices.Compact(unique)
+
+	for _, platform := range unique {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			binary, err := p.forPlatform(platform).GetBinary(ctx, deps)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", platform, err))
+				return
+			}
+			binaries[platform] = binary
+		}()
+	}
+
+	wg.Wait()
+
+	return binaries, errors.Join(errs...)
+}
+
+// forPlatform returns a provider that shares the configuration of this provider, but
+// obtains binaries for the given platform
+func (p *Provider) forPlatform(platform string) *Provider {
+	if platform == p.platform {
+		return p
+	}
+
+	binary := binaryName(strings.TrimSuffix(p.binary, ".exe"), platform)
+	cached := cachedName(binary, p.compression)
+	pruner := newPruner(platformDir(p.binDir, platform), cached, p.pruner.hwm, p.pruner.pruneInterval, p.clock, p.events)
+	config := p.config
+	config.Platform = platform
+
+	return &Provider{
+		providerSettings: p.providerSettings,
+		platform:         platform,
+		binary:           binary,
+		pruner:           pruner,
+		config:           config,
+	}
+}
+
+// maxConcurrentWarm limits the number of binaries built and downloaded concurrently by Warm
+const maxConcurrentWarm = 4
+
+// Warm obtains the binaries for each of the given dependencies, so later calls to [Provider.GetBinary]
+// with the same dependencies find them in the cache.
+//
+// The binaries are obtained concurrently. If obtaining any of them fails, the others are still obtained
+// and the errors are aggregated, identifying the failed dependencies by their index in specs.
+func (p *Provider) Warm(ctx context.Context, specs []k6deps.Dependencies) error {
+	if p.closed.Load() {
+		return ErrClosed
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		errs  []error
+		limit = make(chan struct{}, maxConcurrentWarm)
+	)
+
+	for idx, deps := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			_, err := p.GetBinary(ctx, deps)
+			if err == nil {
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			errs = append(errs, fmt.Errorf("spec %d (%s): %w", idx, deps.String(), err))
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+)
+
+// platformBuildService returns a different artifact for each platform
+type platformBuildService struct {
+	url      string
+	checksum string
+}
+
+func (b *platformBuildService) Build(
+	_ context.Context,
+	platform string,
+	_ string,
+	_ []k6build.Dependency,
+) (k6build.Artifact, error) {
+	return k6build.Artifact{
+		ID:       strings.ReplaceAll(platform, "/", "-"),
+		URL:      b.url + "?platform=" + platform,
+		Platform: platform,
+		Checksum: b.checksum,
+	}, nil
+}
+
+func TestGetBinaries(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	t.Run("multiple platforms", func(t *testing.T) {
+		t.Parallel()
+
+		provider, downloadSrv := newTestProvider(t, Config{Platform: "linux/amd64"}, content, sha256sum(content))
+		provider.buildSrv = &platformBuildService{url: downloadSrv.URL, checksum: sha256sum(content)}
+
+		platforms := []string{"linux/amd64", "windows/amd64", "darwin/arm64", "linux/amd64"}
+		binaries, err := provider.GetBinaries(context.TODO(), k6deps.Dependencies{}, platforms)
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if len(binaries) != 3 {
+			t.Fatalf("expected 3 binaries got %d", len(binaries))
+		}
+
+		for platform, binary := range binaries {
+			if filepath.Base(binary.Path) != binaryName(k6Binary, platform) {
+				t.Fatalf("unexpected binary %s for %s", binary.Path, platform)
+			}
+		}
+	})
+
+	t.Run("unsupported platform", func(t *testing.T) {
+		t.Parallel()
+
+		provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+		_, err := provider.GetBinaries(context.TODO(), k6deps.Dependencies{}, []string{"linux/amd64", "plan9/386"})
+		if !errors.Is(err, ErrInvalidParameters) {
+			t.Fatalf("expected %v got %v", ErrInvalidParameters, err)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		t.Parallel()
+
+		provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+		provider.buildSrv = &platformBuildService{url: downloadSrv.URL, checksum: sha256sum(content)}
+		downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("platform") == "darwin/amd64" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(content)
+		})
+
+		binaries, err := provider.GetBinaries(
+			context.TODO(),
+			k6deps.Dependencies{},
+			[]string{"linux/amd64", "darwin/amd64"},
+		)
+		if !errors.Is(err, ErrDownload) {
+			t.Fatalf("expected %v got %v", ErrDownload, err)
+		}
+
+		if _, found := binaries["linux/amd64"]; !found || len(binaries) != 1 {
+			t.Fatalf("expected only linux/amd64 binary got %v", binaries)
+		}
+	})
+}
+
+// depsBuildService returns a different artifact for each set of dependencies
+type depsBuildService struct {
+	url      string
+	checksum string
+}
+
+func (b *depsBuildService) Build(
+	_ context.Context,
+	platform string,
+	_ string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	names := []string{"k6"}
+	for _, dep := range deps {
+		names = append(names, strings.ReplaceAll(dep.Name, "/", "-"))
+	}
+	id := strings.Join(names, "_")
+
+	return k6build.Artifact{
+		ID:       id,
+		URL:      b.url + "?id=" + id,
+		Platform: platform,
+		Checksum: b.checksum,
+	}, nil
+}
+
+func TestWarm(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+	provider.buildSrv = &depsBuildService{url: downloadSrv.URL, checksum: sha256sum(content)}
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("id"), "k6-x-missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	})
+
+	specs := make([]k6deps.Dependencies, 3)
+	for idx, dep := range []string{"k6/x/sql", "k6/x/missing", "k6/x/kafka"} {
+		specs[idx] = k6deps.Dependencies{}
+		if err := specs[idx].UnmarshalText([]byte(dep + "=*")); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+	}
+
+	err := provider.Warm(context.TODO(), specs)
+	if !errors.Is(err, ErrDownload) || !strings.Contains(err.Error(), "spec 1") {
+		t.Fatalf("expected spec 1 to fail with %v got %v", ErrDownload, err)
+	}
+
+	for _, idx := range []int{0, 2} {
+		binary, err := provider.GetBinary(context.TODO(), specs[idx])
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+		if !binary.Stats.CacheHit {
+			t.Fatalf("expected spec %d to be cached", idx)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache stores the content of binaries by their artifact ID.
+//
+// A Cache is used by [Provider.GetBinaryStream] for returning binaries without downloading them
+// again. [Provider.GetBinary] always uses the cache in the BinDir directory, because binaries must be
+// in the filesystem for executing them.
+//
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the content of the binary with the given ID.
+	// If the binary is not in the cache, returns an [ErrNotCached] error.
+	Get(ctx context.Context, id string) (io.ReadCloser, error)
+	// Put stores the content of the binary with the given ID.
+	// If reading the content fails, the binary must not be stored.
+	Put(ctx context.Context, id string, content io.Reader) error
+}
+
+// validCacheID checks the ID can be safely used as a file name
+func validCacheID(id string) error {
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		return fmt.Errorf("invalid artifact id %q", id)
+	}
+	return nil
+}
+
+// memoryCache is a Cache that keeps the binaries in memory
+type memoryCache struct {
+	mutex    sync.RWMutex
+	binaries map[string][]byte
+}
+
+// NewMemoryCache returns a [Cache] that keeps the binaries in memory.
+// It is intended for tests and ephemeral uses, such as serverless functions,
+// where the filesystem is not available or is read-only.
+func NewMemoryCache() Cache {
+	return &memoryCache{binaries: map[string][]byte{}}
+}
+
+func (c *memoryCache) Get(_ context.Context, id string) (io.ReadCloser, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	content, found := c.binaries[id]
+	if !found {
+		return nil, ErrNotCached
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (c *memoryCache) Put(_ context.Context, id string, content io.Reader) error {
+	buffer, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.binaries[id] = buffer
+
+	return nil
+}
+
+// fileCache is a Cache that stores each binary in a file in a directory
+type fileCache struct {
+	dir string
+}
+
+// NewFileCache returns a [Cache] that stores each binary as a file in the given directory.
+// Incomplete binaries are never left in the directory, even if the process is interrupted.
+func NewFileCache(dir string) Cache {
+	return &fileCache{dir: dir}
+}
+
+func (c *fileCache) Get(_ context.Context, id string) (io.ReadCloser, error) {
+	if err := validCacheID(id); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, id)) //nolint:gosec
+	if os.IsNotExist(err) {
+		return nil, ErrNotCached
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (c *fileCache) Put(_ context.Context, id string, content io.Reader) error {
+	if err := validCacheID(id); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, defaultDirMode); err != nil {
+		return err
+	}
+
+	// the content is written to a temporary file and then renamed, so the binary is stored atomically
+	tmp, err := os.CreateTemp(c.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	_, err = io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(c.dir, id))
+}
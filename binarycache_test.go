@@ -0,0 +1,95 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title    string
+		newCache func(t *testing.T) Cache
+	}{
+		{
+			title:    "memory cache",
+			newCache: func(_ *testing.T) Cache { return NewMemoryCache() },
+		},
+		{
+			title:    "file cache",
+			newCache: func(t *testing.T) Cache { return NewFileCache(filepath.Join(t.TempDir(), "cache")) },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			cache := tc.newCache(t)
+			content := []byte("k6 binary")
+
+			_, err := cache.Get(context.TODO(), "artifact")
+			if !errors.Is(err, ErrNotCached) {
+				t.Fatalf("expected %v got %v", ErrNotCached, err)
+			}
+
+			// a failed put must not store the binary
+			failed := io.MultiReader(bytes.NewReader(content), iotest.ErrReader(errors.New("failed")))
+			if err = cache.Put(context.TODO(), "artifact", failed); err == nil {
+				t.Fatalf("expected error storing binary")
+			}
+
+			_, err = cache.Get(context.TODO(), "artifact")
+			if !errors.Is(err, ErrNotCached) {
+				t.Fatalf("expected %v got %v", ErrNotCached, err)
+			}
+
+			if err = cache.Put(context.TODO(), "artifact", bytes.NewReader(content)); err != nil {
+				t.Fatalf("storing binary %v", err)
+			}
+
+			reader, err := cache.Get(context.TODO(), "artifact")
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			defer reader.Close() //nolint:errcheck
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+		})
+	}
+}
+
+func TestFileCacheInvalidID(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cache := NewFileCache(filepath.Join(dir, "cache"))
+
+	for _, id := range []string{"", "..", "../artifact", "dir/artifact"} {
+		if err := cache.Put(context.TODO(), id, bytes.NewReader([]byte("k6"))); err == nil {
+			t.Fatalf("expected error storing %q", id)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading dir %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("unexpected files %v", entries)
+	}
+}
@@ -0,0 +1,185 @@
+package k6provider
+
+import (
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/grafana/k6build"
+)
+
+// blobsDir is the directory in BinDir where binaries are stored by checksum if the cache
+// is content-addressed
+const blobsDir = "blobs"
+
+// blobPath returns the path of the blob for the checksum. Returns false if the
+// binaries are not content-addressed or the checksum can't identify a blob.
+//
+// Checksums are not verified if InsecureSkipChecksum is enabled, so they can't
+// identify the content of the binaries.
+func (p *Provider) blobPath(checksum string) (string, bool) {
+	if !p.contentAddr || p.skipChecksum {
+		return "", false
+	}
+
+	// the checksum is used as file name, so it is validated for preventing path traversals
+	algorithm, value := parseChecksum(checksum)
+	if _, err := newDigest(checksum); err != nil {
+		return "", false
+	}
+	if _, err := hex.DecodeString(value); err != nil || value == "" {
+		return "", false
+	}
+
+	return filepath.Join(p.binDir, blobsDir, cachedName(algorithm+"-"+value, p.compression)), true
+}
+
+// linkBlob links the artifact's binary to the blob with its checksum, if it exists, instead of
+// downloading it. The blob is verified before it is linked, and removed if it is corrupted.
+// Returns false if the blob doesn't exist or can't be linked.
+func (p *Provider) linkBlob(artifact k6build.Artifact, artifactDir string, binPath string) bool {
+	blob, ok := p.blobPath(artifact.Checksum)
+	if !ok {
+		return false
+	}
+
+	if _, err := os.Stat(blob); err != nil {
+		return false
+	}
+
+	err := verifyFile(blob, artifact.Checksum)
+	if errors.Is(err, errChecksumMismatch) {
+		p.logger.Warn("removing corrupted blob from cache", slog.String("path", blob), slog.String("error", err.Error()))
+		_ = os.Remove(blob)
+		return false
+	}
+	if err != nil {
+		return false
+	}
+
+	if err = os.MkdirAll(artifactDir, p.dirMode); err != nil {
+		return false
+	}
+
+	// as for downloaded binaries, the manifest is written before the binary is linked
+	if err = writeManifest(artifactDir, newManifest(artifact, p.clock.Now()), p.fileMode&^0o111); err != nil {
+		return false
+	}
+
+	if err = p.writeChecksumFile(artifactDir, artifact.Checksum); err != nil {
+		return false
+	}
+
+	return hardlinkFile(blob, binPath) == nil
+}
+
+// storeBinary moves the downloaded binary to its path in the cache, compressing it if the cache is
+// compressed. If the cache is content-addressed, the binary is also linked as the blob with its checksum.
+//
+// The binary doesn't depend on the blob, so failing to link it doesn't fail storing the binary,
+// and a blob removed concurrently by pruneBlobs doesn't affect it.
+func (p *Provider) storeBinary(src string, binPath string, checksum string) error {
+	if p.compression == CompressionGzip {
+		if err := compressFile(src, binPath, p.fileMode); err != nil {
+			return err
+		}
+		_ = os.Remove(src)
+	} else if err := moveFile(src, binPath, p.fileMode); err != nil {
+		return err
+	}
+
+	blob, ok := p.blobPath(checksum)
+	if !ok {
+		return nil
+	}
+
+	// the binary has the blob's checksum, so it can replace a blob stored concurrently
+	err := os.MkdirAll(filepath.Dir(blob), p.dirMode)
+	if err == nil {
+		err = hardlinkFile(binPath, blob)
+	}
+	if err != nil {
+		p.logger.Warn("storing binary by checksum", slog.String("path", blob), slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// hardlinkFile creates a hard link to the target file, replacing any existing file at the link's path.
+// The link is created with a temporary name and then renamed, so it is replaced atomically.
+func hardlinkFile(target string, linkPath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(linkPath), filepath.Base(linkPath)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+	// the link is created with the name of the temporary file
+	_ = os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if err = os.Link(target, tmp.Name()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), linkPath)
+}
+
+// pruneBlobs removes the blobs that are not used by any binary in the cache, for example,
+// because the binaries were pruned. Blobs are used by the binaries of all platforms, so the
+// manifests of the binaries of all platforms are checked.
+func (p *Provider) pruneBlobs() error {
+	if !p.contentAddr || p.skipChecksum {
+		return nil
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(p.binDir, blobsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	platforms, err := os.ReadDir(p.binDir)
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	for _, platform := range platforms {
+		if !platform.IsDir() || platform.Name() == blobsDir {
+			continue
+		}
+
+		artifacts, err := os.ReadDir(filepath.Join(p.binDir, platform.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, artifact := range artifacts {
+			m, err := readManifest(filepath.Join(p.binDir, platform.Name(), artifact.Name()))
+			if err != nil {
+				continue
+			}
+			if blob, ok := p.blobPath(m.Checksum); ok {
+				used[filepath.Base(blob)] = true
+			}
+		}
+	}
+
+	errs := []error{}
+	for _, blob := range blobs {
+		// temporary files are blobs being stored
+		if used[blob.Name()] || strings.HasSuffix(blob.Name(), ".tmp") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(p.binDir, blobsDir, blob.Name())); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
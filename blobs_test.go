@@ -0,0 +1,153 @@
+package k6provider
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestContentAddressed(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title           string
+		config          Config
+		corrupt         bool
+		expectDownloads int32
+		expectShared    bool
+	}{
+		{
+			title:           "identical binaries are shared",
+			config:          Config{ContentAddressed: true},
+			expectDownloads: 1,
+			expectShared:    true,
+		},
+		{
+			title:           "corrupted blob is downloaded again",
+			config:          Config{ContentAddressed: true},
+			corrupt:         true,
+			expectDownloads: 2,
+		},
+		{
+			title:           "disabled",
+			config:          Config{},
+			expectDownloads: 2,
+		},
+		{
+			title:           "checksum not verified",
+			config:          Config{ContentAddressed: true, InsecureSkipChecksum: true},
+			expectDownloads: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, tc.config, content, sha256sum(content))
+			provider.buildSrv = &depsBuildService{url: downloadSrv.URL, checksum: sha256sum(content)}
+
+			downloads := atomic.Int32{}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				downloads.Add(1)
+				_, _ = w.Write(content)
+			})
+
+			// each set of dependencies is a different artifact with the same binary
+			binaries := []K6Binary{}
+			for _, dep := range []string{"k6/x/sql", "k6/x/kafka"} {
+				deps := k6deps.Dependencies{}
+				if err := deps.UnmarshalText([]byte(dep + "=*")); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+
+				k6, err := provider.GetBinary(context.TODO(), deps)
+				if err != nil {
+					t.Fatalf("unexpected %v", err)
+				}
+				binaries = append(binaries, k6)
+
+				if tc.corrupt {
+					// the blob is a link to the binary, so it is replaced for not corrupting the binary
+					blob, _ := provider.blobPath(sha256sum(content))
+					if err = os.Remove(blob); err != nil {
+						t.Fatalf("test setup %v", err)
+					}
+					if err = os.WriteFile(blob, []byte("corrupted"), 0o600); err != nil {
+						t.Fatalf("test setup %v", err)
+					}
+				}
+			}
+
+			if downloads.Load() != tc.expectDownloads {
+				t.Fatalf("expected %d downloads got %d", tc.expectDownloads, downloads.Load())
+			}
+
+			if binaries[1].Stats.CacheHit != tc.expectShared {
+				t.Fatalf("expected cache hit %t got %t", tc.expectShared, binaries[1].Stats.CacheHit)
+			}
+
+			for _, k6 := range binaries {
+				got, err := os.ReadFile(k6.Path)
+				if err != nil {
+					t.Fatalf("reading binary %v", err)
+				}
+				if string(got) != string(content) {
+					t.Fatalf("expected %q got %q", content, got)
+				}
+			}
+
+			first, err := os.Stat(binaries[0].Path)
+			if err != nil {
+				t.Fatalf("stat binary %v", err)
+			}
+			second, err := os.Stat(binaries[1].Path)
+			if err != nil {
+				t.Fatalf("stat binary %v", err)
+			}
+			if os.SameFile(first, second) != tc.expectShared {
+				t.Fatalf("expected shared binary %t", tc.expectShared)
+			}
+		})
+	}
+}
+
+func TestPruneBlobs(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{ContentAddressed: true}, content, sha256sum(content))
+
+	_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(provider.binDir, blobsDir))
+	if err != nil {
+		t.Fatalf("reading blobs %v", err)
+	}
+	if len(blobs) != 1 {
+		t.Fatalf("expected 1 blob got %d", len(blobs))
+	}
+
+	_, err = provider.PruneCache(context.TODO(), 0)
+	if err != nil {
+		t.Fatalf("pruning cache %v", err)
+	}
+
+	blobs, err = os.ReadDir(filepath.Join(provider.binDir, blobsDir))
+	if err != nil {
+		t.Fatalf("reading blobs %v", err)
+	}
+	if len(blobs) != 0 {
+		t.Fatalf("expected blobs to be removed, found %d", len(blobs))
+	}
+}
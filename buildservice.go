@@ -0,0 +1,382 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+)
+
+// maxBuildErrorSize limits the size of the body of build responses with an unexpected status
+// that is read looking for the error reported by the build service
+const maxBuildErrorSize = 64 << 10
+
+// newBuildService returns a client for the build services in the configuration.
+// If more than one build service is configured, they are used as fallback.
+// If a BuildService is given in the configuration, it is used instead.
+func newBuildService(config Config) (k6build.BuildService, error) {
+	if err := validateBuildOpts(config.BuildOpts); err != nil {
+		return nil, err
+	}
+
+	if config.BuildService != nil {
+		return config.BuildService, nil
+	}
+
+	urls := buildServiceURLs(config)
+	if len(urls) == 0 {
+		return nil, NewWrappedError(
+			ErrConfig,
+			errors.New("build service URL not configured; set BuildServiceURL or K6_BUILD_SERVICE_URL"),
+		)
+	}
+
+	auth := config.BuildServiceAuth
+	if auth == "" {
+		auth = os.Getenv("K6_BUILD_SERVICE_AUTH")
+	}
+
+	authType := config.BuildServiceAuthType
+	if authType == "" && auth != "" {
+		authType = defaultAuthType
+	}
+
+	header := http.Header{}
+	header.Set("User-Agent", userAgent(config))
+	for h, v := range config.BuildServiceHeaders {
+		header.Set(h, v)
+	}
+	if auth != "" {
+		header.Set("Authorization", fmt.Sprintf("%s %s", authType, auth))
+	}
+
+	clock := config.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	services := make([]k6build.BuildService, 0, len(urls))
+	for _, serviceURL := range urls {
+		if serviceURL == "" {
+			return nil, NewWrappedError(ErrConfig, errors.New("empty build service URL"))
+		}
+		services = append(
+			services,
+			&buildServiceClient{
+				url:            serviceURL,
+				header:         header,
+				contextHeaders: config.ContextHeaders,
+				modifier:       config.BuildRequestModifier,
+				clock:          clock,
+			},
+		)
+	}
+
+	if len(services) == 1 {
+		return services[0], nil
+	}
+
+	return &fallbackBuildService{services: services}, nil
+}
+
+// buildServiceURLs returns the URLs of the build services in the configuration, in order.
+// If none is configured, the K6_BUILD_SERVICE_URL environment variable is used
+func buildServiceURLs(config Config) []string {
+	urls := []string{}
+	if config.BuildServiceURL != "" {
+		urls = append(urls, config.BuildServiceURL)
+	}
+	urls = append(urls, config.BuildServiceURLs...)
+
+	if len(urls) == 0 {
+		if envURL := os.Getenv("K6_BUILD_SERVICE_URL"); envURL != "" {
+			urls = append(urls, envURL)
+		}
+	}
+
+	return urls
+}
+
+// fallbackBuildService requests the build to a list of build services in order,
+// until one succeeds. Only failures due to network errors or 5xx and 429 responses
+// fall back to the next build service.
+type fallbackBuildService struct {
+	services []k6build.BuildService
+}
+
+func (f *fallbackBuildService) Build(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	var err error
+	for _, srv := range f.services {
+		var artifact k6build.Artifact
+		artifact, err = srv.Build(ctx, platform, k6Constrains, deps)
+		if err == nil || !isRetryableBuildError(err) {
+			return artifact, err
+		}
+
+		if ctx.Err() != nil {
+			return k6build.Artifact{}, fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+	}
+
+	return k6build.Artifact{}, err
+}
+
+// ping checks all the build services in order until one is available
+func (f *fallbackBuildService) ping(ctx context.Context) error {
+	errs := make([]error, 0, len(f.services))
+	for _, srv := range f.services {
+		p, ok := srv.(pinger)
+		if !ok {
+			return nil
+		}
+
+		err := p.ping(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// pinger is implemented by build services that can check their availability
+type pinger interface {
+	ping(ctx context.Context) error
+}
+
+// buildServiceClient is a client for a build service that can check its availability.
+//
+// It implements the protocol of the k6build client, which doesn't allow customizing its requests,
+// so the BuildRequestModifier can be applied to them.
+type buildServiceClient struct {
+	url            string
+	header         http.Header
+	contextHeaders map[any]string
+	modifier       RequestModifier
+	clock          clock
+}
+
+// Build requests the build to the build service. Relative artifact URLs, such as "/artifacts/id/k6",
+// are resolved against the URL of the build service.
+//
+// The status of the response is checked before its body is decoded, as responses with an unexpected
+// status may not come from the build service (e.g. a 502 from a proxy with an HTML body). These responses
+// are reported as a [buildStatusError]: wrapped in an api.ErrRequestFailed error if its body doesn't
+// have an error, or with the error reported by the build service as the cause otherwise. The delay
+// requested by their Retry-After header, if any, is kept for retrying or polling the build.
+func (c *buildServiceClient) Build(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	body := &bytes.Buffer{}
+	err := json.NewEncoder(body).Encode(api.BuildRequest{
+		Platform:     platform,
+		K6Constrains: k6Constrains,
+		Dependencies: deps,
+	})
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrInvalidRequest, err)
+	}
+
+	buildURL, err := url.Parse(c.url)
+	if err != nil {
+		return k6build.Artifact{}, fmt.Errorf("invalid server %w", err)
+	}
+	buildURL.Path = "/build/"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, buildURL.String(), body)
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+	req.Header = c.header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	injectContextHeaders(ctx, req.Header, c.contextHeaders)
+	if c.modifier != nil {
+		c.modifier(req)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return k6build.Artifact{}, newBuildStatusError(resp, c.clock.Now())
+	}
+
+	buildResponse := api.BuildResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+
+	if buildResponse.Error != nil {
+		return k6build.Artifact{}, buildResponse.Error
+	}
+
+	artifact := buildResponse.Artifact
+	artifact.URL = resolveArtifactURL(c.url, artifact.URL)
+
+	return artifact, nil
+}
+
+// buildStatusError reports a response from the build service with an unexpected status.
+// If the body of the response has an error reported by the build service, it is the cause.
+// If the response has a Retry-After header, retryAfter is the delay it requests.
+type buildStatusError struct {
+	status     int
+	retryAfter time.Duration
+	cause      error
+}
+
+// newBuildStatusError returns the error for a response with an unexpected status. The body is decoded
+// only to find the error reported by the build service, if any, so it is ignored if it is not valid.
+// If there is no error in the body, the returned error wraps an api.ErrRequestFailed error.
+func newBuildStatusError(resp *http.Response, now time.Time) error {
+	statusErr := &buildStatusError{status: resp.StatusCode, retryAfter: retryAfter(resp, now)}
+
+	buildResponse := api.BuildResponse{}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBuildErrorSize))
+	if json.Unmarshal(body, &buildResponse) == nil && buildResponse.Error != nil {
+		statusErr.cause = buildResponse.Error
+		return statusErr
+	}
+
+	return k6build.NewWrappedError(api.ErrRequestFailed, statusErr)
+}
+
+func (e *buildStatusError) Error() string {
+	if e.cause != nil {
+		return e.cause.Error()
+	}
+	return fmt.Sprintf("%d %s", e.status, http.StatusText(e.status))
+}
+
+func (e *buildStatusError) Unwrap() error {
+	return e.cause
+}
+
+// resolveArtifactURL resolves a relative artifact URL against the base URL.
+// Absolute or invalid URLs are returned unchanged.
+func resolveArtifactURL(base string, artifactURL string) string {
+	if artifactURL == "" {
+		return artifactURL
+	}
+
+	ref, err := url.Parse(artifactURL)
+	if err != nil || ref.IsAbs() {
+		return artifactURL
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return artifactURL
+	}
+
+	return baseURL.ResolveReference(ref).String()
+}
+
+// ping sends a request to the build service and checks it responds with a non 5xx status.
+// The build service doesn't have a health endpoint, so any other response is considered
+// a signal that it is reachable, except 401, 403 and 404, which indicate the credentials
+// are rejected or the URL doesn't point to the build service.
+func (c *buildServiceClient) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = c.header.Clone()
+	injectContextHeaders(ctx, req.Header, c.contextHeaders)
+	if c.modifier != nil {
+		c.modifier(req)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusUnauthorized,
+		resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: status %s", c.url, resp.Status)
+	}
+
+	return nil
+}
+
+// Ping checks if the build service is reachable and responsive. If fallback build services
+// are configured, it succeeds if any of them is available.
+//
+// Ping fails with ErrBuildServiceUnavailable if the build service can't be reached, responds
+// with a 5xx, 401, 403 or 404 status or the build timeout expires. If a custom BuildService
+// is used, its availability can't be checked and Ping fails with ErrPingUnsupported.
+func (p *Provider) Ping(ctx context.Context) error {
+	if p.closed.Load() {
+		return ErrClosed
+	}
+
+	srv, ok := p.buildSrv.(pinger)
+	if !ok {
+		return ErrPingUnsupported
+	}
+
+	pingCtx, cancel := withTimeout(ctx, p.buildTimeout)
+	defer cancel()
+
+	if err := srv.ping(pingCtx); err != nil {
+		return NewWrappedError(ErrBuildServiceUnavailable, err)
+	}
+
+	return nil
+}
+
+// supportedBuildOpts lists the build options the build service client can forward to the build service.
+// The k6build client doesn't accept build options, so none is supported yet.
+var supportedBuildOpts = []string{} //nolint:gochecknoglobals
+
+// validateBuildOpts checks the build options are supported by the build service client
+func validateBuildOpts(opts map[string]string) error {
+	unsupported := []string{}
+	for opt := range opts {
+		if !slices.Contains(supportedBuildOpts, opt) {
+			unsupported = append(unsupported, opt)
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	sort.Strings(unsupported)
+
+	return NewWrappedError(
+		ErrConfig,
+		fmt.Errorf("build options not supported by the build service client: %s", strings.Join(unsupported, ", ")),
+	)
+}
@@ -0,0 +1,489 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6deps"
+)
+
+func TestBuildServiceFallback(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title           string
+		primaryStatus   int
+		primaryBody     string
+		expectErr       error
+		expectFallbacks int32
+	}{
+		{
+			title:           "primary available",
+			primaryStatus:   http.StatusOK,
+			expectFallbacks: 0,
+		},
+		{
+			title:           "primary unavailable",
+			primaryStatus:   http.StatusServiceUnavailable,
+			expectFallbacks: 1,
+		},
+		{
+			title:           "primary behind unavailable proxy",
+			primaryStatus:   http.StatusBadGateway,
+			primaryBody:     "<html><body>502 Bad Gateway</body></html>",
+			expectFallbacks: 1,
+		},
+		{
+			title:           "bad request is not retried",
+			primaryStatus:   http.StatusBadRequest,
+			primaryBody:     "<html><body>400 Bad Request</body></html>",
+			expectErr:       ErrBuild,
+			expectFallbacks: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			_, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+			artifact := k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)}
+			fallback := newTestBuildServer(t, "", "", artifact)
+			handler := fallback.Config.Handler
+
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.primaryStatus == http.StatusOK {
+					handler.ServeHTTP(w, r)
+					return
+				}
+				w.WriteHeader(tc.primaryStatus)
+				_, _ = w.Write([]byte(tc.primaryBody))
+			}))
+			t.Cleanup(primary.Close)
+
+			fallbacks := atomic.Int32{}
+			fallback.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fallbacks.Add(1)
+				handler.ServeHTTP(w, r)
+			})
+
+			provider, err := NewProvider(
+				WithBuildServiceURL(primary.URL),
+				WithBuildServiceURLs(fallback.URL),
+				WithBinDir(t.TempDir()),
+				WithRetry(RetryConfig{MaxAttempts: 1}),
+			)
+			if err != nil {
+				t.Fatalf("initializing provider %v", err)
+			}
+
+			_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if fallbacks.Load() != tc.expectFallbacks {
+				t.Fatalf("expected %d fallbacks got %d", tc.expectFallbacks, fallbacks.Load())
+			}
+		})
+	}
+}
+
+func TestBuildServiceClientStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		status    int
+		body      string
+		expectErr error
+	}{
+		{
+			title:     "html body",
+			status:    http.StatusBadGateway,
+			body:      "<html><body>502 Bad Gateway</body></html>",
+			expectErr: api.ErrRequestFailed,
+		},
+		{
+			title:     "empty body",
+			status:    http.StatusServiceUnavailable,
+			expectErr: api.ErrRequestFailed,
+		},
+		{
+			title:     "accepted with empty body",
+			status:    http.StatusAccepted,
+			expectErr: api.ErrRequestFailed,
+		},
+		{
+			title:     "error reported by the build service",
+			status:    http.StatusBadRequest,
+			body:      `{"error":{"error":"invalid request","reason":{"error":"invalid dependency"}}}`,
+			expectErr: api.ErrInvalidRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(srv.Close)
+
+			client := &buildServiceClient{url: srv.URL, header: http.Header{}, clock: realClock{}}
+			_, err := client.Build(context.TODO(), "linux/amd64", "*", nil)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			statusErr := &buildStatusError{}
+			if !errors.As(err, &statusErr) || statusErr.status != tc.status {
+				t.Fatalf("expected status %d got %v", tc.status, err)
+			}
+		})
+	}
+}
+
+func TestRelativeArtifactURL(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title       string
+		basePath    string
+		artifactURL func(srvURL string) string
+	}{
+		{
+			title:       "absolute url",
+			artifactURL: func(srvURL string) string { return srvURL + "/artifacts/artifact/k6" },
+		},
+		{
+			title:       "absolute path",
+			artifactURL: func(string) string { return "/artifacts/artifact/k6" },
+		},
+		{
+			title:       "path relative to base path",
+			basePath:    "/api/",
+			artifactURL: func(string) string { return "artifacts/artifact/k6" },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			// the artifact's URL depends on the server's URL, so the handler is replaced once it is known
+			artifact := k6build.Artifact{ID: "artifact", Checksum: sha256sum(content)}
+			buildSrv := newTestBuildServer(t, "", "", artifact)
+			artifact.URL = tc.artifactURL(buildSrv.URL)
+			buildHandler := newTestBuildServer(t, "", "", artifact).Config.Handler
+
+			downloads := atomic.Int32{}
+			buildSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/artifacts/artifact/k6") {
+					downloads.Add(1)
+					_, _ = w.Write(content)
+					return
+				}
+				buildHandler.ServeHTTP(w, r)
+			})
+
+			provider, err := NewProvider(
+				WithBuildServiceURL(buildSrv.URL+tc.basePath),
+				WithBinDir(t.TempDir()),
+			)
+			if err != nil {
+				t.Fatalf("initializing provider %v", err)
+			}
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			expectURL := buildSrv.URL + tc.basePath + "artifacts/artifact/k6"
+			if tc.basePath == "" {
+				expectURL = buildSrv.URL + "/artifacts/artifact/k6"
+			}
+			if k6.URL != expectURL {
+				t.Fatalf("expected url %s got %s", expectURL, k6.URL)
+			}
+
+			if downloads.Load() != 1 {
+				t.Fatalf("expected 1 download got %d", downloads.Load())
+			}
+		})
+	}
+}
+
+func TestCustomBuildService(t *testing.T) { //nolint:paralleltest
+	// the build service URL is not required when a build service is given
+	t.Setenv("K6_BUILD_SERVICE_URL", "")
+
+	content := []byte("k6 binary")
+	_, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	buildSrv := &countingBuildService{
+		testBuildService: testBuildService{
+			artifact: k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)},
+		},
+	}
+
+	provider, err := NewProvider(
+		WithBuildService(buildSrv),
+		WithBinDir(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if k6.URL != downloadSrv.URL {
+		t.Fatalf("expected url %s got %s", downloadSrv.URL, k6.URL)
+	}
+
+	if buildSrv.builds.Load() != 1 {
+		t.Fatalf("expected 1 build got %d", buildSrv.builds.Load())
+	}
+}
+
+func TestBuildQueued(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title        string
+		queued       int32
+		retryAfter   string
+		timeout      time.Duration
+		maxQueueWait time.Duration
+		expectErr    error
+		expectQueued int32
+		expectWait   time.Duration
+	}{
+		{
+			title:        "build ready after polling",
+			queued:       2,
+			expectQueued: 2,
+		},
+		{
+			title:        "retry after",
+			queued:       1,
+			retryAfter:   "1",
+			expectQueued: 1,
+			expectWait:   time.Second,
+		},
+		{
+			title:     "build not ready before timeout",
+			queued:    math.MaxInt32,
+			timeout:   50 * time.Millisecond,
+			expectErr: context.DeadlineExceeded,
+		},
+		{
+			title:        "build queued for too long",
+			queued:       math.MaxInt32,
+			maxQueueWait: 50 * time.Millisecond,
+			expectErr:    ErrBuildQueued,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			notified := atomic.Int32{}
+			waited := atomic.Int64{}
+			config := Config{
+				BuildTimeout: tc.timeout,
+				Retry:        RetryConfig{MaxQueueWait: tc.maxQueueWait},
+				BuildQueuedFunc: func(wait time.Duration) {
+					notified.Add(1)
+					waited.Store(int64(wait))
+				},
+			}
+			provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+			artifact := k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)}
+			buildSrv := newTestBuildServer(t, "", "", artifact)
+			handler := buildSrv.Config.Handler
+
+			requests := atomic.Int32{}
+			buildSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tc.queued {
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			})
+
+			srv, err := newBuildService(Config{BuildServiceURL: buildSrv.URL})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+			provider.buildSrv = srv
+
+			_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				if !errors.Is(err, ErrBuild) {
+					t.Fatalf("expected %v got %v", ErrBuild, err)
+				}
+				return
+			}
+
+			if notified.Load() != tc.expectQueued {
+				t.Fatalf("expected %d queued notifications got %d", tc.expectQueued, notified.Load())
+			}
+
+			if tc.expectWait > 0 && time.Duration(waited.Load()) != tc.expectWait {
+				t.Fatalf("expected to wait %v got %v", tc.expectWait, time.Duration(waited.Load()))
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	testCases := []struct {
+		title     string
+		statuses  []int
+		fallback  []string
+		timeout   time.Duration
+		expectErr error
+	}{
+		{
+			title:    "available",
+			statuses: []int{http.StatusMethodNotAllowed},
+		},
+		{
+			title:     "unauthorized",
+			statuses:  []int{http.StatusUnauthorized},
+			expectErr: ErrBuildServiceUnavailable,
+		},
+		{
+			title:     "forbidden",
+			statuses:  []int{http.StatusForbidden},
+			expectErr: ErrBuildServiceUnavailable,
+		},
+		{
+			title:     "not found",
+			statuses:  []int{http.StatusNotFound},
+			expectErr: ErrBuildServiceUnavailable,
+		},
+		{
+			title:     "service error",
+			statuses:  []int{http.StatusServiceUnavailable},
+			expectErr: ErrBuildServiceUnavailable,
+		},
+		{
+			title:     "unreachable",
+			fallback:  []string{unreachable.URL},
+			expectErr: ErrBuildServiceUnavailable,
+		},
+		{
+			title:    "fallback available",
+			statuses: []int{http.StatusBadGateway, http.StatusOK},
+		},
+		{
+			title:     "timeout",
+			statuses:  []int{http.StatusOK},
+			timeout:   50 * time.Millisecond,
+			expectErr: ErrBuildServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			urls := []string{}
+			for _, status := range tc.statuses {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Header.Get("Authorization") != "Bearer token" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					if tc.timeout > 0 {
+						select {
+						case <-r.Context().Done():
+						case <-time.After(10 * tc.timeout):
+						}
+					}
+					w.WriteHeader(status)
+				}))
+				t.Cleanup(srv.Close)
+				urls = append(urls, srv.URL)
+			}
+			urls = append(urls, tc.fallback...)
+
+			provider, err := NewProvider(
+				WithBuildServiceURLs(urls...),
+				WithBuildServiceAuth("", "token"),
+				WithBuildTimeout(tc.timeout),
+				WithBinDir(t.TempDir()),
+			)
+			if err != nil {
+				t.Fatalf("initializing provider %v", err)
+			}
+
+			err = provider.Ping(context.TODO())
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestPingUnsupported(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	err := provider.Ping(context.TODO())
+	if !errors.Is(err, ErrPingUnsupported) {
+		t.Fatalf("expected %v got %v", ErrPingUnsupported, err)
+	}
+}
+
+func TestBuildServiceURLNotConfigured(t *testing.T) { //nolint:paralleltest
+	t.Setenv("K6_BUILD_SERVICE_URL", "")
+
+	_, err := NewProvider(WithBinDir(t.TempDir()))
+	if !errors.Is(err, ErrConfig) {
+		t.Fatalf("expected %v got %v", ErrConfig, err)
+	}
+
+	if !strings.Contains(err.Error(), "K6_BUILD_SERVICE_URL") {
+		t.Fatalf("expected error to mention K6_BUILD_SERVICE_URL got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CachedBinary describes a binary stored in the cache
+type CachedBinary struct {
+	// ID of the artifact
+	ID string
+	// Path to the binary
+	Path string
+	// Platform of the binary
+	Platform string
+	// Dependencies as a map of name: version
+	Dependencies map[string]string
+	// Checksum of the binary
+	Checksum string
+	// Size of the binary in bytes
+	Size int64
+	// LastAccess is the last time the binary was used. Access time is tracked only if
+	// the HighWaterMark is set. Otherwise, it is the time the binary was downloaded.
+	LastAccess time.Time
+	// Downloaded is the time the binary was downloaded.
+	// Not available for binaries cached by previous versions.
+	Downloaded time.Time
+}
+
+// walkBatchSize is the number of directory entries read at once by WalkCache
+const walkBatchSize = 100
+
+// ListCached returns the binaries for the provider's platform stored in the cache.
+// Binaries being downloaded are not included. For large caches, consider using [Provider.WalkCache].
+func (p *Provider) ListCached(ctx context.Context) ([]CachedBinary, error) {
+	binaries := []CachedBinary{}
+	err := p.WalkCache(ctx, func(binary CachedBinary) error {
+		binaries = append(binaries, binary)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return binaries, nil
+}
+
+// WalkCache calls fn for each of the binaries for the provider's platform stored in the cache, as
+// returned by [Provider.ListCached], without loading all of them in memory. The binaries are visited
+// in no particular order. Binaries being downloaded are not included.
+//
+// Walking the cache stops if fn returns an error or the context is cancelled, returning the error.
+func (p *Provider) WalkCache(ctx context.Context, fn func(CachedBinary) error) error {
+	dir, err := os.Open(p.cacheDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return NewWrappedError(ErrBinary, err)
+	}
+	defer dir.Close() //nolint:errcheck
+
+	for {
+		entries, err := dir.ReadDir(walkBatchSize)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return NewWrappedError(ErrBinary, err)
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			// skip any spurious file, each binary is in a directory
+			if !entry.IsDir() {
+				continue
+			}
+
+			binary, found := p.cachedEntry(entry.Name())
+			if !found {
+				continue
+			}
+
+			if err := fn(binary); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// cachedEntry returns the binary of the artifact in the cache. Returns false if the artifact's
+// directory doesn't have a binary.
+func (p *Provider) cachedEntry(id string) (CachedBinary, bool) {
+	artifactDir := filepath.Join(p.cacheDir(), id)
+	binPath := filepath.Join(artifactDir, cachedName(p.binary, p.compression))
+	binInfo, err := os.Stat(binPath)
+	if err != nil {
+		// binary is being downloaded or the directory is a leftover of a failed download
+		return CachedBinary{}, false
+	}
+
+	binary := CachedBinary{
+		ID:         id,
+		Path:       binPath,
+		Size:       binInfo.Size(),
+		LastAccess: binInfo.ModTime(),
+	}
+
+	// binaries cached by previous versions don't have a manifest
+	if m, err := readManifest(artifactDir); err == nil {
+		binary.Platform = m.Platform
+		binary.Dependencies = m.Dependencies
+		binary.Checksum = m.Checksum
+		binary.Downloaded = m.Downloaded
+	}
+
+	return binary, true
+}
+
+// CacheStats are aggregate statistics of the cache
+type CacheStats struct {
+	// Hits is the number of binaries found in the cache since the provider was created
+	Hits int64
+	// Misses is the number of binaries not found in the cache since the provider was created
+	Misses int64
+	// Downloads is the number of binaries downloaded since the provider was created
+	Downloads int64
+	// DownloadedBytes is the size of the binaries downloaded since the provider was created
+	DownloadedBytes int64
+	// Entries is the number of binaries for the provider's platform stored in the cache
+	Entries int
+	// Size is the total size in bytes of the binaries for the provider's platform stored in the cache.
+	// Binaries shared using ContentAddressed are counted once for each artifact
+	Size int64
+}
+
+// CacheStats returns the statistics of the cache. The counters are kept in memory, and
+// include the binaries obtained for all the platforms with GetBinaries. The totals are
+// computed from the binaries stored in the cache, as returned by [Provider.ListCached].
+// If the cache can't be read, the totals are zero.
+func (p *Provider) CacheStats() CacheStats {
+	stats := CacheStats{
+		Hits:            p.metrics.hits.Load(),
+		Misses:          p.metrics.misses.Load(),
+		Downloads:       p.metrics.downloads.Load(),
+		DownloadedBytes: p.metrics.downloadedBytes.Load(),
+	}
+
+	entries, size := 0, int64(0)
+	err := p.WalkCache(context.Background(), func(binary CachedBinary) error {
+		entries++
+		size += binary.Size
+		return nil
+	})
+	if err != nil {
+		return stats
+	}
+
+	stats.Entries = entries
+	stats.Size = size
+
+	return stats
+}
@@ -0,0 +1,152 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+)
+
+func TestListCached(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{Platform: "linux/amd64"}, content, sha256sum(content))
+
+	cached, err := provider.ListCached(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if len(cached) != 0 {
+		t.Fatalf("expected empty cache got %v", cached)
+	}
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// a leftover of a failed download must be ignored
+	if err = os.MkdirAll(filepath.Join(provider.cacheDir(), "failed"), 0o700); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	cached, err = provider.ListCached(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if len(cached) != 1 {
+		t.Fatalf("expected 1 binary got %v", cached)
+	}
+
+	binary := cached[0]
+	if binary.ID != "artifact" || binary.Path != k6.Path || binary.Platform != "linux/amd64" ||
+		binary.Checksum != k6.Checksum || binary.Size != int64(len(content)) ||
+		binary.Dependencies["k6"] != "v0.50.0" || binary.LastAccess.IsZero() {
+		t.Fatalf("unexpected %+v", binary)
+	}
+}
+
+func TestWalkCache(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	for _, id := range []string{"artifact-1", "artifact-2", "artifact-3"} {
+		provider.buildSrv = &testBuildService{
+			artifact: k6build.Artifact{ID: id, URL: downloadSrv.URL, Checksum: sha256sum(content)},
+		}
+		if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	}
+
+	errStop := errors.New("stop")
+	cancelled, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	testCases := []struct {
+		title     string
+		ctx       context.Context
+		stopAfter int
+		expect    int
+		expectErr error
+	}{
+		{
+			title:  "all binaries",
+			ctx:    context.TODO(),
+			expect: 3,
+		},
+		{
+			title:     "stopped by function",
+			ctx:       context.TODO(),
+			stopAfter: 2,
+			expect:    2,
+			expectErr: errStop,
+		},
+		{
+			title:     "cancelled context",
+			ctx:       cancelled,
+			expect:    0,
+			expectErr: context.Canceled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			visited := 0
+			err := provider.WalkCache(tc.ctx, func(CachedBinary) error {
+				visited++
+				if visited == tc.stopAfter {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if visited != tc.expect {
+				t.Fatalf("expected %d binaries got %d", tc.expect, visited)
+			}
+		})
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	if stats := provider.CacheStats(); stats != (CacheStats{}) {
+		t.Fatalf("expected empty stats got %+v", stats)
+	}
+
+	// the second time, the binary is found in the cache
+	for range 2 {
+		if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	}
+
+	expected := CacheStats{
+		Hits:            1,
+		Misses:          1,
+		Downloads:       1,
+		DownloadedBytes: int64(len(content)),
+		Entries:         1,
+		Size:            int64(len(content)),
+	}
+	if stats := provider.CacheStats(); stats != expected {
+		t.Fatalf("expected %+v got %+v", expected, stats)
+	}
+}
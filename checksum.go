@@ -0,0 +1,98 @@
+package k6provider
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultChecksumAlgorithm is the algorithm of the checksums without an algorithm prefix
+const defaultChecksumAlgorithm = "sha256"
+
+// errUnsupportedChecksum is returned when the checksum of a binary uses an unsupported algorithm
+var errUnsupportedChecksum = errors.New("unsupported checksum algorithm")
+
+// checksumAlgorithms maps the supported checksum algorithms to their hash functions
+var checksumAlgorithms = map[string]func() hash.Hash{ //nolint:gochecknoglobals
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// parseChecksum splits a checksum in the form "<algorithm>:<hex value>" (e.g. "sha512:ab12...")
+// in its algorithm and value. Checksums without an algorithm prefix use sha256.
+// Both are returned in lowercase, as build services may return the value in uppercase hex.
+func parseChecksum(checksum string) (string, string) {
+	algorithm, value, found := strings.Cut(checksum, ":")
+	if !found {
+		return defaultChecksumAlgorithm, strings.ToLower(checksum)
+	}
+
+	return strings.ToLower(algorithm), strings.ToLower(value)
+}
+
+// newDigest returns a hash for computing the checksum with the checksum's algorithm
+func newDigest(checksum string) (hash.Hash, error) {
+	algorithm, _ := parseChecksum(checksum)
+
+	newHash, found := checksumAlgorithms[algorithm]
+	if !found {
+		return nil, fmt.Errorf("%w %q", errUnsupportedChecksum, algorithm)
+	}
+
+	return newHash(), nil
+}
+
+// newDigest returns a hash for computing the checksum. If InsecureSkipChecksum is enabled,
+// the checksum is not verified, so its algorithm doesn't need to be supported.
+func (p *Provider) newDigest(checksum string) (hash.Hash, error) {
+	if p.skipChecksum {
+		return sha256.New(), nil
+	}
+
+	return newDigest(checksum)
+}
+
+// verifyDigest checks the digest matches the expected checksum
+func verifyDigest(digest hash.Hash, checksum string) error {
+	_, expected := parseChecksum(checksum)
+
+	computed := hex.EncodeToString(digest.Sum(nil))
+	if computed != expected {
+		return fmt.Errorf("%w: expected %s got %s", errChecksumMismatch, expected, computed)
+	}
+
+	return nil
+}
+
+// copyHashed copies the content to dest adding it to the hash, which can include previous content,
+// and verifies the resulting checksum matches the expected one
+func copyHashed(dest io.Writer, content io.Reader, digest hash.Hash, checksum string) (int64, error) {
+	size, err := io.Copy(io.MultiWriter(dest, digest), content)
+	if err != nil {
+		return size, err
+	}
+
+	return size, verifyDigest(digest, checksum)
+}
+
+// writeChecksumFile writes the checksum of the binary in a file in the given directory, if EmitChecksumFile
+// is enabled. The file is named after the binary and the checksum's algorithm (e.g. "k6.sha256") and has
+// the format used by sha256sum and similar tools: "<checksum>  <binary>", so it can be verified with them.
+func (p *Provider) writeChecksumFile(dir string, checksum string) error {
+	if !p.emitChecksum || p.skipChecksum || checksum == "" {
+		return nil
+	}
+
+	algorithm, value := parseChecksum(checksum)
+	content := fmt.Sprintf("%s  %s\n", value, p.binary)
+
+	return os.WriteFile(filepath.Join(dir, p.binary+"."+algorithm), []byte(content), p.fileMode&^0o111)
+}
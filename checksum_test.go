@@ -0,0 +1,174 @@
+package k6provider
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	sha384sum := sha512.Sum384(content)
+	sha512sum := sha512.Sum512(content)
+
+	testCases := []struct {
+		title     string
+		checksum  string
+		expectErr error
+	}{
+		{
+			title:    "unprefixed checksum",
+			checksum: sha256sum(content),
+		},
+		{
+			title:    "sha256",
+			checksum: "sha256:" + sha256sum(content),
+		},
+		{
+			title:    "sha384",
+			checksum: "sha384:" + hex.EncodeToString(sha384sum[:]),
+		},
+		{
+			title:    "sha512",
+			checksum: "SHA512:" + hex.EncodeToString(sha512sum[:]),
+		},
+		{
+			title:    "uppercase value",
+			checksum: "sha512:" + strings.ToUpper(hex.EncodeToString(sha512sum[:])),
+		},
+		{
+			title:     "algorithm mismatch",
+			checksum:  "sha512:" + sha256sum(content),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "unsupported algorithm",
+			checksum:  "md5:" + sha256sum(content),
+			expectErr: ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, content, tc.checksum)
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			// the binary is verified using the checksum's algorithm when found in the cache
+			err = verifyBinary(filepath.Dir(k6.Path), k6.Path, tc.checksum)
+			if err != nil {
+				t.Fatalf("verifying cached binary %v", err)
+			}
+		})
+	}
+}
+
+func TestNewDigest(t *testing.T) {
+	t.Parallel()
+
+	_, err := newDigest("blake3:abcd")
+	if !errors.Is(err, errUnsupportedChecksum) {
+		t.Fatalf("expected %v got %v", errUnsupportedChecksum, err)
+	}
+}
+
+func TestEmitChecksumFile(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	sum512 := sha512.Sum512(content)
+
+	testCases := []struct {
+		title    string
+		config   Config
+		checksum string
+		expect   string
+	}{
+		{
+			title:    "sha256",
+			config:   Config{EmitChecksumFile: true},
+			checksum: sha256sum(content),
+			expect:   "k6.sha256",
+		},
+		{
+			title:    "sha512",
+			config:   Config{EmitChecksumFile: true},
+			checksum: "sha512:" + hex.EncodeToString(sum512[:]),
+			expect:   "k6.sha512",
+		},
+		{
+			title:    "uncached binary",
+			config:   Config{EmitChecksumFile: true, NoCache: true},
+			checksum: sha256sum(content),
+			expect:   "k6.sha256",
+		},
+		{
+			title:    "disabled",
+			config:   Config{},
+			checksum: sha256sum(content),
+		},
+		{
+			title:    "checksum not verified",
+			config:   Config{EmitChecksumFile: true, InsecureSkipChecksum: true},
+			checksum: sha256sum(content),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			tc.config.Platform = "linux/amd64"
+			provider, _ := newTestProvider(t, tc.config, content, tc.checksum)
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			files, err := filepath.Glob(filepath.Join(filepath.Dir(k6.Path), "k6.sha*"))
+			if err != nil {
+				t.Fatalf("listing files %v", err)
+			}
+
+			if tc.expect == "" {
+				if len(files) != 0 {
+					t.Fatalf("expected no checksum file got %v", files)
+				}
+				return
+			}
+
+			if len(files) != 1 || filepath.Base(files[0]) != tc.expect {
+				t.Fatalf("expected %s got %v", tc.expect, files)
+			}
+
+			got, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatalf("reading checksum file %v", err)
+			}
+
+			_, value := parseChecksum(tc.checksum)
+			if expected := value + "  k6\n"; string(got) != expected {
+				t.Fatalf("expected %q got %q", expected, got)
+			}
+		})
+	}
+}
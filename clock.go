@@ -0,0 +1,26 @@
+package k6provider
+
+import "time"
+
+// clock provides the current time and waits. It allows testing time-dependent behavior, such as
+// pruning the binaries not used recently or the backoff between retries, without waiting in the tests.
+type clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the system
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
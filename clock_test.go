@@ -0,0 +1,168 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6deps"
+)
+
+// testClock is a clock that only advances when the test advances it
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After advances the clock by the given duration, so waiting for it returns immediately
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.advance(d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestClock(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	clock := &testClock{now: time.Now()}
+	config := Config{}
+	withClock(clock).apply(&config)
+	provider, _ := newTestProvider(t, config, content, sha256sum(content))
+
+	_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	cached, err := provider.ListCached(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if len(cached) != 1 || !cached[0].Downloaded.Equal(clock.Now()) {
+		t.Fatalf("expected binary downloaded at %v got %+v", clock.Now(), cached)
+	}
+
+	freed, err := provider.PruneCache(context.TODO(), time.Hour)
+	if err != nil || freed != 0 {
+		t.Fatalf("expected binary not to be pruned, freed %d bytes: %v", freed, err)
+	}
+
+	clock.advance(2 * time.Hour)
+
+	freed, err = provider.PruneCache(context.TODO(), time.Hour)
+	if err != nil || freed == 0 {
+		t.Fatalf("expected binary to be pruned: %v", err)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	oldContent := []byte("k6 binary")
+	newContent := []byte("k6 binary rebuilt")
+
+	testCases := []struct {
+		title         string
+		ttl           time.Duration
+		deps          map[string]string
+		elapsed       time.Duration
+		expectContent []byte
+	}{
+		{
+			title:         "not expired",
+			ttl:           time.Hour,
+			elapsed:       time.Minute,
+			expectContent: oldContent,
+		},
+		{
+			title:         "expired",
+			ttl:           time.Hour,
+			elapsed:       2 * time.Hour,
+			expectContent: newContent,
+		},
+		{
+			title:         "expired with pinned dependencies",
+			ttl:           time.Hour,
+			deps:          map[string]string{"k6": "v0.50.0"},
+			elapsed:       2 * time.Hour,
+			expectContent: oldContent,
+		},
+		{
+			title:         "no ttl",
+			elapsed:       2 * time.Hour,
+			expectContent: oldContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			clock := &testClock{now: time.Now()}
+			config := Config{CacheTTL: tc.ttl}
+			withClock(clock).apply(&config)
+			provider, downloadSrv := newTestProvider(t, config, oldContent, sha256sum(oldContent))
+
+			deps := k6deps.Dependencies{}
+			for name, constraints := range tc.deps {
+				dep, err := k6deps.NewDependency(name, constraints)
+				if err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+				deps[name] = dep
+			}
+
+			_, err := provider.GetBinary(context.TODO(), deps)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			// the build service rebuilds the artifact
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(newContent)
+			})
+			buildSrv, _ := provider.buildSrv.(*testBuildService)
+			buildSrv.artifact.Checksum = sha256sum(newContent)
+
+			clock.advance(tc.elapsed)
+
+			k6, err := provider.GetBinary(context.TODO(), deps)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, tc.expectContent) {
+				t.Fatalf("expected %q got %q", tc.expectContent, got)
+			}
+		})
+	}
+}
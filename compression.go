@@ -0,0 +1,191 @@
+package k6provider
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Compression of the binaries stored in the cache (see Config.CacheCompression)
+const (
+	// CompressionNone stores the binaries ready to be executed
+	CompressionNone = "none"
+	// CompressionGzip stores the binaries compressed with gzip
+	CompressionGzip = "gzip"
+)
+
+// gzipSuffix is the suffix of the name of the binaries stored compressed with gzip
+const gzipSuffix = ".gz"
+
+// validateCompression checks the compression of the cache is supported
+func validateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf(
+			"unsupported cache compression %q. Valid values are %s and %s",
+			compression, CompressionNone, CompressionGzip,
+		)
+	}
+}
+
+// cachedName returns the name of the binary in the cache. Compressed binaries are identified by the
+// suffix of their name, so the binaries stored with and without compression don't replace each other.
+func cachedName(binary string, compression string) string {
+	if compression == CompressionGzip {
+		return binary + gzipSuffix
+	}
+
+	return binary
+}
+
+// openCached opens a binary stored in the cache, decompressing its content if it is compressed
+func openCached(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, gzipSuffix) {
+		return file, nil
+	}
+
+	content, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &gzipFile{Reader: content, file: file}, nil
+}
+
+// gzipFile reads the decompressed content of a file
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	_ = f.Reader.Close()
+	return f.file.Close()
+}
+
+// compressFile compresses the file to the destination path with the given permissions, replacing any
+// existing file. As copyFile does, the file is compressed to a temporary file which is then renamed.
+func compressFile(src string, dest string, mode os.FileMode) error {
+	source, err := os.Open(src) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer source.Close() //nolint:errcheck
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	compressed := gzip.NewWriter(tmp)
+	_, err = io.Copy(compressed, source)
+	if closeErr := compressed.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// decompressedBinaries tracks the executable copies of the compressed binaries, so they
+// are reused by later calls
+type decompressedBinaries struct {
+	mutex sync.Mutex
+	paths map[string]string
+}
+
+// executable returns the binary with the path to an executable copy of it, if the cache is compressed.
+// The copy is decompressed in a temporary directory (in TempDir, or the os' tmp dir if not set), which
+// is removed when the provider is closed. The copy is reused while the cached binary doesn't change.
+func (p *Provider) executable(binary K6Binary) (K6Binary, error) {
+	if p.compression != CompressionGzip {
+		return binary, nil
+	}
+
+	p.decompressed.mutex.Lock()
+	defer p.decompressed.mutex.Unlock()
+
+	key := binary.Path + "@" + binary.Checksum
+	if path, found := p.decompressed.paths[key]; found {
+		if info, err := os.Stat(path); err == nil {
+			binary.Path = path
+			binary.Stats.Size = info.Size()
+			return binary, nil
+		}
+	}
+
+	baseDir := p.tempDir
+	if baseDir == "" {
+		baseDir = os.TempDir()
+	}
+
+	dir, err := os.MkdirTemp(baseDir, "k6provider-*")
+	if err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+	p.uncached.add(dir)
+
+	path := filepath.Join(dir, p.binary)
+	size, err := decompressFile(binary.Path, path, p.fileMode)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	if p.decompressed.paths == nil {
+		p.decompressed.paths = map[string]string{}
+	}
+	p.decompressed.paths[key] = path
+
+	binary.Path = path
+	binary.Stats.Size = size
+
+	return binary, nil
+}
+
+// decompressFile decompresses the cached binary to the destination path with the given permissions.
+// Returns the size of the decompressed binary.
+func decompressFile(src string, dest string, mode os.FileMode) (int64, error) {
+	content, err := openCached(src)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close() //nolint:errcheck
+
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode) //nolint:gosec
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return size, os.Chmod(dest, mode)
+}
@@ -0,0 +1,92 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestCacheCompression(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	config := Config{CacheCompression: CompressionGzip, VerifyOnHit: true}
+	provider, _ := newTestProvider(t, config, content, sha256sum(content))
+
+	binaries := []K6Binary{}
+	// the second time, the binary is found in the cache
+	for range 2 {
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+		binaries = append(binaries, k6)
+
+		got, err := os.ReadFile(k6.Path)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+
+		if k6.Stats.Size != int64(len(content)) {
+			t.Fatalf("expected size %d got %d", len(content), k6.Stats.Size)
+		}
+	}
+
+	if !binaries[1].Stats.CacheHit {
+		t.Fatalf("expected cache hit")
+	}
+
+	// the decompressed binary is reused
+	if binaries[0].Path != binaries[1].Path {
+		t.Fatalf("expected same path got %s and %s", binaries[0].Path, binaries[1].Path)
+	}
+
+	cachedPath := filepath.Join(provider.cacheDir(), "artifact", provider.binary+gzipSuffix)
+	compressed, err := os.ReadFile(cachedPath) //nolint:gosec
+	if err != nil {
+		t.Fatalf("reading cached binary %v", err)
+	}
+	if bytes.Equal(compressed, content) {
+		t.Fatalf("expected compressed binary in the cache")
+	}
+
+	cached, err := openCached(cachedPath)
+	if err != nil {
+		t.Fatalf("opening cached binary %v", err)
+	}
+	decompressed, err := io.ReadAll(cached)
+	_ = cached.Close()
+	if err != nil || !bytes.Equal(decompressed, content) {
+		t.Fatalf("expected %q got %q: %v", content, decompressed, err)
+	}
+
+	if err = provider.Close(); err != nil {
+		t.Fatalf("closing provider %v", err)
+	}
+
+	if _, err = os.Stat(binaries[0].Path); !os.IsNotExist(err) {
+		t.Fatalf("expected decompressed binary to be removed got %v", err)
+	}
+}
+
+func TestUnsupportedCacheCompression(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewProvider(
+		WithBuildServiceURL("http://localhost"),
+		WithBinDir(t.TempDir()),
+		WithCacheCompression("zstd"),
+	)
+	if !errors.Is(err, ErrConfig) {
+		t.Fatalf("expected %v got %v", ErrConfig, err)
+	}
+}
@@ -0,0 +1,78 @@
+package k6provider
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6deps"
+)
+
+// errConflictingConstraints is returned when two constraints can't be satisfied by the same version
+var errConflictingConstraints = errors.New("conflicting constraints")
+
+// reVersion matches the versions in a constraint string
+var reVersion = regexp.MustCompile(`v?\d+(\.\d+)?(\.\d+)?(-[0-9A-Za-z.-]+)?`) //nolint:gochecknoglobals
+
+// mergeConstraints returns the intersection of two version constraints.
+//
+// As the versions that satisfy both constraints can't be computed, they are considered
+// mutually exclusive if none of the versions at their bounds (and the ones immediately
+// above them) satisfies both constraints.
+func mergeConstraints(a string, b string) (string, error) {
+	if a == b || b == k6deps.ConstraintsAny {
+		return a, nil
+	}
+	if a == k6deps.ConstraintsAny {
+		return b, nil
+	}
+
+	merged := a + ", " + b
+	constraints, err := semver.NewConstraint(merged)
+	if err != nil {
+		return "", err
+	}
+
+	for _, bound := range reVersion.FindAllString(merged, -1) {
+		version, err := semver.NewVersion(bound)
+		if err != nil {
+			continue
+		}
+
+		candidates := []semver.Version{*version, version.IncPatch(), version.IncMinor(), version.IncMajor()}
+		for _, candidate := range candidates {
+			if constraints.Check(&candidate) {
+				return merged, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s and %s", errConflictingConstraints, a, b)
+}
+
+// pinned returns true if the dependencies, including k6, are constrained to exact versions,
+// so they always resolve to the same binary
+func pinned(deps k6deps.Dependencies) bool {
+	k6Constrains, bdeps, err := buildDeps(deps)
+	if err != nil || !exactVersion(k6Constrains) {
+		return false
+	}
+
+	for _, dep := range bdeps {
+		if !exactVersion(dep.Constraints) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// exactVersion returns true if the constraint is satisfied by only one version (e.g. "v0.50.0" or "=0.50.0")
+func exactVersion(constraint string) bool {
+	version := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(constraint, "=")), "v")
+	_, err := semver.StrictNewVersion(version)
+
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package k6provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestMergeConstraints(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		a         string
+		b         string
+		expect    string
+		expectErr error
+	}{
+		{
+			title:  "same constraints",
+			a:      ">=v0.4.0",
+			b:      ">=v0.4.0",
+			expect: ">=v0.4.0",
+		},
+		{
+			title:  "any version",
+			a:      "*",
+			b:      ">=v0.4.0",
+			expect: ">=v0.4.0",
+		},
+		{
+			title:  "overlapping ranges",
+			a:      ">=v0.4.0",
+			b:      "<v1.0.0",
+			expect: ">=v0.4.0, <v1.0.0",
+		},
+		{
+			title:  "exact version in range",
+			a:      ">v0.4.0",
+			b:      "v0.5.0",
+			expect: ">v0.4.0, v0.5.0",
+		},
+		{
+			title:  "narrow range",
+			a:      ">v1.0.0",
+			b:      "<v1.1.0",
+			expect: ">v1.0.0, <v1.1.0",
+		},
+		{
+			title:     "different exact versions",
+			a:         "v0.4.0",
+			b:         "v0.5.0",
+			expectErr: errConflictingConstraints,
+		},
+		{
+			title:     "disjoint ranges",
+			a:         "<v0.4.0",
+			b:         ">=v1.0.0",
+			expectErr: errConflictingConstraints,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			merged, err := mergeConstraints(tc.a, tc.b)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if merged != tc.expect {
+				t.Fatalf("expected %q got %q", tc.expect, merged)
+			}
+		})
+	}
+}
+
+func TestPinned(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		deps   map[string]string
+		expect bool
+	}{
+		{
+			title:  "exact versions",
+			deps:   map[string]string{"k6": "v0.50.0", "k6/x/sql": "v0.4.0"},
+			expect: true,
+		},
+		{
+			title:  "exact version with operator",
+			deps:   map[string]string{"k6": "=0.50.0"},
+			expect: true,
+		},
+		{
+			title:  "k6 not constrained",
+			deps:   map[string]string{"k6/x/sql": "v0.4.0"},
+			expect: false,
+		},
+		{
+			title:  "any version",
+			deps:   map[string]string{"k6": "v0.50.0", "k6/x/sql": "*"},
+			expect: false,
+		},
+		{
+			title:  "range",
+			deps:   map[string]string{"k6": ">v0.50.0"},
+			expect: false,
+		},
+		{
+			title:  "partial version",
+			deps:   map[string]string{"k6": "v0.50"},
+			expect: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			deps := k6deps.Dependencies{}
+			for name, constraints := range tc.deps {
+				dep, err := k6deps.NewDependency(name, constraints)
+				if err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+				deps[name] = dep
+			}
+
+			if got := pinned(deps); got != tc.expect {
+				t.Fatalf("expected %t got %t", tc.expect, got)
+			}
+		})
+	}
+}
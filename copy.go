@@ -0,0 +1,101 @@
+package k6provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/grafana/k6deps"
+)
+
+// CopyBinary obtains a binary that satisfies the dependencies, as [Provider.GetBinary] does,
+// and copies it to the destination path, for example "/usr/local/bin/k6".
+// The returned binary has the destination as its path.
+//
+// The binary is copied with the permissions of the cached binaries (see Config.FileMode), replacing
+// any existing file. The copy is atomic: the destination is never partially written, even if it is
+// in another file system than the cache. The destination directory must exist.
+func (p *Provider) CopyBinary(ctx context.Context, deps k6deps.Dependencies, destPath string) (K6Binary, error) {
+	binary, err := p.GetBinary(ctx, deps)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	destPath, err = filepath.Abs(destPath)
+	if err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	if info, err := os.Stat(destPath); err == nil && info.IsDir() {
+		return K6Binary{}, NewWrappedError(ErrBinary, fmt.Errorf("destination %s is a directory", destPath))
+	}
+
+	if err = copyFile(binary.Path, destPath, p.fileMode); err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	binary.Path = destPath
+
+	return binary, nil
+}
+
+// LinkBinary obtains a binary that satisfies the dependencies, as [Provider.GetBinary] does,
+// and updates a symbolic link at the given path to point to it, giving callers a stable path
+// for executing the binary of a set of dependencies, for example, "/path/to/current/k6".
+// The returned binary has the link as its path.
+//
+// The link is replaced atomically, so it always points to a complete binary. If symbolic links
+// are not supported (for example, on Windows without the required privileges), a hard link is
+// created instead and, if that is also not possible, the binary is copied. The link's directory
+// must exist.
+//
+// Note that a symbolic link breaks if the binary is removed from the cache, for example, when the
+// cache is pruned.
+func (p *Provider) LinkBinary(ctx context.Context, deps k6deps.Dependencies, linkPath string) (K6Binary, error) {
+	binary, err := p.GetBinary(ctx, deps)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	linkPath, err = filepath.Abs(linkPath)
+	if err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	if info, err := os.Lstat(linkPath); err == nil && info.IsDir() {
+		return K6Binary{}, NewWrappedError(ErrBinary, fmt.Errorf("link %s is a directory", linkPath))
+	}
+
+	if err = linkFile(binary.Path, linkPath, p.fileMode); err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	binary.Path = linkPath
+
+	return binary, nil
+}
+
+// linkFile creates a link to the target file, replacing any existing file at the link's path.
+// The link is created with a temporary name and then renamed, so it is replaced atomically.
+// Falls back to a hard link or a copy of the target if symbolic links are not supported.
+func linkFile(target string, linkPath string, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(linkPath), filepath.Base(linkPath)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+	// the link is created with the name of the temporary file
+	_ = os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	err = os.Symlink(target, tmp.Name())
+	if err != nil {
+		err = os.Link(target, tmp.Name())
+	}
+	if err != nil {
+		return copyFile(target, linkPath, mode)
+	}
+
+	return os.Rename(tmp.Name(), linkPath)
+}
@@ -0,0 +1,140 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestCopyBinary(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		dest      func(dir string) string
+		expectErr error
+	}{
+		{
+			title:     "new file",
+			dest:      func(dir string) string { return filepath.Join(dir, "k6") },
+			expectErr: nil,
+		},
+		{
+			title: "replace existing file",
+			dest: func(dir string) string {
+				dest := filepath.Join(dir, "k6")
+				_ = os.WriteFile(dest, []byte("old binary"), 0o600)
+				return dest
+			},
+			expectErr: nil,
+		},
+		{
+			title:     "destination is a directory",
+			dest:      func(dir string) string { return dir },
+			expectErr: ErrBinary,
+		},
+		{
+			title:     "destination directory doesn't exist",
+			dest:      func(dir string) string { return filepath.Join(dir, "missing", "k6") },
+			expectErr: ErrBinary,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+			dest := tc.dest(t.TempDir())
+
+			k6, err := provider.CopyBinary(context.TODO(), k6deps.Dependencies{}, dest)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if k6.Path != dest {
+				t.Fatalf("expected path %s got %s", dest, k6.Path)
+			}
+
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+
+			info, err := os.Stat(dest)
+			if err != nil {
+				t.Fatalf("stat binary %v", err)
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != defaultFileMode {
+				t.Fatalf("expected mode %v got %v", defaultFileMode, info.Mode().Perm())
+			}
+
+			// the cached binary is kept
+			if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact", k6Binary)); err != nil {
+				t.Fatalf("cached binary %v", err)
+			}
+		})
+	}
+}
+
+func TestLinkBinary(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	link := filepath.Join(t.TempDir(), "k6")
+
+	// an existing link is replaced
+	if err := os.WriteFile(link, []byte("old binary"), 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	for range 2 {
+		k6, err := provider.LinkBinary(context.TODO(), k6deps.Dependencies{}, link)
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if k6.Path != link {
+			t.Fatalf("expected path %s got %s", link, k6.Path)
+		}
+
+		got, err := os.ReadFile(link)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Fatalf("reading link %v", err)
+	}
+
+	expected := filepath.Join(provider.cacheDir(), "artifact", k6Binary)
+	if target != expected {
+		t.Fatalf("expected link to %s got %s", expected, target)
+	}
+}
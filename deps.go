@@ -0,0 +1,149 @@
+package k6provider
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/k6deps"
+)
+
+// ParseDeps parses dependencies in the format returned by [K6Binary.MarshalDeps], a list of
+// "name":"version" pairs separated by ";". Names and versions are Go string literals.
+//
+// For compatibility with the output of previous versions of [K6Binary.UnmarshalDeps], names can be
+// unquoted and the list can end with a separator (e.g. k6:"v0.50.0";k6/x/sql:"v0.4.0";).
+//
+// Returns an [ErrDependency] error if the input is malformed.
+func ParseDeps(s string) (map[string]string, error) {
+	deps, err := parseDeps(s)
+	if err != nil {
+		return nil, NewWrappedError(ErrDependency, err)
+	}
+	return deps, nil
+}
+
+// parseDeps implements ParseDeps
+func parseDeps(s string) (map[string]string, error) {
+	deps := map[string]string{}
+
+	for rest := s; rest != ""; {
+		name, tail, err := parseName(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		tail, found := strings.CutPrefix(tail, ":")
+		if !found {
+			return nil, fmt.Errorf("expected ':' after %q", name)
+		}
+
+		version, tail, err := unquotePrefix(tail)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version for %q: %w", name, err)
+		}
+
+		if _, duplicated := deps[name]; duplicated {
+			return nil, fmt.Errorf("duplicated dependency %q", name)
+		}
+		deps[name] = version
+
+		rest, found = strings.CutPrefix(tail, ";")
+		if !found && rest != "" {
+			return nil, fmt.Errorf("expected ';' after %q", name)
+		}
+	}
+
+	return deps, nil
+}
+
+// parseName returns the dependency name at the start of s and the rest of s.
+// Unquoted names end at the ':' separator.
+func parseName(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		name, rest, err := unquotePrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid name at %q: %w", s, err)
+		}
+		return name, rest, nil
+	}
+
+	idx := strings.Index(s, ":")
+	if idx <= 0 {
+		return "", "", fmt.Errorf("invalid name at %q", s)
+	}
+
+	return s[:idx], s[idx:], nil
+}
+
+// unquotePrefix returns the unquoted string literal at the start of s and the rest of s
+func unquotePrefix(s string) (string, string, error) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+
+	value, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", err
+	}
+
+	return value, s[len(quoted):], nil
+}
+
+// envDependencies is the environment variable that defines the dependencies for DependenciesFromEnv
+const envDependencies = "K6_DEPENDENCIES"
+
+// DependenciesFromEnv returns the dependencies defined in the K6_DEPENDENCIES environment variable,
+// as a list of name:version pairs separated by "," (e.g. "k6:v0.50.0,k6/x/kubernetes:v0.9.0").
+// The version can be an exact version, a version constraint (e.g. ">v0.9.0") or "latest".
+// If the version is omitted, any version is accepted.
+//
+// Returns empty dependencies if the variable is not defined, and an [ErrDependency] error
+// if it is malformed.
+func DependenciesFromEnv() (k6deps.Dependencies, error) {
+	return parseEnvDeps(os.Getenv(envDependencies))
+}
+
+// parseEnvDeps parses dependencies in the format of the K6_DEPENDENCIES environment variable
+func parseEnvDeps(value string) (k6deps.Dependencies, error) {
+	specs := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) != "" {
+			specs = append(specs, entry)
+		}
+	}
+
+	return parseSpecs(specs)
+}
+
+// parseSpecs parses dependencies given as name:version strings, as described in [DependenciesFromEnv]
+func parseSpecs(specs []string) (k6deps.Dependencies, error) {
+	deps := k6deps.Dependencies{}
+
+	for _, spec := range specs {
+		name, version, _ := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		version = strings.TrimSpace(version)
+		if name == "" {
+			return nil, NewWrappedError(ErrDependency, fmt.Errorf("%q: empty dependency name", spec))
+		}
+
+		if version == "latest" {
+			version = k6deps.ConstraintsAny
+		}
+
+		dep, err := k6deps.NewDependency(name, version)
+		if err != nil {
+			return nil, NewWrappedError(ErrDependency, fmt.Errorf("%q: %w", name, err))
+		}
+
+		if _, duplicated := deps[name]; duplicated {
+			return nil, NewWrappedError(ErrDependency, fmt.Errorf("duplicated dependency %q", name))
+		}
+		deps[name] = dep
+	}
+
+	return deps, nil
+}
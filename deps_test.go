@@ -0,0 +1,195 @@
+package k6provider
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestMarshalDeps(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		deps   map[string]string
+		expect string
+	}{
+		{
+			title:  "no dependencies",
+			deps:   map[string]string{},
+			expect: "",
+		},
+		{
+			title:  "sorted dependencies",
+			deps:   map[string]string{"k6/x/sql": "v0.4.0", "k6": "v0.50.0", "k6/x/kubernetes": "v0.9.0"},
+			expect: `"k6":"v0.50.0";"k6/x/kubernetes":"v0.9.0";"k6/x/sql":"v0.4.0"`,
+		},
+		{
+			title:  "special characters",
+			deps:   map[string]string{"k6/x/a;b": `v"1"`},
+			expect: `"k6/x/a;b":"v\"1\""`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			k6 := K6Binary{Dependencies: tc.deps}
+
+			marshaled := k6.MarshalDeps()
+			if marshaled != tc.expect {
+				t.Fatalf("expected %s got %s", tc.expect, marshaled)
+			}
+
+			// the output is stable
+			if k6.UnmarshalDeps() != marshaled {
+				t.Fatalf("output is not deterministic")
+			}
+
+			// round trip
+			parsed, err := ParseDeps(marshaled)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			if !maps.Equal(parsed, tc.deps) {
+				t.Fatalf("expected %v got %v", tc.deps, parsed)
+			}
+		})
+	}
+}
+
+func TestParseDeps(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		input     string
+		expect    map[string]string
+		expectErr error
+	}{
+		{
+			title:  "empty",
+			input:  "",
+			expect: map[string]string{},
+		},
+		{
+			title:  "quoted names",
+			input:  `"k6":"v0.50.0";"k6/x/sql":"v0.4.0"`,
+			expect: map[string]string{"k6": "v0.50.0", "k6/x/sql": "v0.4.0"},
+		},
+		{
+			title:  "legacy format",
+			input:  `k6:"v0.50.0";k6/x/sql:"v0.4.0";`,
+			expect: map[string]string{"k6": "v0.50.0", "k6/x/sql": "v0.4.0"},
+		},
+		{
+			title:  "escaped version",
+			input:  `"k6/x/sql":"v\"1\""`,
+			expect: map[string]string{"k6/x/sql": `v"1"`},
+		},
+		{
+			title:     "unquoted version",
+			input:     `"k6":v0.50.0`,
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "missing separator",
+			input:     `"k6":"v0.50.0" "k6/x/sql":"v0.4.0"`,
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "missing version",
+			input:     `"k6"`,
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "empty name",
+			input:     `:"v0.50.0"`,
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "duplicated dependency",
+			input:     `"k6":"v0.50.0";"k6":"v0.51.0"`,
+			expectErr: ErrDependency,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			deps, err := ParseDeps(tc.input)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err == nil && !maps.Equal(deps, tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, deps)
+			}
+		})
+	}
+}
+
+func TestDependenciesFromEnv(t *testing.T) { //nolint:paralleltest
+	testCases := []struct {
+		title     string
+		value     string
+		expect    map[string]string
+		expectErr error
+	}{
+		{
+			title:  "not defined",
+			value:  "",
+			expect: map[string]string{},
+		},
+		{
+			title:  "versions",
+			value:  "k6:v0.50.0, k6/x/kubernetes:v0.9.0,k6/x/sql:latest,k6/x/faker",
+			expect: map[string]string{"k6": "v0.50.0", "k6/x/kubernetes": "v0.9.0", "k6/x/sql": "*", "k6/x/faker": "*"},
+		},
+		{
+			title:  "constraints",
+			value:  "k6/x/kubernetes:>v0.9.0",
+			expect: map[string]string{"k6/x/kubernetes": ">v0.9.0"},
+		},
+		{
+			title:     "invalid version",
+			value:     "k6/x/kubernetes:not-a-version",
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "empty name",
+			value:     ":v0.9.0",
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "duplicated dependency",
+			value:     "k6:v0.50.0,k6:v0.51.0",
+			expectErr: ErrDependency,
+		},
+	}
+
+	for _, tc := range testCases { //nolint:paralleltest
+		t.Run(tc.title, func(t *testing.T) {
+			t.Setenv("K6_DEPENDENCIES", tc.value)
+
+			deps, err := DependenciesFromEnv()
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got := map[string]string{}
+			for name, dep := range deps {
+				got[name] = dep.GetConstraints().String()
+			}
+			if !maps.Equal(got, tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, got)
+			}
+		})
+	}
+}
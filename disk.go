@@ -0,0 +1,111 @@
+package k6provider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// errInsufficientSpace is returned when there's not enough disk space for storing a binary
+var errInsufficientSpace = errors.New("insufficient disk space")
+
+// checkDiskSpace verifies there's enough free space in the destination's file system
+// for storing a binary of the given size.
+// The check is best-effort: it is skipped if the size is unknown, the destination is not a file
+// or the free space cannot be determined.
+func checkDiskSpace(dest io.Writer, size int64) error {
+	file, ok := dest.(*os.File)
+	if !ok {
+		return nil
+	}
+
+	return checkFreeSpace(filepath.Dir(file.Name()), size)
+}
+
+// checkFreeSpace verifies there's enough free space in the file system of the given directory
+// for storing a binary of the given size. As checkDiskSpace, the check is best-effort.
+func checkFreeSpace(dir string, size int64) error {
+	if size < 0 {
+		return nil
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	if free < uint64(size) {
+		return fmt.Errorf("%w: need %d, have %d", errInsufficientSpace, size, free)
+	}
+
+	return nil
+}
+
+// checkWritable checks files can be created in the directory, creating it if it doesn't exist
+func checkWritable(dir string, mode os.FileMode) error {
+	err := os.MkdirAll(dir, mode)
+	if err == nil {
+		var probe *os.File
+		probe, err = os.CreateTemp(dir, ".probe-*")
+		if err == nil {
+			_ = probe.Close()
+			err = os.Remove(probe.Name())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cache directory not writable: %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// moveFile moves the file to the destination path, replacing any existing file.
+// If the file can't be renamed, for example, because the destination is in another
+// file system, it is copied instead.
+func moveFile(src string, dest string, mode os.FileMode) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dest, mode); err != nil {
+		return err
+	}
+
+	// the file was moved even if the source can't be removed
+	_ = os.Remove(src)
+
+	return nil
+}
+
+// copyFile copies the file to the destination path with the given permissions, replacing any
+// existing file. The file is copied to a temporary file in the destination's directory, which
+// is then renamed, so the destination is never partially written.
+func copyFile(src string, dest string, mode os.FileMode) error {
+	source, err := os.Open(src) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer source.Close() //nolint:errcheck
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	_, err = io.Copy(tmp, source)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
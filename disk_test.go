@@ -0,0 +1,97 @@
+package k6provider
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "binary"))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+
+	testCases := []struct {
+		title     string
+		dest      io.Writer
+		size      int64
+		expectErr error
+	}{
+		{
+			title:     "enough space",
+			dest:      file,
+			size:      1024,
+			expectErr: nil,
+		},
+		{
+			title:     "insufficient space",
+			dest:      file,
+			size:      math.MaxInt64,
+			expectErr: errInsufficientSpace,
+		},
+		{
+			title:     "unknown size",
+			dest:      file,
+			size:      -1,
+			expectErr: nil,
+		},
+		{
+			title:     "destination is not a file",
+			dest:      &bytes.Buffer{},
+			size:      math.MaxInt64,
+			expectErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkDiskSpace(tc.dest, tc.size)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+
+	if err := os.WriteFile(src, []byte("new"), 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+	if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	if err := moveFile(src, dest, 0o700); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("reading destination %v", err)
+	}
+	if string(got) != "new" {
+		t.Fatalf("expected %q got %q", "new", got)
+	}
+
+	if _, err = os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("source not removed %v", err)
+	}
+}
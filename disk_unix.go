@@ -0,0 +1,15 @@
+//go:build !windows
+
+package k6provider
+
+import "syscall"
+
+// freeSpace returns the space available to unprivileged users in the file system of the given path
+func freeSpace(path string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil //nolint:gosec
+}
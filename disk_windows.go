@@ -0,0 +1,18 @@
+package k6provider
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the space available to the calling user in the file system of the given path
+func freeSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &free, nil, nil); err != nil {
+		return 0, err
+	}
+
+	return free, nil
+}
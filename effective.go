@@ -0,0 +1,161 @@
+package k6provider
+
+import (
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// redacted replaces the credentials in the effective configuration
+const redacted = "REDACTED"
+
+// sensitiveHeaders are the headers whose values are redacted in the effective configuration.
+// Headers with a name containing any of the sensitiveHeaderWords are also redacted
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"} //nolint:gochecknoglobals
+
+// sensitiveHeaderWords are the words in the name of custom headers that usually have credentials,
+// such as "X-Api-Key" or "X-Auth-Token"
+var sensitiveHeaderWords = []string{"auth", "key", "token", "secret", "password", "session"} //nolint:gochecknoglobals
+
+// EffectiveConfig returns the configuration used by the provider, after applying the defaults and the
+// values taken from environment variables. For example, the BinDir (including the Namespace, if any),
+// the Platform or the URLs of the build services. It is useful for troubleshooting the configuration.
+//
+// The first build service is returned as BuildServiceURL and the others as BuildServiceURLs.
+// The DownloadProxyURL is empty if the standard proxy environment variables are used.
+// Credentials are redacted: the authorization tokens, the values of the headers that usually have
+// credentials (e.g. Authorization or X-Api-Key) and the passwords in the URLs.
+func (p *Provider) EffectiveConfig() Config {
+	config := p.config
+	config.BuildServiceURLs = slices.Clone(config.BuildServiceURLs)
+	config.BuildServiceHeaders = maps.Clone(config.BuildServiceHeaders)
+	config.DownloadHeaders = maps.Clone(config.DownloadHeaders)
+	config.BuildOpts = maps.Clone(config.BuildOpts)
+	config.ContextHeaders = maps.Clone(config.ContextHeaders)
+	config.AllowedExtensions = slices.Clone(config.AllowedExtensions)
+	config.DeniedExtensions = slices.Clone(config.DeniedExtensions)
+
+	return config
+}
+
+// effectiveConfig returns the configuration with the values resolved by the provider
+func effectiveConfig(config Config, p *Provider) Config {
+	// the proxy is only used by the default client
+	if config.HTTPClient == nil && config.DownloadProxyURL == "" {
+		config.DownloadProxyURL = os.Getenv("K6_DOWNLOAD_PROXY")
+	}
+
+	config.BinDir = p.binDir
+	config.Platform = p.platform
+	config.HTTPClient = p.client
+	config.Retry = p.retry
+	config.PruneInterval = p.pruner.pruneInterval
+	config.MaxBinarySize = p.maxBinarySize
+	config.Logger = p.logger
+	config.Metrics = p.metrics.Metrics
+	config.DirMode = p.dirMode
+	config.FileMode = p.fileMode
+	config.UserAgent = userAgent(config)
+	config.clock = nil
+
+	if config.BinaryName == "" {
+		config.BinaryName = k6Binary
+	}
+
+	if config.CacheCompression == "" {
+		config.CacheCompression = CompressionNone
+	}
+
+	if config.BuildService == nil {
+		urls := buildServiceURLs(config)
+		config.BuildServiceURL = urls[0]
+		config.BuildServiceURLs = urls[1:]
+
+		if config.BuildServiceAuth == "" {
+			config.BuildServiceAuth = os.Getenv("K6_BUILD_SERVICE_AUTH")
+		}
+		if config.BuildServiceAuthType == "" && config.BuildServiceAuth != "" {
+			config.BuildServiceAuthType = defaultAuthType
+		}
+	}
+
+	if config.DownloadAuth == "" {
+		config.DownloadAuth = os.Getenv("K6_DOWNLOAD_AUTH")
+	}
+	if config.DownloadAuthType == "" && config.DownloadAuth != "" {
+		config.DownloadAuthType = defaultAuthType
+	}
+
+	if config.BuildServiceAuth != "" {
+		config.BuildServiceAuth = redacted
+	}
+	if config.DownloadAuth != "" {
+		config.DownloadAuth = redacted
+	}
+
+	config.BuildServiceHeaders = redactHeaders(config.BuildServiceHeaders)
+	config.DownloadHeaders = redactHeaders(config.DownloadHeaders)
+	config.DownloadProxyURL = redactURL(config.DownloadProxyURL)
+	config.BuildServiceURL = redactURL(config.BuildServiceURL)
+	config.BuildServiceURLs = slices.Clone(config.BuildServiceURLs)
+	for i, u := range config.BuildServiceURLs {
+		config.BuildServiceURLs[i] = redactURL(u)
+	}
+
+	return config
+}
+
+// redactHeaders returns a copy of the headers with the values of the sensitive headers redacted
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	redactedHeaders := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if isSensitiveHeader(name) {
+			value = redacted
+		}
+		redactedHeaders[name] = value
+	}
+
+	return redactedHeaders
+}
+
+// isSensitiveHeader returns true if the header usually has credentials
+func isSensitiveHeader(name string) bool {
+	if slices.Contains(sensitiveHeaders, http.CanonicalHeaderKey(name)) {
+		return true
+	}
+
+	lower := strings.ToLower(name)
+	for _, word := range sensitiveHeaderWords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactURL returns the URL with the password of its user info redacted, if any.
+// URLs that can't be parsed are redacted completely, as the password can't be found.
+func redactURL(rawURL string) string {
+	if rawURL == "" {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	return u.String()
+}
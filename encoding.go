@@ -0,0 +1,32 @@
+package k6provider
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errUnsupportedEncoding is returned when the download response has an unknown Content-Encoding
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decodeBody returns a reader that decodes the body of a response with the given Content-Encoding.
+// Supports gzip and deflate encodings. Bodies without encoding are returned as is.
+//
+// Note: http.Client already decodes gzip responses when it requests the compression,
+// in this case, the response does not have the Content-Encoding header.
+func decodeBody(body io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// the deflate content encoding uses the zlib format (RFC 9110)
+		return zlib.NewReader(body)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+}
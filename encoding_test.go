@@ -0,0 +1,116 @@
+package k6provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestContentEncoding(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	gzipped := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipped)
+	_, _ = gw.Write(content)
+	_ = gw.Close()
+
+	deflated := &bytes.Buffer{}
+	zw := zlib.NewWriter(deflated)
+	_, _ = zw.Write(content)
+	_ = zw.Close()
+
+	testCases := []struct {
+		title     string
+		encoding  string
+		body      []byte
+		expectErr error
+	}{
+		{
+			title: "no encoding",
+			body:  content,
+		},
+		{
+			title:    "gzip",
+			encoding: "gzip",
+			body:     gzipped.Bytes(),
+		},
+		{
+			title:    "deflate",
+			encoding: "deflate",
+			body:     deflated.Bytes(),
+		},
+		{
+			title:     "unsupported encoding",
+			encoding:  "br",
+			body:      content,
+			expectErr: ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			totals := []int64{}
+			config := Config{ProgressFunc: func(_ int64, total int64) { totals = append(totals, total) }}
+			provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tc.encoding != "" {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				_, _ = w.Write(tc.body)
+			})
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+
+			// the size of encoded responses is reported as unknown
+			for _, total := range totals {
+				if tc.encoding != "" && total != -1 {
+					t.Fatalf("expected unknown total got %d", total)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	t.Parallel()
+
+	// invalid gzip content
+	if _, err := decodeBody(bytes.NewReader([]byte("not gzip")), "gzip"); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	body, err := decodeBody(bytes.NewReader([]byte("k6")), "identity")
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if got, _ := io.ReadAll(body); string(got) != "k6" {
+		t.Fatalf("expected %q got %q", "k6", got)
+	}
+}
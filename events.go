@@ -0,0 +1,79 @@
+package k6provider
+
+import (
+	"errors"
+	"time"
+)
+
+// EventKind identifies the activity of the provider reported by an [Event]
+type EventKind string
+
+const (
+	// EventCacheHit reports a binary was found in the cache
+	EventCacheHit EventKind = "cache_hit"
+	// EventBuildStarted reports a build was requested to the build service
+	EventBuildStarted EventKind = "build_started"
+	// EventBuildCompleted reports the build service returned the artifact or failed (see Event.Err)
+	EventBuildCompleted EventKind = "build_completed"
+	// EventDownloadStarted reports the download of a binary started
+	EventDownloadStarted EventKind = "download_started"
+	// EventDownloadProgress reports the bytes of the binary downloaded so far
+	EventDownloadProgress EventKind = "download_progress"
+	// EventDownloadCompleted reports the download of a binary completed or failed (see Event.Err)
+	EventDownloadCompleted EventKind = "download_completed"
+	// EventEvicted reports a binary was removed from the cache for freeing space
+	EventEvicted EventKind = "evicted"
+)
+
+// Event describes the activity of the provider, for example, for driving a UI
+type Event struct {
+	// Kind of activity
+	Kind EventKind
+	// ArtifactID of the binary. Empty for EventBuildStarted, as the artifact is not known yet
+	ArtifactID string
+	// Bytes downloaded so far for EventDownloadProgress, downloaded for EventDownloadCompleted
+	// and freed for EventEvicted
+	Bytes int64
+	// Total size of the binary for EventDownloadProgress (-1 if unknown)
+	Total int64
+	// Duration of the build or download for EventBuildCompleted and EventDownloadCompleted
+	Duration time.Duration
+	// Err is the reason of a failed build or download
+	Err error
+}
+
+// EventFunc receives the events of the provider. It is called synchronously, so it should not block,
+// and it can be called concurrently if many binaries are obtained at the same time.
+type EventFunc func(event Event)
+
+// emit reports the event, if an EventFunc is configured
+func (p *Provider) emit(event Event) {
+	if p.events != nil {
+		p.events(event)
+	}
+}
+
+// downloadCompleted reports the download of the artifact completed, or failed with the given error.
+// A cached binary that was not modified is not a failure.
+func (p *Provider) downloadCompleted(artifactID string, size int64, duration time.Duration, err error) {
+	if errors.Is(err, errNotModified) {
+		err = nil
+	}
+
+	p.emit(Event{Kind: EventDownloadCompleted, ArtifactID: artifactID, Bytes: size, Duration: duration, Err: err})
+}
+
+// progressFunc returns the function for reporting the progress of the download of the artifact,
+// to the ProgressFunc and the EventFunc. Returns nil if none is configured.
+func (p *Provider) progressFunc(artifactID string) ProgressFunc {
+	if p.events == nil {
+		return p.progress
+	}
+
+	return func(downloaded int64, total int64) {
+		if p.progress != nil {
+			p.progress(downloaded, total)
+		}
+		p.events(Event{Kind: EventDownloadProgress, ArtifactID: artifactID, Bytes: downloaded, Total: total})
+	}
+}
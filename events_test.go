@@ -0,0 +1,128 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+// eventRecorder records the events received
+type eventRecorder struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(event Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+// kinds returns the kinds of the events received, omitting the progress events
+func (r *eventRecorder) kinds() []EventKind {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	kinds := []EventKind{}
+	for _, event := range r.events {
+		if event.Kind != EventDownloadProgress {
+			kinds = append(kinds, event.Kind)
+		}
+	}
+
+	return kinds
+}
+
+// find returns the last event of the given kind
+func (r *eventRecorder) find(kind EventKind) (Event, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].Kind == kind {
+			return r.events[i], true
+		}
+	}
+
+	return Event{}, false
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	recorder := &eventRecorder{}
+	provider, _ := newTestProvider(t, Config{EventFunc: recorder.record}, content, sha256sum(content))
+
+	// the second time, the binary is found in the cache
+	for range 2 {
+		if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	}
+
+	if _, err := provider.PruneCache(context.TODO(), 0); err != nil {
+		t.Fatalf("pruning cache %v", err)
+	}
+
+	expected := []EventKind{
+		EventBuildStarted,
+		EventBuildCompleted,
+		EventDownloadStarted,
+		EventDownloadCompleted,
+		EventBuildStarted,
+		EventBuildCompleted,
+		EventCacheHit,
+		EventEvicted,
+	}
+	if kinds := recorder.kinds(); !slices.Equal(kinds, expected) {
+		t.Fatalf("expected %v got %v", expected, kinds)
+	}
+
+	progress, found := recorder.find(EventDownloadProgress)
+	if !found || progress.ArtifactID != "artifact" || progress.Bytes != int64(len(content)) ||
+		progress.Total != int64(len(content)) {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+
+	downloaded, _ := recorder.find(EventDownloadCompleted)
+	if downloaded.ArtifactID != "artifact" || downloaded.Bytes != int64(len(content)) || downloaded.Err != nil {
+		t.Fatalf("unexpected download %+v", downloaded)
+	}
+
+	built, _ := recorder.find(EventBuildCompleted)
+	if built.ArtifactID != "artifact" || built.Err != nil {
+		t.Fatalf("unexpected build %+v", built)
+	}
+
+	evicted, _ := recorder.find(EventEvicted)
+	if evicted.ArtifactID != "artifact" || evicted.Bytes < int64(len(content)) {
+		t.Fatalf("unexpected eviction %+v", evicted)
+	}
+}
+
+func TestEventsBuildFailed(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	recorder := &eventRecorder{}
+	provider, _ := newTestProvider(t, Config{EventFunc: recorder.record}, content, sha256sum(content))
+
+	buildErr := errors.New("build failed")
+	buildSrv, _ := provider.buildSrv.(*testBuildService)
+	buildSrv.err = buildErr
+
+	if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	built, found := recorder.find(EventBuildCompleted)
+	if !found || !errors.Is(built.Err, buildErr) {
+		t.Fatalf("expected build to fail with %v got %+v", buildErr, built)
+	}
+}
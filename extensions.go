@@ -0,0 +1,79 @@
+package k6provider
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+)
+
+// validatePatterns checks the extension patterns are valid glob patterns
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid extension pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// matchAny returns true if the extension matches any of the patterns
+func matchAny(patterns []string, extension string) bool {
+	for _, pattern := range patterns {
+		// patterns are validated when the provider is created
+		if matched, _ := path.Match(pattern, extension); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkedDeps returns the dependencies for the build as buildDeps does, also checking the extensions
+// are allowed by the AllowedExtensions and DeniedExtensions. Returns an ErrDependency error reporting
+// all the invalid and not allowed dependencies.
+func (p *Provider) checkedDeps(deps k6deps.Dependencies) (string, []k6build.Dependency, error) {
+	k6Constrains, bdeps, errs := mergeDeps(deps)
+
+	// invalid dependencies are not merged, but they are also checked
+	for _, name := range extensionNames(deps) {
+		if matchAny(p.deniedExts, name) {
+			errs = append(errs, fmt.Errorf("%q: extension is denied", name))
+			continue
+		}
+
+		if len(p.allowedExts) > 0 && !matchAny(p.allowedExts, name) {
+			errs = append(errs, fmt.Errorf("%q: extension is not allowed", name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return "", nil, NewWrappedError(ErrDependency, errors.Join(errs...))
+	}
+
+	return k6Constrains, bdeps, nil
+}
+
+// extensionNames returns the sorted names of the extensions in the dependencies
+func extensionNames(deps k6deps.Dependencies) []string {
+	names := []string{}
+	for _, dep := range deps {
+		if dep == nil {
+			continue
+		}
+
+		name := strings.TrimSpace(dep.Name)
+		if name != "" && name != k6Module {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names)
+}
@@ -0,0 +1,144 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestExtensionPolicy(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		allowed   []string
+		denied    []string
+		deps      []string
+		expectErr error
+		expectMsg string
+	}{
+		{
+			title: "no policy",
+			deps:  []string{"k6/x/sql", "github.com/grafana/xk6-faker"},
+		},
+		{
+			title:   "allowed by pattern",
+			allowed: []string{"k6/x/*"},
+			deps:    []string{"k6/x/sql", "k6/x/kafka"},
+		},
+		{
+			title:     "not allowed",
+			allowed:   []string{"k6/x/*"},
+			deps:      []string{"k6/x/sql", "github.com/grafana/xk6-faker"},
+			expectErr: ErrDependency,
+			expectMsg: "github.com/grafana/xk6-faker",
+		},
+		{
+			title:     "denied",
+			denied:    []string{"k6/x/kafka"},
+			deps:      []string{"k6/x/sql", "k6/x/kafka"},
+			expectErr: ErrDependency,
+			expectMsg: "k6/x/kafka",
+		},
+		{
+			title:     "allowed and denied",
+			allowed:   []string{"k6/x/*"},
+			denied:    []string{"k6/x/kafka"},
+			deps:      []string{"k6/x/kafka"},
+			expectErr: ErrDependency,
+			expectMsg: "k6/x/kafka",
+		},
+		{
+			title:   "only k6",
+			allowed: []string{"k6/x/sql"},
+			deps:    []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := Config{AllowedExtensions: tc.allowed, DeniedExtensions: tc.denied}
+			provider, _ := newTestProvider(t, config, content, sha256sum(content))
+
+			deps := k6deps.Dependencies{}
+			for _, name := range tc.deps {
+				dep, err := k6deps.NewDependency(name, "*")
+				if err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+				deps[name] = dep
+			}
+
+			_, err := provider.GetBinary(context.TODO(), deps)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), tc.expectMsg) {
+				t.Fatalf("expected error to mention %s got %v", tc.expectMsg, err)
+			}
+		})
+	}
+}
+
+func TestInvalidExtensionPattern(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewProvider(
+		WithBuildServiceURL("http://localhost"),
+		WithBinDir(t.TempDir()),
+		WithDeniedExtensions("k6/x/[sql"),
+	)
+	if !errors.Is(err, ErrConfig) {
+		t.Fatalf("expected %v got %v", ErrConfig, err)
+	}
+}
+
+func TestDependencyErrorsReportedTogether(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	config := Config{DeniedExtensions: []string{"k6/x/kafka"}}
+	provider, _ := newTestProvider(t, config, content, sha256sum(content))
+
+	kafka, err := k6deps.NewDependency("k6/x/kafka", "*")
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+	empty, err := k6deps.NewDependency("", "*")
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	deps := k6deps.Dependencies{
+		"k6/x/kafka": kafka,
+		"k6/x/sql":   empty,
+		"k6/x/faker": nil,
+	}
+
+	_, err = provider.GetBinary(context.TODO(), deps)
+	if !errors.Is(err, ErrDependency) {
+		t.Fatalf("expected %v got %v", ErrDependency, err)
+	}
+
+	joined, ok := errors.Unwrap(err).(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("expected joined errors got %v", err)
+	}
+	if problems := joined.Unwrap(); len(problems) != 3 {
+		t.Fatalf("expected 3 problems got %v", problems)
+	}
+
+	for _, name := range []string{"k6/x/kafka", "k6/x/sql", "k6/x/faker"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected error to mention %s got %v", name, err)
+		}
+	}
+}
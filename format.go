@@ -0,0 +1,115 @@
+package k6provider
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// errInvalidFormat is returned when a binary is not an executable for the expected platform
+var errInvalidFormat = errors.New("invalid executable format")
+
+// checkFormat checks the binary in the given path is an executable for the platform (in the os/arch form)
+// by inspecting its headers: ELF for linux, Mach-O for darwin and PE for windows.
+func checkFormat(path string, platform string) error {
+	goos, goarch, _ := strings.Cut(platform, "/")
+
+	var (
+		archs []string
+		err   error
+	)
+
+	switch goos {
+	case "linux":
+		archs, err = elfArchs(path)
+	case "darwin":
+		archs, err = machoArchs(path)
+	case "windows":
+		archs, err = peArchs(path)
+	default:
+		return fmt.Errorf("%w: unsupported platform %s", errInvalidFormat, platform)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: not a %s executable: %w", errInvalidFormat, goos, err)
+	}
+
+	if !slices.Contains(archs, goarch) {
+		return fmt.Errorf("%w: expected %s executable got %s", errInvalidFormat, goarch, strings.Join(archs, ", "))
+	}
+
+	return nil
+}
+
+// elfArchs returns the architecture of an ELF executable
+func elfArchs(path string) ([]string, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	switch file.Machine { //nolint:exhaustive
+	case elf.EM_X86_64:
+		return []string{"amd64"}, nil
+	case elf.EM_AARCH64:
+		return []string{"arm64"}, nil
+	default:
+		return []string{file.Machine.String()}, nil
+	}
+}
+
+// machoArchs returns the architectures of a Mach-O executable.
+// Universal binaries can have more than one architecture.
+func machoArchs(path string) ([]string, error) {
+	if fat, err := macho.OpenFat(path); err == nil {
+		defer fat.Close() //nolint:errcheck
+
+		archs := []string{}
+		for _, arch := range fat.Arches {
+			archs = append(archs, machoCPU(arch.Cpu))
+		}
+		return archs, nil
+	}
+
+	file, err := macho.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	return []string{machoCPU(file.Cpu)}, nil
+}
+
+// machoCPU returns the architecture of a Mach-O cpu type
+func machoCPU(cpu macho.Cpu) string {
+	switch cpu { //nolint:exhaustive
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	default:
+		return cpu.String()
+	}
+}
+
+// peArchs returns the architecture of a PE executable
+func peArchs(path string) ([]string, error) {
+	file, err := pe.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	switch file.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return []string{"amd64"}, nil
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return []string{"arm64"}, nil
+	default:
+		return []string{fmt.Sprintf("machine 0x%x", file.Machine)}, nil
+	}
+}
@@ -0,0 +1,104 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestCheckFormat(t *testing.T) {
+	t.Parallel()
+
+	// the test binary is a valid executable for the host platform
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	html := filepath.Join(t.TempDir(), "k6")
+	if err = os.WriteFile(html, []byte("<html><body>error</body></html>"), 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	otherArch := runtime.GOOS + "/arm64"
+	if runtime.GOARCH == "arm64" {
+		otherArch = runtime.GOOS + "/amd64"
+	}
+	otherOS := "windows/" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		otherOS = "linux/" + runtime.GOARCH
+	}
+
+	testCases := []struct {
+		title     string
+		path      string
+		platform  string
+		expectErr error
+	}{
+		{
+			title:    "valid executable",
+			path:     executable,
+			platform: host,
+		},
+		{
+			title:     "html page",
+			path:      html,
+			platform:  host,
+			expectErr: errInvalidFormat,
+		},
+		{
+			title:     "other architecture",
+			path:      executable,
+			platform:  otherArch,
+			expectErr: errInvalidFormat,
+		},
+		{
+			title:     "other os",
+			path:      executable,
+			platform:  otherOS,
+			expectErr: errInvalidFormat,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkFormat(tc.path, tc.platform)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyFormat(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("<html><body>error</body></html>")
+
+	for _, noCache := range []bool{false, true} {
+		storageDir := t.TempDir()
+		config := Config{VerifyFormat: true, Storage: NewFileStorage(storageDir), NoCache: noCache}
+		provider, _ := newTestProvider(t, config, content, sha256sum(content))
+
+		_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if !errors.Is(err, ErrDownload) || !errors.Is(err, errInvalidFormat) {
+			t.Fatalf("expected %v got %v", errInvalidFormat, err)
+		}
+
+		if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact")); !os.IsNotExist(err) {
+			t.Fatalf("invalid binary left in cache %v", err)
+		}
+
+		if _, err = os.Stat(filepath.Join(storageDir, "artifact")); !os.IsNotExist(err) {
+			t.Fatalf("invalid binary uploaded to storage %v", err)
+		}
+	}
+}
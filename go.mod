@@ -3,16 +3,21 @@ module github.com/grafana/k6provider
 go 1.22.4
 
 require (
+	github.com/Masterminds/semver/v3 v3.3.1
 	github.com/grafana/k6build v0.5.0
+	github.com/grafana/k6catalog v0.2.4
 	github.com/grafana/k6deps v0.1.8
+	go.opentelemetry.io/otel v1.31.0
+	go.opentelemetry.io/otel/trace v1.31.0
+	golang.org/x/crypto v0.24.0
+	golang.org/x/sync v0.10.0
+	golang.org/x/sys v0.27.0
+	golang.org/x/time v0.8.0
 )
 
 require (
-	github.com/Masterminds/semver/v3 v3.3.1 // indirect
 	github.com/evanw/esbuild v0.24.0 // indirect
-	github.com/grafana/k6catalog v0.2.4 // indirect
 	github.com/grafana/k6foundry v0.3.0 // indirect
 	github.com/grafana/k6pack v0.2.3 // indirect
 	golang.org/x/mod v0.21.0 // indirect
-	golang.org/x/sys v0.27.0 // indirect
 )
@@ -0,0 +1,90 @@
+package k6provider
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// localPath returns the path of the file referenced by a file:// URL (e.g. "file:///mnt/binaries/k6").
+// Returns false if the URL is not a file URL for a file in the local host.
+func localPath(from string) (string, bool) {
+	parsed, err := url.Parse(from)
+	if err != nil || parsed.Scheme != "file" || parsed.Path == "" {
+		return "", false
+	}
+
+	if parsed.Host != "" && parsed.Host != "localhost" {
+		return "", false
+	}
+
+	path := parsed.Path
+	// windows paths have a leading slash before the drive letter (e.g. file:///C:/k6)
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+
+	return filepath.FromSlash(path), true
+}
+
+// copyLocal copies the binary from a local file into dest, verifying its checksum as download does.
+// The modification time of the file is used as validator, so a refresh copies the file only if it
+// was modified.
+func (p *Provider) copyLocal(
+	path string,
+	checksum string,
+	cached validators,
+	progress ProgressFunc,
+	dest io.Writer,
+) (int64, validators, error) {
+	source, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return 0, validators{}, err
+	}
+	defer source.Close() //nolint:errcheck
+
+	info, err := source.Stat()
+	if err != nil {
+		return 0, validators{}, err
+	}
+	if info.IsDir() {
+		return 0, validators{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	current := validators{lastModified: info.ModTime().UTC().Format(http.TimeFormat)}
+	if cached.lastModified != "" && cached.lastModified == current.lastModified {
+		return 0, current, errNotModified
+	}
+
+	if p.maxBinarySize > 0 && info.Size() > p.maxBinarySize {
+		return 0, current, fmt.Errorf("%w of %d bytes: binary has %d bytes", errBinaryTooLarge, p.maxBinarySize, info.Size())
+	}
+
+	// a partial download can't be resumed from a local file
+	if file, ok := dest.(*os.File); ok {
+		if err = resetFile(file); err != nil {
+			return 0, current, err
+		}
+	}
+
+	if err = checkDiskSpace(dest, info.Size()); err != nil {
+		return 0, current, err
+	}
+
+	digest, err := p.newDigest(checksum)
+	if err != nil {
+		return 0, current, err
+	}
+
+	var content io.Reader = source
+	if progress != nil {
+		content = &progressReader{reader: source, total: info.Size(), progress: progress}
+	}
+
+	size, err := p.copyChecked(dest, content, digest, checksum)
+
+	return size, current, err
+}
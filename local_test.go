@@ -0,0 +1,112 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+)
+
+func TestLocalArtifactURL(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	binPath := filepath.Join(t.TempDir(), "k6")
+	if err := os.WriteFile(binPath, content, 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+	fileURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(binPath)}).String()
+
+	testCases := []struct {
+		title     string
+		url       string
+		checksum  string
+		expectErr error
+	}{
+		{
+			title:    "local file",
+			url:      fileURL,
+			checksum: sha256sum(content),
+		},
+		{
+			title:     "checksum mismatch",
+			url:       fileURL,
+			checksum:  sha256sum([]byte("other binary")),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "missing file",
+			url:       fileURL + ".missing",
+			checksum:  sha256sum(content),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "remote host",
+			url:       "file://remote/k6",
+			checksum:  sha256sum(content),
+			expectErr: ErrBuild,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, content, tc.checksum)
+			provider.buildSrv = &testBuildService{
+				artifact: k6build.Artifact{ID: "artifact", URL: tc.url, Checksum: tc.checksum},
+			}
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+		})
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		url         string
+		expect      string
+		expectLocal bool
+	}{
+		{url: "file:///mnt/binaries/k6", expect: filepath.FromSlash("/mnt/binaries/k6"), expectLocal: true},
+		{url: "file://localhost/mnt/binaries/k6", expect: filepath.FromSlash("/mnt/binaries/k6"), expectLocal: true},
+		{url: "file:///C:/binaries/k6.exe", expect: filepath.FromSlash("C:/binaries/k6.exe"), expectLocal: true},
+		{url: "file://remote/mnt/binaries/k6"},
+		{url: "https://example.com/k6"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			t.Parallel()
+
+			path, isLocal := localPath(tc.url)
+			if isLocal != tc.expectLocal || path != tc.expect {
+				t.Fatalf("expected %q (%t) got %q (%t)", tc.expect, tc.expectLocal, path, isLocal)
+			}
+		})
+	}
+}
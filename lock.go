@@ -1,13 +1,19 @@
 package k6provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
-	"syscall"
+	"time"
 )
 
+// lockPollInterval is the time between attempts to acquire a lock held by another process
+const lockPollInterval = 50 * time.Millisecond
+
 var (
 	// errLocked is returned when the file is already locked
 	errLocked = errors.New("file already locked")
@@ -17,20 +23,32 @@ var (
 	errUnLockFailed = errors.New("failed to lock file")
 )
 
-// A dirLock prevents concurrent access to a directory.
-// Only works on unix-like systems. Windows is not supported.
+// A dirLock prevents concurrent access to a directory, from this or other processes.
+// It uses advisory locks on a lock file: flock on unix-like systems and LockFileEx on Windows.
 // This code is inspired on the golang's filelock package:
 // https://pkg.go.dev/cmd/go/internal/lockedfile/internal/filelock
 type dirLock struct {
 	mutex    sync.Mutex
 	lockFile string
-	fd       int
+	file     *os.File
 }
 
 func newFileLock(path string) *dirLock {
+	return newLock(filepath.Join(path, "k6provider.lock"))
+}
+
+// newArtifactLock returns a lock for an artifact in the cache directory.
+// The lock file is kept outside the artifact's directory because this directory
+// can be removed while the lock is held. The lock file is removed when the lock
+// is released, see [dirLock.release].
+func newArtifactLock(dir string, id string) *dirLock {
+	return newLock(filepath.Join(dir, id+".lock"))
+}
+
+// newLock returns a lock using the given lock file
+func newLock(lockFile string) *dirLock {
 	return &dirLock{
-		lockFile: filepath.Join(path, "k6provider.lock"),
-		fd:       -1,
+		lockFile: lockFile,
 	}
 }
 
@@ -43,25 +61,70 @@ func (m *dirLock) lock() error {
 	defer m.mutex.Unlock()
 
 	// file open, assume already locked
-	if m.fd != -1 {
+	if m.file != nil {
 		return nil
 	}
 
-	fd, err := syscall.Open(m.lockFile, syscall.O_RDWR|syscall.O_CREAT, 0o600)
-	if err != nil {
-		return fmt.Errorf("%w %w", errLockFailed, err)
-	}
-	err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
-	if err == nil {
-		m.fd = fd
+	for {
+		file, err := os.OpenFile(m.lockFile, os.O_RDWR|os.O_CREATE, 0o600) //nolint:gosec
+		if err != nil {
+			return fmt.Errorf("%w %w", errLockFailed, err)
+		}
+
+		err = lockFile(file)
+		if err != nil {
+			_ = file.Close()
+			if errors.Is(err, errLocked) {
+				return errLocked
+			}
+			return fmt.Errorf("%w %w", errLockFailed, err)
+		}
+
+		// the lock file was removed by its previous owner after being opened.
+		// The lock must be placed on the file that replaces it, if any
+		if !isLockFile(file, m.lockFile) {
+			_ = unlockFile(file)
+			_ = file.Close()
+			continue
+		}
+
+		m.file = file
 		return nil
 	}
+}
 
-	if errors.Is(err, syscall.EWOULDBLOCK) {
-		return errLocked
+// isLockFile returns if the open file is the one currently in the lock file's path
+func isLockFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
 	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// lockWait places an advisory write lock on the directory's lock file.
+// If the directory is blocked, waits until the lock is released or the context is done.
+// Locks on the same file are exclusive even within the same process.
+func (m *dirLock) lockWait(ctx context.Context) error {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
 
-	return fmt.Errorf("%w %w", errLockFailed, err)
+	for {
+		err := m.lock()
+		if !errors.Is(err, errLocked) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
 
 func (m *dirLock) unlock() error {
@@ -69,18 +132,38 @@ func (m *dirLock) unlock() error {
 	defer m.mutex.Unlock()
 
 	// if file is not open, assume already unlocked
-	if m.fd == -1 {
+	if m.file == nil {
 		return nil
 	}
 
 	defer func() {
-		_ = syscall.Close(m.fd)
-		m.fd = -1
+		_ = m.file.Close()
+		m.file = nil
 	}()
 
-	err := syscall.Flock(m.fd, syscall.LOCK_UN)
+	err := unlockFile(m.file)
 	if err != nil {
 		return fmt.Errorf("%w %w", errUnLockFailed, err)
 	}
 	return nil
 }
+
+// release removes the lock file and unlocks it, so no lock files are left behind.
+// The file is removed while the lock is held, so other owners waiting for the lock
+// detect it and lock a new file. On Windows, an open file can't be removed, so it is
+// removed once closed, which fails if another owner has opened it in the meantime.
+func (m *dirLock) release() error {
+	m.mutex.Lock()
+	held := m.file != nil
+	if held && runtime.GOOS != "windows" {
+		_ = os.Remove(m.lockFile)
+	}
+	m.mutex.Unlock()
+
+	err := m.unlock()
+	if held && runtime.GOOS == "windows" {
+		_ = os.Remove(m.lockFile)
+	}
+
+	return err
+}
@@ -1,8 +1,12 @@
 package k6provider
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLock(t *testing.T) {
@@ -58,3 +62,80 @@ func TestLock(t *testing.T) {
 		t.Fatalf("unexpected %v", err)
 	}
 }
+
+func TestLockWait(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l := newFileLock(dir)
+	if err := l.lock(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// waiting for a lock held by another owner is cancelled with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := newFileLock(dir).lockWait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+
+	// the lock is acquired when released by its owner
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = l.unlock()
+	}()
+
+	waiter := newFileLock(dir)
+	if err := waiter.lockWait(context.Background()); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if err := waiter.unlock(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+}
+
+func TestLockRelease(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	l := newArtifactLock(dir, "artifact")
+	if err := l.lock(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// a waiter holding the lock file open when it is released must lock the new file
+	stale, err := os.Open(filepath.Join(dir, "artifact.lock"))
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	defer stale.Close() //nolint:errcheck
+
+	if err = l.release(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "artifact.lock")); !os.IsNotExist(err) {
+		t.Fatalf("expected lock file removed got %v", err)
+	}
+
+	if isLockFile(stale, filepath.Join(dir, "artifact.lock")) {
+		t.Fatalf("expected removed lock file not to be valid")
+	}
+
+	waiter := newArtifactLock(dir, "artifact")
+	if err = waiter.lock(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if err = newArtifactLock(dir, "artifact").lock(); !errors.Is(err, errLocked) {
+		t.Fatalf("expected %v got %v", errLocked, err)
+	}
+
+	if err = waiter.release(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package k6provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6deps"
+)
+
+// GetBinaryFromLock returns a custom k6 binary with the exact versions of the dependencies
+// recorded in the given lock file. Lock files are JSON objects that map the name of each
+// dependency to its version (e.g. {"k6": "v0.50.0", "k6/x/kubernetes": "v0.9.0"}) and can
+// be written using [K6Binary.WriteLock].
+//
+// If the lock file can't be read or has invalid versions, an [ErrDependency] error is returned.
+// Otherwise, it behaves as [Provider.GetBinary].
+func (p *Provider) GetBinaryFromLock(ctx context.Context, lockPath string) (K6Binary, error) {
+	deps, err := ReadLock(lockPath)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	return p.GetBinary(ctx, deps)
+}
+
+// ReadLock returns the dependencies recorded in a lock file, constrained to their exact versions
+func ReadLock(lockPath string) (k6deps.Dependencies, error) {
+	data, err := os.ReadFile(lockPath) //nolint:gosec
+	if err != nil {
+		return nil, NewWrappedError(ErrDependency, fmt.Errorf("reading lock file: %w", err))
+	}
+
+	versions := map[string]string{}
+	if err = json.Unmarshal(data, &versions); err != nil {
+		return nil, NewWrappedError(ErrDependency, fmt.Errorf("parsing lock file: %w", err))
+	}
+
+	deps := k6deps.Dependencies{}
+	for name, version := range versions {
+		if _, err = semver.StrictNewVersion(trimVersionPrefix(version)); err != nil {
+			return nil, NewWrappedError(ErrDependency, fmt.Errorf("%q: invalid version %q: %w", name, version, err))
+		}
+
+		dep, err := k6deps.NewDependency(name, "="+version)
+		if err != nil {
+			return nil, NewWrappedError(ErrDependency, fmt.Errorf("%q: %w", name, err))
+		}
+		deps[name] = dep
+	}
+
+	return deps, nil
+}
+
+// WriteLock writes the dependencies of the binary to a lock file, which can be used
+// for obtaining the same binary with [Provider.GetBinaryFromLock]
+func (b K6Binary) WriteLock(lockPath string) error {
+	data, err := json.MarshalIndent(b.Dependencies, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// lock files are meant to be shared (e.g. committed with the tests)
+	return os.WriteFile(lockPath, append(data, '\n'), 0o644) //nolint:gosec
+}
+
+// trimVersionPrefix removes the optional "v" prefix of a version
+func trimVersionPrefix(version string) string {
+	if len(version) > 0 && version[0] == 'v' {
+		return version[1:]
+	}
+	return version
+}
@@ -0,0 +1,102 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestReadLock(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		content   string
+		expect    map[string]string
+		expectErr error
+	}{
+		{
+			title:   "exact versions",
+			content: `{"k6": "v0.50.0", "k6/x/sql": "v0.4.0"}`,
+			expect:  map[string]string{"k6": "=v0.50.0", "k6/x/sql": "=v0.4.0"},
+		},
+		{
+			title:     "version range",
+			content:   `{"k6/x/sql": ">v0.4.0"}`,
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "invalid json",
+			content:   `k6/x/sql: v0.4.0`,
+			expectErr: ErrDependency,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			lockPath := filepath.Join(t.TempDir(), "k6.lock")
+			if err := os.WriteFile(lockPath, []byte(tc.content), 0o600); err != nil {
+				t.Fatalf("writing lock file %v", err)
+			}
+
+			deps, err := ReadLock(lockPath)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(deps) != len(tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, deps)
+			}
+			for name, constraints := range tc.expect {
+				if got := deps[name].GetConstraints().String(); got != constraints {
+					t.Fatalf("expected %s %s got %s", name, constraints, got)
+				}
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ReadLock(filepath.Join(t.TempDir(), "k6.lock"))
+		if !errors.Is(err, ErrDependency) {
+			t.Fatalf("expected %v got %v", ErrDependency, err)
+		}
+	})
+}
+
+func TestGetBinaryFromLock(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	lockPath := filepath.Join(t.TempDir(), "k6.lock")
+	if err = k6.WriteLock(lockPath); err != nil {
+		t.Fatalf("writing lock %v", err)
+	}
+
+	locked, err := provider.GetBinaryFromLock(context.TODO(), lockPath)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if locked.Path != k6.Path {
+		t.Fatalf("expected %s got %s", k6.Path, locked.Path)
+	}
+}
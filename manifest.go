@@ -0,0 +1,64 @@
+package k6provider
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/grafana/k6build"
+)
+
+const manifestFile = "artifact.json"
+
+// manifest describes a binary stored in the cache
+type manifest struct {
+	// ID of the artifact
+	ID string `json:"id,omitempty"`
+	// Platform of the binary
+	Platform string `json:"platform,omitempty"`
+	// Dependencies as a map of name: version
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	// Checksum of the binary
+	Checksum string `json:"checksum,omitempty"`
+	// Downloaded is the time the binary was downloaded
+	Downloaded time.Time `json:"downloaded"`
+	// ETag header of the download response, if any
+	ETag string `json:"etag,omitempty"`
+	// LastModified header of the download response, if any
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// newManifest returns the manifest for an artifact downloaded at the given time
+func newManifest(artifact k6build.Artifact, downloaded time.Time) manifest {
+	return manifest{
+		ID:           artifact.ID,
+		Platform:     artifact.Platform,
+		Dependencies: artifact.Dependencies,
+		Checksum:     artifact.Checksum,
+		Downloaded:   downloaded.UTC(),
+	}
+}
+
+// writeManifest stores the manifest in the artifact's directory with the given permissions
+func writeManifest(artifactDir string, m manifest, mode os.FileMode) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(artifactDir, manifestFile), data, mode)
+}
+
+// readManifest returns the manifest stored in the artifact's directory
+func readManifest(artifactDir string) (manifest, error) {
+	data, err := os.ReadFile(filepath.Join(artifactDir, manifestFile)) //nolint:gosec
+	if err != nil {
+		return manifest{}, err
+	}
+
+	m := manifest{}
+	err = json.Unmarshal(data, &m)
+
+	return m, err
+}
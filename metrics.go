@@ -0,0 +1,65 @@
+package k6provider
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives measurements of the provider's activity. It allows exporting them to
+// a metrics system such as Prometheus or OpenTelemetry using a thin adapter.
+//
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// IncCacheHit is called when a binary is found in the cache
+	IncCacheHit()
+	// IncCacheMiss is called when a binary is not found in the cache
+	IncCacheMiss()
+	// IncBuildFailure is called when the build service fails to provide an artifact
+	IncBuildFailure()
+	// ObserveBuildDuration is called with the time taken by a successful build request, including retries
+	ObserveBuildDuration(d time.Duration)
+	// ObserveDownloadDuration is called with the time taken by a successful download, including retries
+	ObserveDownloadDuration(d time.Duration)
+	// AddDownloadedBytes is called with the size of every binary downloaded
+	AddDownloadedBytes(n int64)
+}
+
+// noopMetrics discards all measurements
+type noopMetrics struct{}
+
+func (noopMetrics) IncCacheHit()                          {}
+func (noopMetrics) IncCacheMiss()                         {}
+func (noopMetrics) IncBuildFailure()                      {}
+func (noopMetrics) ObserveBuildDuration(time.Duration)    {}
+func (noopMetrics) ObserveDownloadDuration(time.Duration) {}
+func (noopMetrics) AddDownloadedBytes(int64)              {}
+
+// countingMetrics counts the measurements reported by CacheStats and forwards
+// them to the configured Metrics
+type countingMetrics struct {
+	Metrics
+	hits            atomic.Int64
+	misses          atomic.Int64
+	downloads       atomic.Int64
+	downloadedBytes atomic.Int64
+}
+
+func (m *countingMetrics) IncCacheHit() {
+	m.hits.Add(1)
+	m.Metrics.IncCacheHit()
+}
+
+func (m *countingMetrics) IncCacheMiss() {
+	m.misses.Add(1)
+	m.Metrics.IncCacheMiss()
+}
+
+func (m *countingMetrics) ObserveDownloadDuration(d time.Duration) {
+	m.downloads.Add(1)
+	m.Metrics.ObserveDownloadDuration(d)
+}
+
+func (m *countingMetrics) AddDownloadedBytes(n int64) {
+	m.downloadedBytes.Add(n)
+	m.Metrics.AddDownloadedBytes(n)
+}
@@ -0,0 +1,76 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6deps"
+)
+
+type testMetrics struct {
+	hits          atomic.Int64
+	misses        atomic.Int64
+	buildFailures atomic.Int64
+	builds        atomic.Int64
+	downloads     atomic.Int64
+	bytes         atomic.Int64
+}
+
+func (m *testMetrics) IncCacheHit()                          { m.hits.Add(1) }
+func (m *testMetrics) IncCacheMiss()                         { m.misses.Add(1) }
+func (m *testMetrics) IncBuildFailure()                      { m.buildFailures.Add(1) }
+func (m *testMetrics) ObserveBuildDuration(time.Duration)    { m.builds.Add(1) }
+func (m *testMetrics) ObserveDownloadDuration(time.Duration) { m.downloads.Add(1) }
+func (m *testMetrics) AddDownloadedBytes(n int64)            { m.bytes.Add(n) }
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	t.Run("cache miss and hit", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := &testMetrics{}
+		provider, _ := newTestProvider(t, Config{Metrics: metrics}, content, sha256sum(content))
+
+		for range 2 {
+			if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+		}
+
+		if metrics.misses.Load() != 1 || metrics.hits.Load() != 1 {
+			t.Fatalf("expected 1 miss and 1 hit got %d and %d", metrics.misses.Load(), metrics.hits.Load())
+		}
+
+		if metrics.builds.Load() != 2 || metrics.downloads.Load() != 1 {
+			t.Fatalf("expected 2 builds and 1 download got %d and %d", metrics.builds.Load(), metrics.downloads.Load())
+		}
+
+		if metrics.bytes.Load() != int64(len(content)) {
+			t.Fatalf("expected %d bytes got %d", len(content), metrics.bytes.Load())
+		}
+	})
+
+	t.Run("build failure", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := &testMetrics{}
+		provider, _ := newTestProvider(t, Config{Metrics: metrics}, content, sha256sum(content))
+		provider.buildSrv = &testBuildService{err: k6build.NewWrappedError(api.ErrBuildFailed, errors.New("failed"))}
+
+		if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); !errors.Is(err, ErrBuild) {
+			t.Fatalf("expected %v got %v", ErrBuild, err)
+		}
+
+		if metrics.buildFailures.Load() != 1 || metrics.builds.Load() != 0 {
+			t.Fatalf("expected 1 build failure got %d", metrics.buildFailures.Load())
+		}
+	})
+}
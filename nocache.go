@@ -0,0 +1,119 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/grafana/k6build"
+)
+
+// uncachedBinaries tracks the directories of the binaries downloaded with NoCache,
+// so they are removed when the provider is closed
+type uncachedBinaries struct {
+	mutex sync.Mutex
+	dirs  []string
+}
+
+func (u *uncachedBinaries) add(dir string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.dirs = append(u.dirs, dir)
+}
+
+// removeAll removes the directories of all the binaries
+func (u *uncachedBinaries) removeAll() error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	errs := []error{}
+	for _, dir := range u.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	u.dirs = nil
+
+	return errors.Join(errs...)
+}
+
+// downloadUncached downloads the binary to a new temporary directory, without using the cache.
+// The directory is removed when the provider is closed.
+func (p *Provider) downloadUncached(
+	ctx context.Context,
+	log *slog.Logger,
+	artifact k6build.Artifact,
+	stats BinaryStats,
+) (K6Binary, error) {
+	baseDir := p.tempDir
+	if baseDir == "" {
+		baseDir = os.TempDir()
+	}
+
+	dir, err := os.MkdirTemp(baseDir, "k6provider-*")
+	if err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+	p.uncached.add(dir)
+
+	binPath := filepath.Join(dir, p.binary)
+	target, err := os.OpenFile(binPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec
+	if err != nil {
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	downloadCtx, cancel := withTimeout(ctx, p.downloadTimeout)
+	defer cancel()
+
+	log.Debug("download started", slog.String("path", binPath))
+	p.emit(Event{Kind: EventDownloadStarted, ArtifactID: artifact.ID})
+	start := p.clock.Now()
+
+	size, _, upload, err := p.fetch(downloadCtx, log, artifact, validators{}, -1, target)
+	_ = target.Close()
+	p.downloadCompleted(artifact.ID, size, p.clock.Since(start), err)
+	if errors.Is(err, errInsufficientSpace) {
+		_ = os.RemoveAll(dir)
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return K6Binary{}, NewWrappedError(ErrDownload, err)
+	}
+
+	stats.DownloadDuration = p.clock.Since(start)
+	stats.Size = size
+	p.metrics.ObserveDownloadDuration(stats.DownloadDuration)
+	p.metrics.AddDownloadedBytes(size)
+
+	log.Info("download completed", slog.Int64("bytes", size), slog.Duration("duration", stats.DownloadDuration))
+
+	if err = p.verifyDownloaded(downloadCtx, log, artifact, binPath); err != nil {
+		_ = os.RemoveAll(dir)
+		return K6Binary{}, err
+	}
+
+	// the binary is shared with other providers only once it is verified
+	if upload {
+		p.uploadStored(downloadCtx, log, artifact, binPath)
+	}
+
+	if err = p.writeChecksumFile(dir, artifact.Checksum); err != nil {
+		_ = os.RemoveAll(dir)
+		return K6Binary{}, NewWrappedError(ErrBinary, err)
+	}
+
+	return K6Binary{
+		Path:         binPath,
+		Dependencies: artifact.Dependencies,
+		K6Version:    k6Version(artifact.Dependencies),
+		Checksum:     artifact.Checksum,
+		ArtifactID:   artifact.ID,
+		URL:          artifact.URL,
+		Stats:        stats,
+	}, nil
+}
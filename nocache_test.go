@@ -0,0 +1,81 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestNoCache(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	tempDir := t.TempDir()
+	provider, downloadSrv := newTestProvider(t, Config{NoCache: true, TempDir: tempDir}, content, sha256sum(content))
+
+	downloads := atomic.Int32{}
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		downloads.Add(1)
+		_, _ = w.Write(content)
+	})
+
+	paths := []string{}
+	for range 2 {
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if k6.Stats.CacheHit {
+			t.Fatalf("unexpected cache hit")
+		}
+
+		if !strings.HasPrefix(k6.Path, tempDir) {
+			t.Fatalf("expected binary in %s got %s", tempDir, k6.Path)
+		}
+
+		got, err := os.ReadFile(k6.Path)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+
+		paths = append(paths, k6.Path)
+	}
+
+	if paths[0] == paths[1] {
+		t.Fatalf("expected a new path for each binary got %s", paths[0])
+	}
+
+	if downloads.Load() != 2 {
+		t.Fatalf("expected 2 downloads got %d", downloads.Load())
+	}
+
+	// nothing is written to the cache
+	entries, err := os.ReadDir(provider.binDir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("reading cache %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected empty cache got %d entries", len(entries))
+	}
+
+	if err = provider.Close(); err != nil {
+		t.Fatalf("closing provider %v", err)
+	}
+
+	for _, path := range paths {
+		if _, err = os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+			t.Fatalf("binary not removed on close %v", err)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package k6provider
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/grafana/k6build"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a [Provider].
+//
+// [Config] is also an Option that sets all the configuration at once,
+// replacing any previously applied option. Therefore, when combined with other
+// options, it must be passed first.
+type Option interface {
+	apply(config *Config)
+}
+
+// optionFunc implements an Option using a function
+type optionFunc func(config *Config)
+
+func (f optionFunc) apply(config *Config) {
+	f(config)
+}
+
+// apply sets the configuration
+func (c Config) apply(config *Config) {
+	*config = c
+}
+
+// WithPlatform sets the platform for the binaries in the os/arch form (e.g. "linux/amd64")
+func WithPlatform(platform string) Option {
+	return optionFunc(func(config *Config) {
+		config.Platform = platform
+	})
+}
+
+// WithBinDir sets the path to the binary cache directory
+func WithBinDir(dir string) Option {
+	return optionFunc(func(config *Config) {
+		config.BinDir = dir
+	})
+}
+
+// WithBuildServiceURL sets the URL of the k6 build service
+func WithBuildServiceURL(url string) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildServiceURL = url
+	})
+}
+
+// WithBuildServiceAuth sets the credentials passed in the "Authorization: <authType> <auth>" header
+// of the requests to the build service
+func WithBuildServiceAuth(authType string, auth string) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildServiceAuthType = authType
+		config.BuildServiceAuth = auth
+	})
+}
+
+// WithBuildServiceHeaders sets custom headers for the requests to the build service
+func WithBuildServiceHeaders(headers map[string]string) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildServiceHeaders = headers
+	})
+}
+
+// WithDownloadProxy sets the URL of the proxy used for downloading binaries
+func WithDownloadProxy(proxyURL string) Option {
+	return optionFunc(func(config *Config) {
+		config.DownloadProxyURL = proxyURL
+	})
+}
+
+// WithDownloadAuth sets the credentials passed in the "Authorization: <authType> <auth>" header
+// of the download requests
+func WithDownloadAuth(authType string, auth string) Option {
+	return optionFunc(func(config *Config) {
+		config.DownloadAuthType = authType
+		config.DownloadAuth = auth
+	})
+}
+
+// WithDownloadHeaders sets custom headers for the download requests
+func WithDownloadHeaders(headers map[string]string) Option {
+	return optionFunc(func(config *Config) {
+		config.DownloadHeaders = headers
+	})
+}
+
+// WithHTTPClient sets the client used for downloading binaries
+func WithHTTPClient(client *http.Client) Option {
+	return optionFunc(func(config *Config) {
+		config.HTTPClient = client
+	})
+}
+
+// WithCacheLimit sets the upper limit of the cache size and the minimum time between prune attempts
+func WithCacheLimit(highWaterMark int64, pruneInterval time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.HighWaterMark = highWaterMark
+		config.PruneInterval = pruneInterval
+	})
+}
+
+// WithRetry sets how failed builds and downloads are retried
+func WithRetry(retry RetryConfig) Option {
+	return optionFunc(func(config *Config) {
+		config.Retry = retry
+	})
+}
+
+// WithBuildTimeout sets the maximum time for obtaining the artifact from the build service
+func WithBuildTimeout(timeout time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildTimeout = timeout
+	})
+}
+
+// WithDownloadTimeout sets the maximum time for downloading a binary
+func WithDownloadTimeout(timeout time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.DownloadTimeout = timeout
+	})
+}
+
+// WithProgress sets the function for reporting the progress of downloads
+func WithProgress(progress ProgressFunc) Option {
+	return optionFunc(func(config *Config) {
+		config.ProgressFunc = progress
+	})
+}
+
+// WithLogger sets the logger for reporting the activity of the provider
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(config *Config) {
+		config.Logger = logger
+	})
+}
+
+// WithOffline sets the offline mode, which obtains binaries only from the cache
+func WithOffline(offline bool) Option {
+	return optionFunc(func(config *Config) {
+		config.Offline = offline
+	})
+}
+
+// WithVerifyOnHit enables verifying the checksum of binaries returned from the cache
+func WithVerifyOnHit(verify bool) Option {
+	return optionFunc(func(config *Config) {
+		config.VerifyOnHit = verify
+	})
+}
+
+// WithTracerProvider sets the TracerProvider used for tracing builds and downloads
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return optionFunc(func(config *Config) {
+		config.TracerProvider = tp
+	})
+}
+
+// WithMetrics sets the Metrics that receive the measurements of the provider's activity
+func WithMetrics(metrics Metrics) Option {
+	return optionFunc(func(config *Config) {
+		config.Metrics = metrics
+	})
+}
+
+// WithPermissions sets the permissions for the cache directories and the cached binaries
+func WithPermissions(dirMode os.FileMode, fileMode os.FileMode) Option {
+	return optionFunc(func(config *Config) {
+		config.DirMode = dirMode
+		config.FileMode = fileMode
+	})
+}
+
+// WithMaxDownloadRate limits the download rate to the given bytes per second
+func WithMaxDownloadRate(bytesPerSec int64) Option {
+	return optionFunc(func(config *Config) {
+		config.MaxDownloadBytesPerSec = bytesPerSec
+	})
+}
+
+// WithForceRefresh sets if cached binaries are checked for modifications in the download server
+func WithForceRefresh(refresh bool) Option {
+	return optionFunc(func(config *Config) {
+		config.ForceRefresh = refresh
+	})
+}
+
+// WithBuildServiceURLs sets the URLs of additional build services used as fallback
+func WithBuildServiceURLs(urls ...string) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildServiceURLs = urls
+	})
+}
+
+// WithCache sets the Cache for the binaries obtained with GetBinaryStream
+func WithCache(cache Cache) Option {
+	return optionFunc(func(config *Config) {
+		config.Cache = cache
+	})
+}
+
+// WithStorage sets the Storage shared with other providers for obtaining binaries not found in the cache
+func WithStorage(storage Storage) Option {
+	return optionFunc(func(config *Config) {
+		config.Storage = storage
+	})
+}
+
+// WithUserAgent sets the User-Agent for the requests to the build service and the downloads
+func WithUserAgent(userAgent string) Option {
+	return optionFunc(func(config *Config) {
+		config.UserAgent = userAgent
+	})
+}
+
+// WithVerifyFormat enables checking the downloaded binaries are executables for the platform
+func WithVerifyFormat(verify bool) Option {
+	return optionFunc(func(config *Config) {
+		config.VerifyFormat = verify
+	})
+}
+
+// WithHeadPreflight enables sending a HEAD request for validating the URL and size of a binary before downloading it
+func WithHeadPreflight(preflight bool) Option {
+	return optionFunc(func(config *Config) {
+		config.HeadPreflight = preflight
+	})
+}
+
+// WithNamespace sets the namespace that isolates the cache of the provider from other namespaces
+func WithNamespace(namespace string) Option {
+	return optionFunc(func(config *Config) {
+		config.Namespace = namespace
+	})
+}
+
+// WithBinaryName sets the name of the binaries in the cache
+func WithBinaryName(name string) Option {
+	return optionFunc(func(config *Config) {
+		config.BinaryName = name
+	})
+}
+
+// WithResumeDownloads enables resuming interrupted downloads using HTTP Range requests
+func WithResumeDownloads(resume bool) Option {
+	return optionFunc(func(config *Config) {
+		config.ResumeDownloads = resume
+	})
+}
+
+// WithTempDir sets the directory for the intermediate files of downloads
+func WithTempDir(dir string) Option {
+	return optionFunc(func(config *Config) {
+		config.TempDir = dir
+	})
+}
+
+// WithBuildOpts sets the build-time options forwarded to the build service
+func WithBuildOpts(opts map[string]string) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildOpts = opts
+	})
+}
+
+// WithMaxBinarySize sets the maximum size in bytes of a downloaded binary
+func WithMaxBinarySize(size int64) Option {
+	return optionFunc(func(config *Config) {
+		config.MaxBinarySize = size
+	})
+}
+
+// WithBuildService sets the build service used for building the binaries
+func WithBuildService(srv k6build.BuildService) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildService = srv
+	})
+}
+
+// WithNoCache disables the cache, downloading the binary to a new temporary directory every time
+func WithNoCache(noCache bool) Option {
+	return optionFunc(func(config *Config) {
+		config.NoCache = noCache
+	})
+}
+
+// WithBuildQueuedFunc sets the function called when a build is queued by the build service
+func WithBuildQueuedFunc(fn BuildQueuedFunc) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildQueuedFunc = fn
+	})
+}
+
+// WithInsecureSkipChecksum disables the verification of the checksum of the binaries. Never use it in production
+func WithInsecureSkipChecksum(skip bool) Option {
+	return optionFunc(func(config *Config) {
+		config.InsecureSkipChecksum = skip
+	})
+}
+
+// WithContentAddressed stores each binary once by its checksum, linking the artifacts with identical binaries to it
+func WithContentAddressed(contentAddressed bool) Option {
+	return optionFunc(func(config *Config) {
+		config.ContentAddressed = contentAddressed
+	})
+}
+
+// WithCacheTTL sets the time after which cached binaries for floating constraints are checked for a newer build
+func WithCacheTTL(ttl time.Duration) Option {
+	return optionFunc(func(config *Config) {
+		config.CacheTTL = ttl
+	})
+}
+
+// WithCacheCompression sets the compression of the binaries stored in the cache ("none" or "gzip")
+func WithCacheCompression(compression string) Option {
+	return optionFunc(func(config *Config) {
+		config.CacheCompression = compression
+	})
+}
+
+// WithBeforeDownload sets the hook called with the resolved artifact before its binary is obtained
+func WithBeforeDownload(hook BeforeDownloadFunc) Option {
+	return optionFunc(func(config *Config) {
+		config.BeforeDownload = hook
+	})
+}
+
+// WithAllowedExtensions restricts the extensions of the binaries to those matching any of the glob patterns
+func WithAllowedExtensions(patterns ...string) Option {
+	return optionFunc(func(config *Config) {
+		config.AllowedExtensions = patterns
+	})
+}
+
+// WithDeniedExtensions rejects the extensions matching any of the glob patterns
+func WithDeniedExtensions(patterns ...string) Option {
+	return optionFunc(func(config *Config) {
+		config.DeniedExtensions = patterns
+	})
+}
+
+// WithStaleIfError returns the cached binary if the build service is not available
+func WithStaleIfError(staleIfError bool) Option {
+	return optionFunc(func(config *Config) {
+		config.StaleIfError = staleIfError
+	})
+}
+
+// WithEventFunc sets the function that receives the events of the provider
+func WithEventFunc(fn EventFunc) Option {
+	return optionFunc(func(config *Config) {
+		config.EventFunc = fn
+	})
+}
+
+// WithEmitChecksumFile writes the checksum of the binaries in a file next to them
+func WithEmitChecksumFile(emit bool) Option {
+	return optionFunc(func(config *Config) {
+		config.EmitChecksumFile = emit
+	})
+}
+
+// WithVerifyExecutable runs the downloaded binaries for checking they execute and report the expected version
+func WithVerifyExecutable(verify bool) Option {
+	return optionFunc(func(config *Config) {
+		config.VerifyExecutable = verify
+	})
+}
+
+// WithBypassCache builds and downloads the binaries every time, still adding them to the cache
+func WithBypassCache(bypass bool) Option {
+	return optionFunc(func(config *Config) {
+		config.BypassCache = bypass
+	})
+}
+
+// WithBuildRequestModifier sets the function called with every request to the build service before it is sent
+func WithBuildRequestModifier(modifier RequestModifier) Option {
+	return optionFunc(func(config *Config) {
+		config.BuildRequestModifier = modifier
+	})
+}
+
+// WithDownloadRequestModifier sets the function called with every download request before it is sent
+func WithDownloadRequestModifier(modifier RequestModifier) Option {
+	return optionFunc(func(config *Config) {
+		config.DownloadRequestModifier = modifier
+	})
+}
+
+// WithContextHeaders sets the headers of the requests taken from the values of the given context keys
+func WithContextHeaders(headers map[any]string) Option {
+	return optionFunc(func(config *Config) {
+		config.ContextHeaders = headers
+	})
+}
+
+// WithSignatureVerifier sets the verifier of the signature of the downloaded binaries
+func WithSignatureVerifier(verifier SignatureVerifier) Option {
+	return optionFunc(func(config *Config) {
+		config.SignatureVerifier = verifier
+	})
+}
+
+// withClock sets the clock used by the provider, for testing time-dependent behavior
+func withClock(c clock) Option {
+	return optionFunc(func(config *Config) {
+		config.clock = c
+	})
+}
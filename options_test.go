@@ -0,0 +1,146 @@
+package k6provider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// a bin dir inside a file can't be created
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	testCases := []struct {
+		title     string
+		opts      []Option
+		expectErr error
+		expect    func(p *Provider) error
+	}{
+		{
+			title: "functional options",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithBinDir(dir),
+				WithPlatform("windows/amd64"),
+				WithRetry(RetryConfig{MaxAttempts: 5}),
+				WithDownloadTimeout(time.Minute),
+			},
+			expect: func(p *Provider) error {
+				if p.binDir != dir || p.platform != "windows/amd64" {
+					return errors.New("bin dir or platform not set")
+				}
+				if p.retry.MaxAttempts != 5 || p.downloadTimeout != time.Minute {
+					return errors.New("retry or timeout not set")
+				}
+				return nil
+			},
+		},
+		{
+			title: "config combined with options",
+			opts: []Option{
+				Config{BuildServiceURL: "http://localhost", BinDir: dir, Platform: "linux/arm64"},
+				WithPlatform("darwin/arm64"),
+			},
+			expect: func(p *Provider) error {
+				if p.binDir != dir || p.platform != "darwin/arm64" {
+					return errors.New("config not applied")
+				}
+				return nil
+			},
+		},
+		{
+			title: "namespace",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithBinDir(dir),
+				WithNamespace("tenant"),
+			},
+			expect: func(p *Provider) error {
+				if p.binDir != filepath.Join(dir, "tenant") {
+					return errors.New("namespace not applied")
+				}
+				return nil
+			},
+		},
+		{
+			title: "invalid namespace",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithNamespace("../tenant"),
+			},
+			expectErr: ErrConfig,
+		},
+		{
+			title: "unsupported build options",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithBuildOpts(map[string]string{"tags": "netgo"}),
+			},
+			expectErr: ErrConfig,
+		},
+		{
+			title: "bin dir not writable",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithBinDir(filepath.Join(file, "cache")),
+			},
+			expectErr: ErrConfig,
+		},
+		{
+			title: "read-only bin dir in offline mode",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithBinDir(filepath.Join(file, "cache")),
+				WithOffline(true),
+			},
+			expect: func(*Provider) error {
+				return nil
+			},
+		},
+		{
+			title: "offline mode without cache",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithOffline(true),
+				WithNoCache(true),
+			},
+			expectErr: ErrConfig,
+		},
+		{
+			title: "invalid option",
+			opts: []Option{
+				WithBuildServiceURL("http://localhost"),
+				WithPlatform("linux"),
+			},
+			expectErr: ErrConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, err := NewProvider(tc.opts...)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if err := tc.expect(provider); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
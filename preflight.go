@@ -0,0 +1,65 @@
+package k6provider
+
+import (
+	"context"
+	"net/http"
+)
+
+// preflight sends a HEAD request for the binary, checking the URL is valid and there's
+// enough disk space for the binary. Returns the size of the binary, or -1 if it is unknown,
+// for example, because the server doesn't support HEAD requests.
+func (p *Provider) preflight(ctx context.Context, from string) (int64, error) {
+	// local files are checked when they are copied
+	if _, isLocal := localPath(from); isLocal {
+		return -1, nil
+	}
+
+	size := int64(-1)
+	err := retry(ctx, p.clock, p.retry, isRetryable, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, from, nil)
+		if err != nil {
+			return err
+		}
+		req.Header = p.downloadHeaders.Clone()
+		if p.tracing {
+			injectTraceContext(ctx, req.Header)
+		}
+		injectContextHeaders(ctx, req.Header, p.contextHeaders)
+		if p.modifyDownload != nil {
+			p.modifyDownload(req)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return retryableError{err: err}
+		}
+		defer resp.Body.Close() //nolint:errcheck
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			// the size of encoded responses doesn't correspond to the size of the binary
+			if encoding := resp.Header.Get("Content-Encoding"); encoding == "" || encoding == "identity" {
+				size = resp.ContentLength
+			}
+			return nil
+		case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+			// HEAD is not supported, the binary is downloaded without preflight
+			return nil
+		default:
+			err = newDownloadError(from, resp)
+			if isRetryableStatus(resp.StatusCode) {
+				return retryableResponseError(err, resp, p.clock.Now())
+			}
+			return err
+		}
+	})
+	if err != nil {
+		return -1, NewWrappedError(ErrDownload, err)
+	}
+
+	if err = checkFreeSpace(p.binDir, size); err != nil {
+		return -1, NewWrappedError(ErrBinary, err)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,106 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestHeadPreflight(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title       string
+		headStatus  int
+		headSize    int64
+		expectErr   error
+		expectGets  int32
+		expectTotal int64
+	}{
+		{
+			title:       "size from head",
+			headStatus:  http.StatusOK,
+			headSize:    int64(len(content)),
+			expectGets:  1,
+			expectTotal: int64(len(content)),
+		},
+		{
+			title:       "head not allowed",
+			headStatus:  http.StatusMethodNotAllowed,
+			expectGets:  1,
+			expectTotal: -1,
+		},
+		{
+			title:      "not found",
+			headStatus: http.StatusNotFound,
+			expectErr:  ErrDownload,
+			expectGets: 0,
+		},
+		{
+			title:      "insufficient disk space",
+			headStatus: http.StatusOK,
+			headSize:   math.MaxInt64,
+			expectErr:  ErrBinary,
+			expectGets: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{HeadPreflight: true}, content, sha256sum(content))
+
+			gets := atomic.Int32{}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					if tc.headSize > 0 {
+						w.Header().Set("Content-Length", fmt.Sprintf("%d", tc.headSize))
+					}
+					w.WriteHeader(tc.headStatus)
+					return
+				}
+
+				gets.Add(1)
+				// the response doesn't have a Content-Length
+				w.(http.Flusher).Flush() //nolint:forcetypeassert
+				_, _ = w.Write(content)
+			})
+
+			total := atomic.Int64{}
+			provider.progress = func(_ int64, t int64) {
+				total.Store(t)
+			}
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if gets.Load() != tc.expectGets {
+				t.Fatalf("expected %d downloads got %d", tc.expectGets, gets.Load())
+			}
+
+			if err != nil {
+				if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact")); !os.IsNotExist(err) {
+					t.Fatalf("artifact directory created %v", err)
+				}
+				return
+			}
+
+			if total.Load() != tc.expectTotal {
+				t.Fatalf("expected total %d got %d", tc.expectTotal, total.Load())
+			}
+		})
+	}
+}
@@ -3,36 +3,79 @@
 package k6provider
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
-	"syscall"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/grafana/k6build"
-	"github.com/grafana/k6build/pkg/client"
 	"github.com/grafana/k6deps"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	k6Binary             = "k6"
 	k6Module             = "k6"
+	modulePath           = "github.com/grafana/k6provider"
 	defaultPruneInterval = time.Hour
 	defaultAuthType      = "Bearer"
+	defaultDirMode       = os.FileMode(0o700)
+	defaultFileMode      = os.FileMode(0o700)
+	// maxErrorBodySize is the maximum size of the response body included in a [DownloadError]
+	maxErrorBodySize = 512
+	// defaultMaxBinarySize is the default limit for the size of the downloaded binaries
+	defaultMaxBinarySize = int64(1) << 30
+	// partialSuffix is the suffix of the file keeping the partial content of a resumable download
+	partialSuffix = ".part"
 )
 
+// supportedPlatforms lists the platforms (as os/arch) k6 can be built for
+var supportedPlatforms = []string{ //nolint:gochecknoglobals
+	"darwin/amd64",
+	"darwin/arm64",
+	"linux/amd64",
+	"linux/arm64",
+	"windows/amd64",
+	"windows/arm64",
+}
+
 var (
 	// ErrBinary indicates an error creating local binary
 	ErrBinary = errors.New("creating binary")
 	// ErrBuild indicates an error building binary
 	ErrBuild = errors.New("building binary")
+	// ErrBuildUnsatisfiable indicates the build service can't build a binary for the dependencies,
+	// for example, because an extension or version doesn't exist. Retrying the build won't help.
+	// It is always wrapped in an ErrBuild.
+	ErrBuildUnsatisfiable = errors.New("unsatisfiable dependencies")
+	// ErrBuildQueued indicates the build was queued by the build service for longer than the
+	// MaxQueueWait in the [RetryConfig]. It is always wrapped in an ErrBuild.
+	ErrBuildQueued = errors.New("build queued for too long")
+	// ErrBuildServiceUnavailable indicates the build service can't be reached or is not responsive
+	ErrBuildServiceUnavailable = errors.New("build service unavailable")
+	// ErrPingUnsupported indicates the availability of the build service can't be checked,
+	// for example, because a custom BuildService is used
+	ErrPingUnsupported = errors.New("ping not supported by the build service")
+	// ErrCannotExecute indicates a downloaded binary can't be run for verifying it (see VerifyExecutable),
+	// for example, because it is downloaded to a filesystem mounted with noexec
+	ErrCannotExecute = errors.New("binary can't be executed")
 	// ErrConfig is produced by invalid configuration
 	ErrConfig = errors.New("invalid configuration")
 	// ErrDownload indicates an error downloading binary
@@ -41,6 +84,24 @@ var (
 	ErrInvalidParameters = errors.New("invalid build parameters")
 	// ErrPruningCache indicates an error pruning the binary cache
 	ErrPruningCache = errors.New("pruning cache")
+	// ErrDependency indicates an invalid dependency, such as a dependency with an empty name or
+	// invalid version constraints. If many dependencies are invalid, all of them are reported:
+	// errors.Unwrap returns an error joining the problem of each dependency (see [errors.Join])
+	ErrDependency = errors.New("invalid dependency")
+	// ErrClosed is returned when using a provider after it was closed
+	ErrClosed = errors.New("provider closed")
+	// ErrRejected indicates the BeforeDownload hook rejected the artifact. Using errors.Unwrap
+	// returns the error returned by the hook
+	ErrRejected = errors.New("artifact rejected")
+
+	// errChecksumMismatch is returned when the downloaded binary doesn't match the expected checksum
+	errChecksumMismatch = errors.New("checksum mismatch")
+	// errNotModified is returned when a cached binary has not been modified since it was downloaded
+	errNotModified = errors.New("not modified")
+	// errBinaryTooLarge is returned when a binary exceeds the maximum size
+	errBinaryTooLarge = errors.New("binary exceeds max size")
+	// errInvalidCached is returned when a cached binary can't be used and must be removed
+	errInvalidCached = errors.New("invalid cached binary")
 )
 
 // WrappedError defines a custom error type that allows creating an error
@@ -89,6 +150,36 @@ func AsWrappedError(err error) (WrappedError, bool) {
 	return buildErr, true
 }
 
+// DownloadError is returned when the download server responds with an unexpected status.
+// It can be obtained from the errors returned by the provider using errors.As
+type DownloadError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// URL is the URL of the binary
+	URL string
+	// Body is a snippet of the response's body, which may contain details about the error
+	Body string
+}
+
+// Error returns the error as a string
+func (e *DownloadError) Error() string {
+	msg := fmt.Sprintf("status %d %s downloading %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// newDownloadError returns a DownloadError for the response, including a snippet of its body
+func newDownloadError(from string, resp *http.Response) *DownloadError {
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &DownloadError{
+		StatusCode: resp.StatusCode,
+		URL:        from,
+		Body:       strings.TrimSpace(strings.ToValidUTF8(string(snippet), "")),
+	}
+}
+
 // K6Binary defines the attributes of a k6 binary
 type K6Binary struct {
 	// Path to the binary
@@ -96,28 +187,77 @@ type K6Binary struct {
 	// Dependencies as a map of name: version
 	// e.g. {"k6": "v0.50.0", "k6/x/kubernetes": "v0.9.0"}
 	Dependencies map[string]string
-	// Checksum of the binary
+	// K6Version is the version of k6 in the binary, e.g. "v0.50.0".
+	// It is the "k6" entry in the Dependencies. Empty if the build service didn't report it
+	K6Version string
+	// Checksum of the binary, optionally prefixed by its algorithm (e.g. "sha512:...").
+	// Checksums without prefix are sha256.
 	Checksum string
+	// ArtifactID identifies the binary's artifact in the build service
+	ArtifactID string
+	// URL for downloading the binary from the build service
+	URL string
+	// Stats about how the binary was obtained
+	Stats BinaryStats
+}
+
+// BinaryStats defines statistics about how a binary was obtained
+type BinaryStats struct {
+	// BuildDuration time taken for obtaining the artifact from the build service,
+	// even if the binary was found in the cache
+	BuildDuration time.Duration
+	// DownloadDuration time taken for downloading the binary. Zero if the binary was found in the cache
+	DownloadDuration time.Duration
+	// CacheHit indicates if the binary was found in the cache
+	CacheHit bool
+	// Stale indicates the build service was not available and the binary previously cached for
+	// the dependencies was returned instead (see Config.StaleIfError)
+	Stale bool
+	// Size of the binary in bytes
+	Size int64
+}
+
+// MarshalDeps returns the dependencies as a list of "name":"version" pairs separated by ";",
+// sorted by name. Names and versions are quoted using Go's string literal syntax.
+// e.g. "k6":"v0.50.0";"k6/x/kubernetes":"v0.9.0"
+func (b K6Binary) MarshalDeps() string {
+	names := make([]string, 0, len(b.Dependencies))
+	for name := range b.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%q:%q", name, b.Dependencies[name]))
+	}
+
+	return strings.Join(pairs, ";")
 }
 
 // UnmarshalDeps returns the dependencies as a list of name:version pairs separated by ";"
+//
+// Deprecated: use [K6Binary.MarshalDeps]
 func (b K6Binary) UnmarshalDeps() string {
-	buffer := &bytes.Buffer{}
-	for dep, version := range b.Dependencies {
-		buffer.WriteString(fmt.Sprintf("%s:%q;", dep, version))
-	}
-	return buffer.String()
+	return b.MarshalDeps()
 }
 
 // Config defines the configuration of the Provider.
 type Config struct {
-	// Platform for the binaries. Defaults to the current platform
+	// Platform for the binaries in the os/arch form (e.g. "linux/amd64"). Defaults to the current platform
 	Platform string
-	// BinDir path to binary directory. Defaults to the os' tmp dir
+	// BinDir path to binary directory. Defaults to the k6provider directory in the user's cache
+	// directory (see [os.UserCacheDir]). If it is not available, the os' tmp dir is used.
+	// The binaries of each platform are kept in a separate subdirectory (e.g. "linux-amd64").
+	// The directory is created if it doesn't exist and must be writable, except in Offline mode
 	BinDir string
 	// BuildServiceURL URL of the k6 build service
 	// If not specified the value from K6_BUILD_SERVICE_URL environment variable is used
 	BuildServiceURL string
+	// BuildServiceURLs URLs of additional k6 build services used as fallback. They are tried in order,
+	// after the BuildServiceURL, when a build fails due to network errors or 5xx responses.
+	// If BuildServiceURL is not specified, the first URL is used as the primary build service
+	BuildServiceURLs []string
 	// BuildServiceAuthType type of passed in the header "Authorization: <type> <auth>".
 	// Can be used to set the type as "Basic", "Token" or any custom type. Default to "Bearer"
 	BuildServiceAuthType string
@@ -130,23 +270,308 @@ type Config struct {
 	// BuildServiceHeaders HTTP headers for the k6 build service
 	BuildServiceHeaders map[string]string
 	// DownloadProxyURL URL to proxy for downloading binaries
+	// Ignored if HTTPClient is specified. The proxy is selected in the following order: DownloadProxyURL,
+	// the K6_DOWNLOAD_PROXY environment variable and the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables
 	DownloadProxyURL string
-	// HighWaterMark is the upper limit of cache size to trigger a prune
+	// DownloadAuthType type of passed in the header "Authorization: <type> <auth>" of download requests.
+	// Can be used to set the type as "Basic", "Token" or any custom type. Default to "Bearer"
+	DownloadAuthType string
+	// DownloadAuth contain authorization credentials for download requests.
+	// Passed in the "Authorization <type> <credentials" (see DownloadAuthType for the meaning of <type>)
+	// If not specified the value of K6_DOWNLOAD_AUTH is used.
+	// If no value is defined, the Authentication header is not passed (except is passed as a custom header
+	// see DownloadHeaders)
+	DownloadAuth string
+	// DownloadHeaders HTTP headers for the download requests
+	DownloadHeaders map[string]string
+	// HTTPClient client used for downloading binaries. Allows customizing the transport
+	// (e.g. TLS configuration, proxies, connection pooling).
+	// If not specified, a client using the DownloadProxyURL is created.
+	HTTPClient *http.Client
+	// HighWaterMark is the upper limit (in bytes) of the cache size for the provider's platform. When exceeded
+	// after a download, the least recently used binaries are removed until the cache size is below this limit.
+	// Defaults to 0 (no limit)
 	HighWaterMark int64
-	// PruneInterval minimum time between prune attempts. Defaults to 1h
+	// PruneInterval minimum time between prune attempts. Defaults to 1h.
+	// Setting a short interval enforces the HighWaterMark more strictly.
 	PruneInterval time.Duration
+	// Retry defines how failed builds and downloads are retried. See [RetryConfig] for defaults
+	Retry RetryConfig
+	// BuildTimeout maximum time for obtaining the artifact from the build service, including retries.
+	// Defaults to no timeout other than the one defined in the context passed to GetBinary
+	BuildTimeout time.Duration
+	// DownloadTimeout maximum time for downloading the binary, including retries.
+	// Defaults to no timeout other than the one defined in the context passed to GetBinary
+	DownloadTimeout time.Duration
+	// MaxDownloadBytesPerSec limits the download rate, in bytes per second, to prevent downloads from
+	// saturating the network (e.g. when running on the same host that generates load).
+	// Defaults to 0 (unlimited)
+	MaxDownloadBytesPerSec int64
+	// ProgressFunc is invoked periodically while downloading a binary with the number of bytes
+	// downloaded so far and the total size of the binary (-1 if unknown)
+	ProgressFunc ProgressFunc
+	// Logger for reporting the activity of the provider, such as cache hits and misses,
+	// builds and downloads. Defaults to discarding all logs
+	Logger *slog.Logger
+	// Offline mode obtains binaries only from the cache, without accessing the build service.
+	// Only works for dependencies previously resolved by a provider (not in offline mode)
+	// using the same BinDir and Platform. Otherwise, an [ErrNotCached] error is returned.
+	Offline bool
+	// VerifyOnHit verifies the checksum of cached binaries every time they are returned from the cache.
+	// Corrupted binaries are downloaded again. Disabled by default because reading the binaries
+	// adds overhead to every GetBinary call
+	VerifyOnHit bool
+	// TracerProvider used for creating spans for obtaining binaries, building and downloading them.
+	// The trace context is propagated to the download requests. Defaults to no tracing
+	TracerProvider trace.TracerProvider
+	// DirMode permissions for the cache directories. Defaults to 0700 (only accessible by the owner).
+	// Set it, for example, to 0750 for allowing users in the same group to use the cache.
+	// As with any directory created, the process' umask is applied
+	DirMode os.FileMode
+	// FileMode permissions for the cached binaries. Defaults to 0700 (only accessible by the owner).
+	// Set it, for example, to 0750 for allowing users in the same group to execute the binaries.
+	// Other files in the cache, such as the manifests, use the same permissions without the execute bits
+	FileMode os.FileMode
+	// ForceRefresh checks if cached binaries have been modified in the download server, which is
+	// useful when binaries are served from mutable URLs. The ETag and Last-Modified headers of the
+	// cached binary are used for making a conditional request. If the binary was modified, it is
+	// downloaded again. Otherwise, the cached binary is returned.
+	ForceRefresh bool
+	// Metrics receives measurements such as cache hits and misses, build and download durations
+	// and downloaded bytes. Defaults to discarding all measurements
+	Metrics Metrics
+	// Cache stores the binaries obtained with [Provider.GetBinaryStream], for example, using a
+	// [NewMemoryCache] when the filesystem is not available. Defaults to not caching streamed binaries
+	Cache Cache
+	// HeadPreflight sends a HEAD request before downloading a binary, for checking the URL is valid and
+	// learning the size of the binary before creating any file. The size is used for checking the
+	// available disk space and reporting the progress. Falls back to downloading the binary if the
+	// server doesn't support HEAD requests
+	HeadPreflight bool
+	// VerifyFormat checks the downloaded binaries are executables for the platform, by inspecting
+	// their headers (ELF for linux, Mach-O for darwin and PE for windows). This detects, for example,
+	// a misconfigured proxy serving an error page. Not applied to binaries obtained with GetBinaryStream
+	VerifyFormat bool
+	// Namespace isolates the cache of the provider from the caches of providers with other namespaces
+	// sharing the same BinDir, for example, for separating the binaries of different tenants.
+	// The binaries are kept in a subdirectory of BinDir with the namespace's name, and all the cache
+	// operations, such as PruneCache and ListCached, are limited to it. Must be a valid directory name, and
+	// can't be a name used by the cache: a platform directory (e.g. "linux-amd64"), "blobs" or "*.json"
+	Namespace string
+	// BinaryName is the name of the binaries in the cache, for example "k6-v0.50.0".
+	// The ".exe" suffix is added for windows binaries. Defaults to "k6"
+	BinaryName string
+	// UserAgent for the requests to the build service and the downloads. Defaults to "k6provider/<version>".
+	// A User-Agent set in BuildServiceHeaders or DownloadHeaders takes precedence
+	UserAgent string
+	// Storage is a store of binaries shared with other providers, such as a bucket in S3 or GCS,
+	// used when a binary is not in BinDir. Defaults to downloading binaries only from the build service
+	Storage Storage
+	// ResumeDownloads resumes interrupted downloads using HTTP Range requests, instead of downloading
+	// the binary again from the start. The partial content is kept in the cache (or the TempDir), so a
+	// download can also be resumed by a later call. Falls back to a full download if the server doesn't
+	// support ranges
+	ResumeDownloads bool
+	// TempDir is the directory for the intermediate files of downloads, such as the partial content of
+	// resumable downloads. Defaults to the cache directory of each binary, in BinDir, so the downloaded
+	// binary is moved to the cache with an atomic rename. If TempDir is in another file system, the
+	// binary is copied instead, which is slower and not atomic
+	TempDir string
+	// BuildOpts are build-time options forwarded to the build service, such as build tags or ldflags.
+	// The build service client doesn't support any option yet, so setting any fails with ErrConfig
+	BuildOpts map[string]string
+	// MaxBinarySize is the maximum size in bytes of a downloaded binary. Downloads exceeding it are aborted,
+	// preventing a misbehaving server from filling the disk. Defaults to 1GiB. A negative value disables the limit
+	MaxBinarySize int64
+	// BuildService is used for building the binaries instead of a client for the BuildServiceURL, for
+	// example, for using another transport or a mock in tests. When it is set, the settings for the build
+	// service client (URLs, authorization and headers) are ignored. The URLs of the artifacts it returns
+	// must be absolute
+	BuildService k6build.BuildService
+	// NoCache disables the cache: every call to GetBinary downloads the binary to a new temporary
+	// directory (in TempDir, or the os' tmp dir if not set), even if it was downloaded before.
+	// The binaries are removed when the provider is closed, so each binary uses disk space until
+	// then. BinDir is not used and can't be combined with Offline
+	NoCache bool
+	// BuildQueuedFunc is called when the build service accepts a build request but the binary is
+	// not ready yet (202 Accepted), before waiting to request the build again. The build is requested
+	// until it is ready, the BuildTimeout expires or the MaxQueueWait in Retry is exceeded, waiting
+	// between requests as retries do (see Retry).
+	// If the response has a Retry-After header, the delay it requests is waited instead, up to the
+	// BuildTimeout. The function receives the time to wait
+	BuildQueuedFunc BuildQueuedFunc
+	// InsecureSkipChecksum disables the verification of the checksum of the binaries, for example, for
+	// developing against a local build service that returns placeholder checksums.
+	// This is insecure: a corrupted or tampered binary is not detected. Never enable it in production
+	InsecureSkipChecksum bool
+	// ContentAddressed stores each binary once by its checksum, in the "blobs" directory of BinDir, and
+	// links the binaries of the artifacts with the same checksum to it using hard links. This way, artifacts
+	// resolved to identical binaries (e.g. for the "*" constraint and the latest version) use the disk space
+	// of only one binary, and the binary is not downloaded again. The binary is verified before it is reused.
+	// Has no effect if hard links are not supported by the file system, or InsecureSkipChecksum is enabled
+	ContentAddressed bool
+	// CacheTTL is the time after which a cached binary is checked for a newer build, for dependencies
+	// with floating constraints (e.g. "*" or ">v0.9.0"). If the binary was downloaded before the CacheTTL
+	// and the build service resolves the dependencies to a binary with another checksum, the binary is
+	// downloaded again. Dependencies pinned to exact versions are not checked. Defaults to no expiration
+	CacheTTL time.Duration
+	// CacheCompression is the compression of the binaries stored in the cache: "none" (the default)
+	// or "gzip". Compressed binaries use less disk space, but each binary is decompressed to a
+	// temporary directory (in TempDir, or the os' tmp dir if not set) before it is returned, so every
+	// binary in use also uses its full size, and the first use of a cached binary is slower.
+	// The Path of the binaries returned by GetBinary points to the decompressed copy, which is removed
+	// when the provider is closed: it must not be used after closing the provider, and a link created
+	// by LinkBinary breaks when the provider is closed. The paths returned by ListCached point to the
+	// compressed binaries. The zstd compression is not supported
+	CacheCompression string
+	// BeforeDownload is called with the artifact resolved for the dependencies, before the binary is
+	// obtained, for example, for enforcing a policy on the extensions or the version of k6. It is called
+	// even if the binary is in the cache, so the policy also applies to binaries cached before.
+	// Returning an error aborts obtaining the binary with an [ErrRejected] error that wraps it
+	BeforeDownload BeforeDownloadFunc
+	// AllowedExtensions restricts the extensions of the binaries to those matching any of these glob
+	// patterns (e.g. "k6/x/*" or "github.com/grafana/xk6-sql"). Patterns use the syntax of [path.Match], so
+	// "*" doesn't match "/". Requesting a binary with another extension fails with an [ErrDependency] error.
+	// Defaults to allowing any extension
+	AllowedExtensions []string
+	// DeniedExtensions rejects the extensions matching any of these glob patterns, as AllowedExtensions
+	// does. An extension matching both lists is denied
+	DeniedExtensions []string
+	// StaleIfError returns the binary cached for the same dependencies if the build service is not
+	// available (network errors, 5xx or 429 responses or the BuildTimeout expires), instead of failing.
+	// The binary may not be the one the build service would return now, for example, if a newer version
+	// satisfies the dependencies. These binaries have Stats.Stale set. Can't be used with NoCache
+	StaleIfError bool
+	// EventFunc receives typed events for the activity of the provider: cache hits, builds, downloads
+	// (including their progress) and evictions from the cache, for example, for driving a UI.
+	// Defaults to not reporting events
+	EventFunc EventFunc
+	// EmitChecksumFile writes the verified checksum of the binaries in a file next to them, named after the
+	// binary and the checksum's algorithm (e.g. "k6.sha256"), for verifying them independently. The file has
+	// the format used by tools such as sha256sum. Ignored if InsecureSkipChecksum is set. In a compressed
+	// cache, it is the checksum of the decompressed binary
+	EmitChecksumFile bool
+	// VerifyExecutable runs the "version" command of the downloaded binaries, checking they execute on the
+	// host and report the version of k6 in the resolved dependencies, before adding them to the cache.
+	// Binaries for a platform other than the host's are not checked. Not applied to binaries obtained
+	// with GetBinaryStream.
+	// The binaries are run where they are downloaded: the cache directory, or the TempDir if set. If its
+	// filesystem doesn't allow executing files (e.g. it is mounted with noexec), the check fails with
+	// ErrCannotExecute
+	VerifyExecutable bool
+	// BypassCache builds and downloads the binaries every time, ignoring the binaries in the cache and the
+	// Storage, but still adds the downloaded binaries to the cache. This is useful, for example, for checking
+	// in CI that the dependencies can be built from scratch. Contrary to NoCache, the cache is updated.
+	// Can't be used with NoCache or Offline
+	BypassCache bool
+	// BuildRequestModifier is called with every request to the build service before it is sent, including
+	// retries, for example, for setting headers with values computed for each request, such as trace IDs.
+	// Ignored if BuildService is set
+	BuildRequestModifier RequestModifier
+	// DownloadRequestModifier is called with every request for downloading a binary before it is sent,
+	// including retries and HEAD requests (see HeadPreflight). Not called for binaries copied from the
+	// local file system or the Storage
+	DownloadRequestModifier RequestModifier
+	// ContextHeaders maps keys of the context passed to GetBinary to headers of the requests to the build
+	// service and the download requests, for example, for forwarding a correlation ID as the "X-Request-ID"
+	// header. The values must be strings or implement [fmt.Stringer]. Keys not in the context are ignored.
+	// The headers are set before calling the request modifiers. Build service requests shared by concurrent
+	// calls use the context of the first call. Ignored for build service requests if BuildService is set
+	ContextHeaders map[any]string
+	// SignatureVerifier verifies the signature of the downloaded binaries before adding them to the cache,
+	// for example, using a [NewMinisignVerifier]. Binaries without a valid signature are rejected with an
+	// ErrDownload error. Binaries already in the cache and binaries obtained with GetBinaryStream are not
+	// verified. Defaults to not verifying signatures
+	SignatureVerifier SignatureVerifier
+
+	// clock provides the current time. Defaults to the system's clock. Set by tests using withClock
+	clock clock
 }
 
+// ProgressFunc reports the progress of a download.
+// It can be called concurrently if many binaries are downloaded at the same time.
+type ProgressFunc func(downloaded int64, total int64)
+
+// RequestModifier modifies an HTTP request before it is sent, for example, for adding headers.
+// It can be called concurrently if many requests are sent at the same time.
+type RequestModifier func(req *http.Request)
+
+// BeforeDownloadFunc inspects an artifact before its binary is obtained. Returning an error rejects it.
+// It can be called concurrently if many binaries are obtained at the same time.
+type BeforeDownloadFunc func(artifact k6build.Artifact) error
+
+// BuildQueuedFunc reports a build is queued by the build service and the time
+// to wait before requesting it again
+type BuildQueuedFunc func(wait time.Duration)
+
 // Provider implements an interface for providing custom k6 binaries
 // from a [k6build] service.
 //
+// A Provider is safe for concurrent use by multiple goroutines. Concurrent requests
+// for the same dependencies share a single build, and the binary is downloaded once,
+// even if the cache is shared with other processes. Binaries are never removed from
+// the cache while they are being downloaded.
+//
 // [k6build]: https://github.com/grafana/k6build
 type Provider struct {
-	client   *http.Client
-	binDir   string
-	buildSrv k6build.BuildService
+	providerSettings
 	platform string
+	binary   string
 	pruner   *Pruner
+	config   Config
+	closed   atomic.Bool
+}
+
+// providerSettings holds the settings and the state shared by the providers for
+// each platform, see [Provider.forPlatform]
+type providerSettings struct {
+	client          *http.Client
+	binDir          string
+	buildSrv        k6build.BuildService
+	retry           RetryConfig
+	buildTimeout    time.Duration
+	downloadTimeout time.Duration
+	progress        ProgressFunc
+	maxDownloadRate int64
+	logger          *slog.Logger
+	downloadHeaders http.Header
+	offline         bool
+	verifyOnHit     bool
+	forceRefresh    bool
+	tracer          trace.Tracer
+	tracing         bool
+	metrics         *countingMetrics
+	dirMode         os.FileMode
+	fileMode        os.FileMode
+	cache           Cache
+	storage         Storage
+	verifyFormat    bool
+	headPreflight   bool
+	resumeDownloads bool
+	tempDir         string
+	maxBinarySize   int64
+	noCache         bool
+	uncached        *uncachedBinaries
+	buildQueued     BuildQueuedFunc
+	skipChecksum    bool
+	contentAddr     bool
+	clock           clock
+	cacheTTL        time.Duration
+	compression     string
+	decompressed    *decompressedBinaries
+	beforeDownload  BeforeDownloadFunc
+	allowedExts     []string
+	deniedExts      []string
+	staleIfError    bool
+	events          EventFunc
+	emitChecksum    bool
+	verifyExec      bool
+	bypassCache     bool
+	modifyDownload  RequestModifier
+	contextHeaders  map[any]string
+	sigVerifier     SignatureVerifier
+	builds          *singleflight.Group
 }
 
 // NewDefaultProvider returns a Provider with default settings
@@ -157,19 +582,221 @@ func NewDefaultProvider() (*Provider, error) {
 	return NewProvider(Config{})
 }
 
-// NewProvider returns a [Provider] with the given Options
+// NewProvider returns a [Provider] with the given Options.
+// A [Config] can be passed as an option for setting all the configuration at once.
+//
+// Example:
+//
+//	provider, err := NewProvider(
+//	    WithBuildServiceURL("http://localhost:8000"),
+//	    WithBinDir("/path/to/cache"),
+//	)
 //
 // If BuildServiceURL is not set, it will use the K6_BUILD_SERVICE_URL environment variable
-// If DownloadProxyURL is not set, it will use the K6_DOWNLOAD_PROXY environment variable
-func NewProvider(config Config) (*Provider, error) {
+// If DownloadProxyURL is not set, it will use the K6_DOWNLOAD_PROXY environment variable, or
+// the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+// If HTTPClient is set, it is used for downloads and DownloadProxyURL is ignored
+func NewProvider(opts ...Option) (*Provider, error) {
+	config := Config{}
+	for _, opt := range opts {
+		opt.apply(&config)
+	}
+
+	return newProvider(config)
+}
+
+// newProvider returns a [Provider] with the given configuration
+func newProvider(config Config) (*Provider, error) {
 	binDir := config.BinDir
 	if binDir == "" {
-		binDir = filepath.Join(os.TempDir(), "k6provider", "cache")
+		binDir = defaultBinDir()
+	}
+
+	if config.Namespace != "" {
+		if err := validNamespace(config.Namespace); err != nil {
+			return nil, NewWrappedError(ErrConfig, err)
+		}
+		binDir = filepath.Join(binDir, config.Namespace)
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		var err error
+		httpClient, err = newHTTPClient(config.DownloadProxyURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buildSrv, err := newBuildService(config)
+	if err != nil {
+		return nil, err
+	}
+
+	platform := config.Platform
+	if platform == "" {
+		platform = fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+	} else if !slices.Contains(supportedPlatforms, platform) {
+		return nil, NewWrappedError(
+			ErrConfig,
+			fmt.Errorf("unsupported platform %q. Valid values are %s", platform, strings.Join(supportedPlatforms, ", ")),
+		)
+	}
+
+	name := config.BinaryName
+	if name == "" {
+		name = k6Binary
+	} else if err := validCacheID(name); err != nil {
+		return nil, NewWrappedError(ErrConfig, fmt.Errorf("invalid binary name %q", name))
+	}
+	binary := binaryName(name, platform)
+
+	maxBinarySize := config.MaxBinarySize
+	if maxBinarySize == 0 {
+		maxBinarySize = defaultMaxBinarySize
+	}
+
+	pruneInterval := config.PruneInterval
+	if config.HighWaterMark > 0 && pruneInterval == 0 {
+		pruneInterval = defaultPruneInterval
 	}
 
-	httpClient := http.DefaultClient
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	if config.InsecureSkipChecksum {
+		logger.Warn("checksum verification is disabled, binaries are not verified")
+	}
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
+	clock := config.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	dirMode := config.DirMode
+	if dirMode == 0 {
+		dirMode = defaultDirMode
+	}
+
+	fileMode := config.FileMode
+	if fileMode == 0 {
+		fileMode = defaultFileMode
+	}
+
+	if err := validateCompression(config.CacheCompression); err != nil {
+		return nil, NewWrappedError(ErrConfig, err)
+	}
+	cachedBinary := cachedName(binary, config.CacheCompression)
+
+	if err := validatePatterns(append(slices.Clone(config.AllowedExtensions), config.DeniedExtensions...)); err != nil {
+		return nil, NewWrappedError(ErrConfig, err)
+	}
+
+	if config.NoCache && config.Offline {
+		return nil, NewWrappedError(ErrConfig, errors.New("offline mode requires the cache, it can't be used with NoCache"))
+	}
+
+	if config.NoCache && config.StaleIfError {
+		return nil, NewWrappedError(ErrConfig, errors.New("StaleIfError requires the cache, it can't be used with NoCache"))
+	}
+
+	if config.BypassCache && (config.NoCache || config.Offline) {
+		return nil, NewWrappedError(ErrConfig, errors.New("BypassCache can't be used with NoCache or Offline"))
+	}
+
+	// in offline mode, the cache can be read-only, for example, a cache prepared in advance
+	if !config.Offline && !config.NoCache {
+		if err := checkWritable(binDir, dirMode); err != nil {
+			return nil, NewWrappedError(ErrConfig, err)
+		}
+	}
+
+	pruner := newPruner(
+		platformDir(binDir, platform), cachedBinary, config.HighWaterMark, pruneInterval, clock, config.EventFunc,
+	)
+
+	provider := &Provider{
+		providerSettings: providerSettings{
+			client:          httpClient,
+			binDir:          binDir,
+			buildSrv:        buildSrv,
+			retry:           config.Retry.withDefaults(),
+			buildTimeout:    config.BuildTimeout,
+			downloadTimeout: config.DownloadTimeout,
+			progress:        config.ProgressFunc,
+			maxDownloadRate: config.MaxDownloadBytesPerSec,
+			logger:          logger,
+			downloadHeaders: downloadHeaders(config),
+			offline:         config.Offline,
+			verifyOnHit:     config.VerifyOnHit,
+			forceRefresh:    config.ForceRefresh,
+			tracer:          newTracer(config.TracerProvider),
+			tracing:         config.TracerProvider != nil,
+			metrics:         &countingMetrics{Metrics: metrics},
+			dirMode:         dirMode,
+			fileMode:        fileMode,
+			cache:           config.Cache,
+			storage:         config.Storage,
+			verifyFormat:    config.VerifyFormat,
+			headPreflight:   config.HeadPreflight,
+			resumeDownloads: config.ResumeDownloads,
+			tempDir:         config.TempDir,
+			maxBinarySize:   maxBinarySize,
+			noCache:         config.NoCache,
+			uncached:        &uncachedBinaries{},
+			buildQueued:     config.BuildQueuedFunc,
+			skipChecksum:    config.InsecureSkipChecksum,
+			contentAddr:     config.ContentAddressed,
+			clock:           clock,
+			cacheTTL:        config.CacheTTL,
+			compression:     config.CacheCompression,
+			decompressed:    &decompressedBinaries{},
+			beforeDownload:  config.BeforeDownload,
+			allowedExts:     config.AllowedExtensions,
+			deniedExts:      config.DeniedExtensions,
+			staleIfError:    config.StaleIfError,
+			events:          config.EventFunc,
+			emitChecksum:    config.EmitChecksumFile,
+			verifyExec:      config.VerifyExecutable,
+			bypassCache:     config.BypassCache,
+			modifyDownload:  config.DownloadRequestModifier,
+			contextHeaders:  config.ContextHeaders,
+			sigVerifier:     config.SignatureVerifier,
+			builds:          &singleflight.Group{},
+		},
+		platform: platform,
+		binary:   binary,
+		pruner:   pruner,
+	}
+	provider.config = effectiveConfig(config, provider)
+
+	return provider, nil
+}
+
+// defaultBinDir returns the default directory for the binaries: the k6provider directory in the
+// user's cache directory, which persists across reboots. Falls back to the os' tmp directory.
+func defaultBinDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "k6provider", "cache")
+	}
+	return filepath.Join(cacheDir, "k6provider")
+}
+
+// newHTTPClient returns a client for downloading binaries using the given proxy.
+// If the proxy is not specified, the K6_DOWNLOAD_PROXY environment variable is used and
+// then, the standard proxy environment variables (HTTP_PROXY, HTTPS_PROXY and NO_PROXY).
+func newHTTPClient(proxyURL string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.Proxy = http.ProxyFromEnvironment
 
-	proxyURL := config.DownloadProxyURL
 	if proxyURL == "" {
 		proxyURL = os.Getenv("K6_DOWNLOAD_PROXY")
 	}
@@ -178,58 +805,61 @@ func NewProvider(config Config) (*Provider, error) {
 		if err != nil {
 			return nil, NewWrappedError(ErrConfig, err)
 		}
-		proxy := http.ProxyURL(parsed)
-		transport := &http.Transport{Proxy: proxy}
-		httpClient = &http.Client{Transport: transport}
+		transport.Proxy = http.ProxyURL(parsed)
 	}
 
-	buildSrvURL := config.BuildServiceURL
-	if buildSrvURL == "" {
-		buildSrvURL = os.Getenv("K6_BUILD_SERVICE_URL")
+	return &http.Client{Transport: transport}, nil
+}
+
+// downloadHeaders returns the headers for the download requests, including the authorization
+// header if credentials are specified in the configuration or the K6_DOWNLOAD_AUTH environment variable
+func downloadHeaders(config Config) http.Header {
+	headers := http.Header{}
+	for h, v := range config.DownloadHeaders {
+		headers.Add(h, v)
 	}
-	if buildSrvURL == "" {
-		return nil, NewWrappedError(ErrConfig, fmt.Errorf("build service URL is required"))
+	if headers.Get("User-Agent") == "" {
+		headers.Set("User-Agent", userAgent(config))
 	}
 
-	buildSrvAuth := config.BuildServiceAuth
-	if buildSrvAuth == "" {
-		buildSrvAuth = os.Getenv("K6_BUILD_SERVICE_AUTH")
+	auth := config.DownloadAuth
+	if auth == "" {
+		auth = os.Getenv("K6_DOWNLOAD_AUTH")
 	}
-
-	buildSrvAuthType := config.BuildServiceAuthType
-	if buildSrvAuthType == "" && buildSrvAuth != "" {
-		buildSrvAuthType = "Bearer"
+	if auth != "" {
+		authType := config.DownloadAuthType
+		if authType == "" {
+			authType = defaultAuthType
+		}
+		headers.Set("Authorization", fmt.Sprintf("%s %s", authType, auth))
 	}
 
-	buildSrv, err := client.NewBuildServiceClient(
-		client.BuildServiceClientConfig{
-			URL:               buildSrvURL,
-			Authorization:     buildSrvAuth,
-			AuthorizationType: buildSrvAuthType,
-			Headers:           config.BuildServiceHeaders,
-		},
-	)
-	if err != nil {
-		return nil, NewWrappedError(ErrConfig, err)
+	return headers
+}
+
+// userAgent returns the User-Agent for the requests to the build service and the downloads
+func userAgent(config Config) string {
+	if config.UserAgent != "" {
+		return config.UserAgent
 	}
+	return "k6provider/" + moduleVersion()
+}
 
-	platform := config.Platform
-	if platform == "" {
-		platform = fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+// moduleVersion returns the version of this module in the running binary, or "devel" if it is
+// not available (e.g. when running tests)
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
 	}
 
-	pruneInterval := config.PruneInterval
-	if config.HighWaterMark > 0 && pruneInterval == 0 {
-		pruneInterval = defaultPruneInterval
+	for _, mod := range append([]*debug.Module{&info.Main}, info.Deps...) {
+		if mod.Path == modulePath && mod.Version != "" && mod.Version != "(devel)" {
+			return mod.Version
+		}
 	}
 
-	return &Provider{
-		client:   httpClient,
-		binDir:   binDir,
-		buildSrv: buildSrv,
-		platform: platform,
-		pruner:   NewPruner(binDir, config.HighWaterMark, pruneInterval),
-	}, nil
+	return "devel"
 }
 
 // GetBinary returns a custom k6 binary that satisfies the given a set of dependencies.
@@ -251,120 +881,1241 @@ func (p *Provider) GetBinary(
 	ctx context.Context,
 	deps k6deps.Dependencies,
 ) (K6Binary, error) {
-	k6Constrains, buildDeps := buildDeps(deps)
+	ctx, span := p.tracer.Start(
+		ctx,
+		"k6provider.GetBinary",
+		trace.WithAttributes(attrPlatform.String(p.platform)),
+	)
+
+	binary, err := p.getBinary(ctx, deps)
+	if err == nil {
+		span.SetAttributes(attrCacheHit.Bool(binary.Stats.CacheHit), attrBytes.Int64(binary.Stats.Size))
+	}
+	endSpan(span, err)
+
+	return binary, err
+}
+
+// getBinary implements GetBinary
+func (p *Provider) getBinary(
+	ctx context.Context,
+	deps k6deps.Dependencies,
+) (K6Binary, error) {
+	if p.closed.Load() {
+		return K6Binary{}, ErrClosed
+	}
 
-	artifact, err := p.buildSrv.Build(ctx, p.platform, k6Constrains, buildDeps)
+	buildStart := p.clock.Now()
+	artifact, stale, err := p.resolve(ctx, deps)
 	if err != nil {
-		if !errors.Is(err, ErrInvalidParameters) {
-			return K6Binary{}, NewWrappedError(ErrBuild, err)
-		}
+		return K6Binary{}, err
+	}
 
-		// it is an invalid build parameters, we are interested in the
-		// root cause
-		cause := errors.Unwrap(err)
-		for errors.Unwrap(cause) != nil {
-			cause = errors.Unwrap(cause)
-		}
-		return K6Binary{}, NewWrappedError(ErrInvalidParameters, cause)
+	stats := BinaryStats{BuildDuration: p.clock.Since(buildStart), Stale: stale}
+
+	trace.SpanFromContext(ctx).SetAttributes(attrArtifactID.String(artifact.ID))
+
+	if err = p.checkArtifact(artifact); err != nil {
+		return K6Binary{}, err
 	}
 
-	artifactDir := filepath.Join(p.binDir, artifact.ID)
-	binPath := filepath.Join(artifactDir, k6Binary)
-	_, err = os.Stat(binPath)
+	log := p.logger.With(
+		slog.String("artifact_id", artifact.ID),
+		slog.String("platform", artifact.Platform),
+		slog.String("checksum", artifact.Checksum),
+	)
+
+	if p.noCache {
+		return p.downloadUncached(ctx, log, artifact, stats)
+	}
+
+	artifactDir := filepath.Join(p.cacheDir(), artifact.ID)
+	binPath := filepath.Join(artifactDir, cachedName(p.binary, p.compression))
+	binInfo, err := p.statCached(ctx, log, artifactDir, binPath, artifact.Checksum)
+
+	// binary already exists. Stale binaries are not refreshed, as the build service is not available
+	if err == nil && !p.bypassCache && (stale || !p.forceRefresh && !p.stale(artifactDir, artifact, deps)) {
+		log.Debug("cache hit", slog.String("path", binPath))
+		p.metrics.IncCacheHit()
+
+		if err = p.repairMode(log, binPath, binInfo); err != nil {
+			return K6Binary{}, NewWrappedError(ErrBinary, err)
+		}
 
-	// binary already exists
-	if err == nil {
 		go p.pruner.Touch(binPath)
 
-		return K6Binary{
-			Path:         binPath,
-			Dependencies: artifact.Dependencies,
-			Checksum:     artifact.Checksum,
-		}, nil
+		stats.CacheHit = true
+		stats.Size = binInfo.Size()
+		p.emit(Event{Kind: EventCacheHit, ArtifactID: artifact.ID, Bytes: stats.Size})
+
+		return p.executable(cachedBinary(artifactDir, binPath, artifact, stats))
 	}
 
 	// other error
-	if !os.IsNotExist(err) {
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("checking binary", slog.String("error", err.Error()))
 		return K6Binary{}, NewWrappedError(ErrBinary, err)
 	}
 
-	// binary doesn't exists
-	err = os.MkdirAll(artifactDir, 0o700)
+	refresh := err == nil
+	if refresh {
+		log.Debug("refreshing cached binary", slog.String("path", binPath))
+	} else {
+		log.Debug("cache miss", slog.String("path", binPath))
+		p.metrics.IncCacheMiss()
+	}
+
+	downloadStart := p.clock.Now()
+	downloaded, err := p.downloadArtifact(ctx, artifact, artifactDir, binPath, refresh)
 	if err != nil {
-		return K6Binary{}, NewWrappedError(ErrBinary, err)
+		log.Error("downloading binary", slog.String("error", err.Error()))
+		return K6Binary{}, err
 	}
 
-	target, err := os.OpenFile( //nolint:gosec
-		binPath,
-		os.O_WRONLY|os.O_CREATE,
-		syscall.S_IRUSR|syscall.S_IXUSR|syscall.S_IWUSR,
-	)
+	binInfo, err = os.Stat(binPath)
 	if err != nil {
 		return K6Binary{}, NewWrappedError(ErrBinary, err)
 	}
+	stats.Size = binInfo.Size()
 
-	err = p.download(ctx, artifact.URL, target)
-	if err != nil {
-		_ = os.RemoveAll(artifactDir)
-		return K6Binary{}, NewWrappedError(ErrDownload, err)
+	// the binary could have been downloaded concurrently or not modified since it was cached
+	if !downloaded {
+		if refresh {
+			p.metrics.IncCacheHit()
+		}
+		stats.CacheHit = true
+		p.emit(Event{Kind: EventCacheHit, ArtifactID: artifact.ID, Bytes: stats.Size})
+		return p.executable(cachedBinary(artifactDir, binPath, artifact, stats))
 	}
 
-	_ = target.Close()
+	stats.DownloadDuration = p.clock.Since(downloadStart)
 
 	// start pruning in background
 	// TODO: handle case the calling process is cancelled
-	go p.pruner.Prune() //nolint:errcheck
+	go p.prune()
 
-	return K6Binary{
+	return p.executable(K6Binary{
 		Path:         binPath,
 		Dependencies: artifact.Dependencies,
+		K6Version:    k6Version(artifact.Dependencies),
 		Checksum:     artifact.Checksum,
-	}, nil
+		ArtifactID:   artifact.ID,
+		URL:          artifact.URL,
+		Stats:        stats,
+	})
 }
 
-func (p *Provider) download(ctx context.Context, from string, dest io.Writer) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, from, nil)
+// statCached returns the file info of the cached binary.
+// Binaries for other platforms and, if VerifyOnHit is enabled, corrupted binaries are removed
+// and reported as not existing.
+//
+// Invalid binaries are removed holding the artifact's lock, so a binary being downloaded
+// concurrently is never removed.
+func (p *Provider) statCached(
+	ctx context.Context,
+	log *slog.Logger,
+	artifactDir string,
+	binPath string,
+	checksum string,
+) (os.FileInfo, error) {
+	binInfo, err := os.Stat(binPath)
 	if err != nil {
-		return err
+		return binInfo, err
 	}
 
-	resp, err := p.client.Do(req)
+	err = p.checkCached(artifactDir, binPath, checksum)
+	if !errors.Is(err, errInvalidCached) {
+		return binInfo, err
+	}
+
+	lock := newArtifactLock(p.cacheDir(), filepath.Base(artifactDir))
+	if err = lock.lockWait(ctx); err != nil {
+		return binInfo, err
+	}
+	defer func() {
+		_ = lock.release()
+	}()
+
+	// the binary could have been replaced while waiting for the lock
+	binInfo, err = os.Stat(binPath)
 	if err != nil {
-		return err
+		return binInfo, err
+	}
+
+	err = p.checkCached(artifactDir, binPath, checksum)
+	if errors.Is(err, errInvalidCached) {
+		log.Warn("removing invalid binary from cache", slog.String("error", err.Error()))
+		err = os.Remove(binPath)
+		if err == nil {
+			err = os.ErrNotExist
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status %s", resp.Status)
+	return binInfo, err
+}
+
+// repairMode restores the permissions of a cached binary without execute bits, for example, because
+// the cache was copied with a tool that doesn't preserve them. Compressed binaries are not executed
+// and windows doesn't use the execute bits, so their permissions are not checked.
+func (p *Provider) repairMode(log *slog.Logger, binPath string, binInfo os.FileInfo) error {
+	if p.compression == CompressionGzip || runtime.GOOS == "windows" || binInfo.Mode().Perm()&0o111 != 0 {
+		return nil
+	}
+
+	log.Warn("restoring permissions of cached binary", slog.String("mode", binInfo.Mode().Perm().String()))
+
+	return os.Chmod(binPath, p.fileMode)
+}
+
+// checkCached checks the cached binary is for the provider's platform and, if VerifyOnHit
+// is enabled, is not corrupted. Returns errInvalidCached otherwise.
+func (p *Provider) checkCached(artifactDir, binPath, checksum string) error {
+	// binaries cached by previous versions don't have a manifest
+	if m, err := readManifest(artifactDir); err == nil && m.Platform != "" && m.Platform != p.platform {
+		return fmt.Errorf("%w: binary for platform %s", errInvalidCached, m.Platform)
 	}
 
-	defer resp.Body.Close() //nolint:errcheck
+	if !p.verifyOnHit || p.skipChecksum {
+		return nil
+	}
 
-	_, err = io.Copy(dest, resp.Body)
+	err := verifyBinary(artifactDir, binPath, checksum)
+	if errors.Is(err, errChecksumMismatch) {
+		return fmt.Errorf("%w: corrupted binary: %w", errInvalidCached, err)
+	}
 
 	return err
 }
 
-// buildDeps takes a set of k6 dependencies and returns a string representing
-// the version constraints for the k6 and a slice of k6build.Dependencies
-// representing the extension dependencies. The default k6 constrain is "*".
-func buildDeps(deps k6deps.Dependencies) (string, []k6build.Dependency) {
-	bdeps := make([]k6build.Dependency, 0, len(deps))
-	k6constraint := "*"
+// checkArtifact calls the BeforeDownload hook, if any, with the artifact
+func (p *Provider) checkArtifact(artifact k6build.Artifact) error {
+	if p.beforeDownload == nil {
+		return nil
+	}
 
-	for _, dep := range deps {
-		if dep.Name == k6Module {
-			k6constraint = dep.GetConstraints().String()
-			continue
+	if err := p.beforeDownload(artifact); err != nil {
+		return NewWrappedError(ErrRejected, err)
+	}
+
+	return nil
+}
+
+// stale returns true if the cached binary was downloaded before the CacheTTL and the build service
+// resolved the dependencies to a different binary. Binaries for dependencies pinned to exact versions
+// always resolve to the same binary, so they are never stale.
+func (p *Provider) stale(artifactDir string, artifact k6build.Artifact, deps k6deps.Dependencies) bool {
+	if p.cacheTTL <= 0 || pinned(deps) {
+		return false
+	}
+
+	// binaries cached by previous versions don't have a manifest
+	m, err := readManifest(artifactDir)
+	if err != nil || m.Downloaded.IsZero() {
+		return false
+	}
+
+	return p.clock.Since(m.Downloaded) > p.cacheTTL && !strings.EqualFold(m.Checksum, artifact.Checksum)
+}
+
+// cachedBinary returns a binary found in the cache, using the dependencies and checksum
+// recorded in its manifest
+func cachedBinary(artifactDir, binPath string, artifact k6build.Artifact, stats BinaryStats) K6Binary {
+	// binaries cached by previous versions don't have a manifest
+	if m, err := readManifest(artifactDir); err == nil {
+		artifact.Dependencies = m.Dependencies
+		artifact.Checksum = m.Checksum
+	}
+
+	return K6Binary{
+		Path:         binPath,
+		Dependencies: artifact.Dependencies,
+		K6Version:    k6Version(artifact.Dependencies),
+		Checksum:     artifact.Checksum,
+		ArtifactID:   artifact.ID,
+		URL:          artifact.URL,
+		Stats:        stats,
+	}
+}
+
+// cacheDir returns the directory for the binaries of the provider's platform
+func (p *Provider) cacheDir() string {
+	return platformDir(p.binDir, p.platform)
+}
+
+// platformDir returns the directory in the cache for the binaries of a platform (in the os/arch form),
+// for example "linux-amd64". Keeping the binaries of each platform apart prevents using a binary
+// for another platform, even if the build service used the same artifact ID for both.
+func platformDir(binDir string, platform string) string {
+	return filepath.Join(binDir, strings.ReplaceAll(platform, "/", "-"))
+}
+
+// validNamespace checks the namespace is a valid directory name that doesn't collide with the
+// entries of the cache of a provider without namespace in the same BinDir: the platform directories
+// (e.g. "linux-amd64"), the blobs directory and the resolution files (*.json). Otherwise, the cache
+// operations of that provider, such as PruneCache, would affect the binaries in the namespace.
+// Names are compared ignoring case, as the filesystem may be case-insensitive.
+func validNamespace(namespace string) error {
+	if err := validCacheID(namespace); err != nil {
+		return fmt.Errorf("invalid namespace %q", namespace)
+	}
+
+	reserved := strings.EqualFold(namespace, blobsDir) || strings.HasSuffix(strings.ToLower(namespace), ".json")
+	for _, platform := range supportedPlatforms {
+		reserved = reserved || strings.EqualFold(namespace, filepath.Base(platformDir("", platform)))
+	}
+	if reserved {
+		return fmt.Errorf("invalid namespace %q: the name is reserved for the cache", namespace)
+	}
+
+	return nil
+}
+
+// Close releases the resources used by the provider, such as idle connections and locks.
+// If NoCache is enabled, the binaries obtained with the provider are removed.
+// After closing the provider, GetBinary returns [ErrClosed].
+// Closing a provider more than once has no effect.
+func (p *Provider) Close() error {
+	if p.closed.Swap(true) {
+		return nil
+	}
+
+	p.client.CloseIdleConnections()
+
+	return errors.Join(p.uncached.removeAll(), p.pruner.dirLock.unlock())
+}
+
+// PruneCache removes the binaries for the provider's platform in the cache that were not used
+// in the given period, and returns the number of bytes freed.
+// Passing zero removes all binaries. Binaries being downloaded are not removed.
+//
+// The last use of a binary is tracked only if the HighWaterMark is set.
+// Otherwise, the time the binary was downloaded is used.
+func (p *Provider) PruneCache(ctx context.Context, olderThan time.Duration) (int64, error) {
+	freed, err := p.pruner.PruneOlderThan(ctx, olderThan)
+	if blobsErr := p.pruneBlobs(); blobsErr != nil {
+		err = errors.Join(err, fmt.Errorf("%w: %w", ErrPruningCache, blobsErr))
+	}
+
+	return freed, err
+}
+
+// prune prunes the cache if the HighWaterMark is exceeded, and removes the blobs
+// of the pruned binaries
+func (p *Provider) prune() {
+	if p.pruner.Prune() == nil && p.pruner.hwm > 0 {
+		_ = p.pruneBlobs()
+	}
+}
+
+// resolve returns the artifact that satisfies the dependencies.
+//
+// The artifact is obtained from the build service and the resolution is recorded in the
+// cache directory. In offline mode, the previously recorded resolution is used instead.
+// With StaleIfError, the recorded resolution is also used if the build service is not
+// available, reporting the artifact as stale.
+func (p *Provider) resolve(ctx context.Context, deps k6deps.Dependencies) (k6build.Artifact, bool, error) {
+	k6Constrains, buildDeps, err := p.checkedDeps(deps)
+	if err != nil {
+		return k6build.Artifact{}, false, err
+	}
+	requestID := fingerprint(p.platform, k6Constrains, buildDeps)
+
+	if p.offline {
+		artifact, err := p.cachedResolution(requestID)
+		return artifact, false, err
+	}
+
+	artifact, err := p.sharedBuild(ctx, k6Constrains, buildDeps)
+	if err != nil && p.staleIfError && isTransientBuildError(ctx, err) {
+		cached, cachedErr := p.cachedResolution(requestID)
+		if cachedErr != nil {
+			return k6build.Artifact{}, false, err
 		}
 
-		bdeps = append(
-			bdeps,
-			k6build.Dependency{
-				Name:        dep.Name,
-				Constraints: dep.GetConstraints().String(),
-			},
+		p.logger.Warn(
+			"build service not available, using cached binary",
+			slog.String("artifact_id", cached.ID),
+			slog.String("error", err.Error()),
 		)
+		return cached, true, nil
+	}
+	if err != nil {
+		return k6build.Artifact{}, false, err
+	}
+
+	if p.noCache {
+		return artifact, false, nil
+	}
+
+	// recording the resolution is best-effort, it only affects the offline mode and StaleIfError
+	if err := saveResolution(p.binDir, requestID, artifact, p.dirMode, p.fileMode&^0o111); err != nil {
+		p.logger.Warn("recording resolution", slog.String("error", err.Error()))
+	}
+
+	return artifact, false, nil
+}
+
+// cachedResolution returns the artifact previously resolved for the build request, if its
+// binary is in the cache. Otherwise, returns an [ErrNotCached] error.
+func (p *Provider) cachedResolution(requestID string) (k6build.Artifact, error) {
+	artifact, err := loadResolution(p.binDir, requestID)
+	if errors.Is(err, os.ErrNotExist) {
+		return k6build.Artifact{}, NewWrappedError(ErrBinary, ErrNotCached)
+	}
+	if err != nil {
+		return k6build.Artifact{}, NewWrappedError(ErrBinary, err)
 	}
 
-	return k6constraint, bdeps
+	_, err = os.Stat(filepath.Join(p.cacheDir(), artifact.ID, cachedName(p.binary, p.compression)))
+	if errors.Is(err, os.ErrNotExist) {
+		return k6build.Artifact{}, NewWrappedError(ErrBinary, ErrNotCached)
+	}
+	if err != nil {
+		return k6build.Artifact{}, NewWrappedError(ErrBinary, err)
+	}
+
+	return artifact, nil
+}
+
+// sharedBuild requests the build service an artifact that satisfies the dependencies, sharing
+// the request with any concurrent request for the same platform and dependencies.
+//
+// If the caller that issued the shared request cancels it, the request is issued again for
+// the other callers.
+func (p *Provider) sharedBuild(
+	ctx context.Context,
+	k6Constrains string,
+	buildDeps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	key := fingerprint(p.platform, k6Constrains, buildDeps)
+	for {
+		if err := ctx.Err(); err != nil {
+			return k6build.Artifact{}, NewWrappedError(ErrBuild, err)
+		}
+
+		result := p.builds.DoChan(key, func() (any, error) {
+			return p.build(ctx, k6Constrains, buildDeps)
+		})
+
+		select {
+		case <-ctx.Done():
+			return k6build.Artifact{}, NewWrappedError(ErrBuild, ctx.Err())
+		case res := <-result:
+			if res.Shared && errors.Is(res.Err, context.Canceled) && ctx.Err() == nil {
+				continue
+			}
+			artifact, _ := res.Val.(k6build.Artifact)
+			return artifact, res.Err
+		}
+	}
+}
+
+// build requests the build service an artifact that satisfies the dependencies
+func (p *Provider) build(
+	ctx context.Context,
+	k6Constrains string,
+	buildDeps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	buildCtx, cancel := withTimeout(ctx, p.buildTimeout)
+	defer cancel()
+
+	buildCtx, span := p.tracer.Start(
+		buildCtx,
+		"k6provider.build",
+		trace.WithAttributes(attrPlatform.String(p.platform)),
+	)
+	var err error
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	log := p.logger.With(slog.String("platform", p.platform))
+	log.Debug("build started", slog.String("k6", k6Constrains))
+	p.emit(Event{Kind: EventBuildStarted})
+	start := p.clock.Now()
+
+	// builds queued by the build service are polled until they are ready
+	queued := func(wait time.Duration) {
+		log.Debug("build queued, waiting", slog.Duration("wait", wait))
+		if p.buildQueued != nil {
+			p.buildQueued(wait)
+		}
+	}
+
+	var artifact k6build.Artifact
+	defer func() {
+		p.emit(Event{Kind: EventBuildCompleted, ArtifactID: artifact.ID, Duration: p.clock.Since(start), Err: err})
+	}()
+
+	err = poll(buildCtx, p.clock, p.retry, isBuildQueued, queued, func() error {
+		return retry(buildCtx, p.clock, p.retry, isRetryableBuildError, func() error {
+			var buildErr error
+			artifact, buildErr = p.buildSrv.Build(buildCtx, p.platform, k6Constrains, buildDeps)
+			return buildErr
+		})
+	})
+	if err != nil {
+		log.Error("build failed", slog.String("error", err.Error()))
+		p.metrics.IncBuildFailure()
+
+		if !isUnsatisfiableBuildError(err) {
+			return k6build.Artifact{}, NewWrappedError(ErrBuild, err)
+		}
+
+		if !errors.Is(err, ErrInvalidParameters) {
+			return k6build.Artifact{}, NewWrappedError(ErrBuild, NewWrappedError(ErrBuildUnsatisfiable, err))
+		}
+
+		// it is an invalid build parameters, we are interested in the
+		// root cause
+		cause := errors.Unwrap(err)
+		for errors.Unwrap(cause) != nil {
+			cause = errors.Unwrap(cause)
+		}
+		return k6build.Artifact{}, NewWrappedError(
+			ErrBuild,
+			NewWrappedError(ErrBuildUnsatisfiable, NewWrappedError(ErrInvalidParameters, cause)),
+		)
+	}
+
+	span.SetAttributes(attrArtifactID.String(artifact.ID))
+
+	// the binary can't be downloaded from an invalid URL, even if the build succeeded. The ID is
+	// used as the name of the artifact's directory, which must be inside the cache directory
+	err = validateArtifactURL(artifact.URL)
+	if err == nil {
+		err = validCacheID(artifact.ID)
+	}
+	if err != nil {
+		log.Error("build failed", slog.String("error", err.Error()))
+		p.metrics.IncBuildFailure()
+		return k6build.Artifact{}, NewWrappedError(ErrBuild, err)
+	}
+
+	duration := p.clock.Since(start)
+	p.metrics.ObserveBuildDuration(duration)
+
+	log.Info(
+		"build completed",
+		slog.String("artifact_id", artifact.ID),
+		slog.String("checksum", artifact.Checksum),
+		slog.Duration("duration", duration),
+	)
+
+	return artifact, nil
+}
+
+// verifyDownloaded checks the binary downloaded to the given path, and makes it executable.
+// The errors returned are already wrapped with ErrDownload or ErrBinary, except ErrCannotExecute.
+func (p *Provider) verifyDownloaded(
+	ctx context.Context,
+	log *slog.Logger,
+	artifact k6build.Artifact,
+	path string,
+) error {
+	if p.verifyFormat {
+		if err := checkFormat(path, p.platform); err != nil {
+			return NewWrappedError(ErrDownload, err)
+		}
+	}
+
+	if err := p.checkSignature(ctx, path, artifact.URL); err != nil {
+		return NewWrappedError(ErrDownload, err)
+	}
+
+	if err := os.Chmod(path, p.fileMode); err != nil {
+		return NewWrappedError(ErrBinary, err)
+	}
+
+	if p.verifyExec {
+		err := checkExecutable(ctx, path, p.platform, k6Version(artifact.Dependencies))
+		if errors.Is(err, ErrCannotExecute) {
+			return err
+		}
+		if err != nil {
+			return NewWrappedError(ErrDownload, err)
+		}
+	}
+
+	log.Debug("binary verified", slog.String("path", path))
+
+	return nil
+}
+
+// downloadArtifact downloads the artifact's binary to the binPath.
+//
+// Concurrent downloads of the same artifact, either from this process or from other processes
+// sharing the cache directory, are serialized using a lock file. Waiting for the lock is cancelled
+// if the context is done. If the binary was downloaded while waiting, it is not downloaded again.
+// Returns a boolean indicating if the binary was downloaded.
+func (p *Provider) downloadArtifact(
+	ctx context.Context,
+	artifact k6build.Artifact,
+	artifactDir string,
+	binPath string,
+	refresh bool,
+) (bool, error) {
+	err := os.MkdirAll(p.cacheDir(), p.dirMode)
+	if err != nil {
+		return false, NewWrappedError(ErrBinary, err)
+	}
+
+	lock := newArtifactLock(p.cacheDir(), artifact.ID)
+	err = lock.lockWait(ctx)
+	if err != nil && ctx.Err() != nil {
+		return false, NewWrappedError(ErrDownload, err)
+	}
+	if err != nil {
+		return false, NewWrappedError(ErrBinary, err)
+	}
+	defer func() {
+		_ = lock.release()
+	}()
+
+	// the binary was downloaded while waiting for the lock
+	var cached validators
+	_, err = os.Stat(binPath)
+	if err == nil {
+		if !refresh {
+			return false, nil
+		}
+		// bypassing the cache, the binary is downloaded again even if it was not modified
+		if m, err := readManifest(artifactDir); err == nil && !p.bypassCache {
+			cached = validators{etag: m.ETag, lastModified: m.LastModified}
+		}
+	}
+
+	// a binary with the same checksum, obtained for another artifact, is reused
+	if !refresh && !p.bypassCache && p.linkBlob(artifact, artifactDir, binPath) {
+		p.logger.Debug("binary found by checksum", slog.String("artifact_id", artifact.ID))
+		return false, nil
+	}
+
+	// removes any file created for the download. A failed refresh keeps the binary already in the cache.
+	// A partial download that can be resumed is also kept
+	tmpPath := ""
+	keepPartial := false
+	cleanup := func() {
+		if tmpPath != "" && !keepPartial {
+			_ = os.Remove(tmpPath)
+		}
+		if !refresh && (!keepPartial || p.tempDir != "") {
+			_ = os.RemoveAll(artifactDir)
+		}
+	}
+
+	// a refresh is checked using a conditional request
+	expected := int64(-1)
+	if p.headPreflight && cached == (validators{}) {
+		expected, err = p.preflight(ctx, artifact.URL)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = os.MkdirAll(artifactDir, p.dirMode)
+	if err != nil {
+		cleanup()
+		return false, NewWrappedError(ErrBinary, err)
+	}
+
+	// download to a temporary file and move it to its final path only when complete.
+	// This way, an interrupted download never leaves a partial binary in the cache.
+	target, err := p.createTarget(artifactDir, binPath, refresh)
+	if err != nil {
+		cleanup()
+		return false, NewWrappedError(ErrBinary, err)
+	}
+	tmpPath = target.Name()
+
+	if ctx.Err() != nil {
+		_ = target.Close()
+		cleanup()
+		return false, NewWrappedError(ErrDownload, ctx.Err())
+	}
+
+	downloadCtx, cancel := withTimeout(ctx, p.downloadTimeout)
+	defer cancel()
+
+	downloadCtx, span := p.tracer.Start(
+		downloadCtx,
+		"k6provider.download",
+		trace.WithAttributes(attrPlatform.String(p.platform), attrArtifactID.String(artifact.ID)),
+	)
+
+	log := p.logger.With(slog.String("artifact_id", artifact.ID), slog.String("url", artifact.URL))
+	log.Debug("download started")
+	p.emit(Event{Kind: EventDownloadStarted, ArtifactID: artifact.ID})
+	start := p.clock.Now()
+
+	size, current, upload, err := p.fetch(downloadCtx, log, artifact, cached, expected, target)
+	_ = target.Close()
+	p.downloadCompleted(artifact.ID, size, p.clock.Since(start), err)
+	span.SetAttributes(attrBytes.Int64(size))
+	endSpan(span, err)
+	if errors.Is(err, errNotModified) {
+		log.Debug("cached binary not modified")
+		cleanup()
+		return false, nil
+	}
+	if errors.Is(err, errInsufficientSpace) {
+		cleanup()
+		return false, NewWrappedError(ErrBinary, err)
+	}
+	if err != nil {
+		keepPartial = p.resumeDownloads && !refresh &&
+			!errors.Is(err, errChecksumMismatch) && !errors.Is(err, errBinaryTooLarge)
+		cleanup()
+		return false, NewWrappedError(ErrDownload, err)
+	}
+
+	duration := p.clock.Since(start)
+	p.metrics.ObserveDownloadDuration(duration)
+	p.metrics.AddDownloadedBytes(size)
+
+	log.Info("download completed", slog.Int64("bytes", size), slog.Duration("duration", duration))
+
+	err = p.verifyDownloaded(downloadCtx, log, artifact, target.Name())
+	if err != nil {
+		cleanup()
+		return false, err
+	}
+
+	// the binary is shared with other providers only once it is verified
+	if upload {
+		p.uploadStored(downloadCtx, log, artifact, target.Name())
+	}
+
+	// the manifest is written before the binary is moved to its final path, so
+	// any binary in the cache has its manifest
+	m := newManifest(artifact, p.clock.Now())
+	m.ETag = current.etag
+	m.LastModified = current.lastModified
+	err = writeManifest(artifactDir, m, p.fileMode&^0o111)
+	if err != nil {
+		cleanup()
+		return false, NewWrappedError(ErrBinary, err)
+	}
+
+	err = p.writeChecksumFile(artifactDir, artifact.Checksum)
+	if err != nil {
+		cleanup()
+		return false, NewWrappedError(ErrBinary, err)
+	}
+
+	err = p.storeBinary(target.Name(), binPath, artifact.Checksum)
+	if err != nil {
+		cleanup()
+		return false, NewWrappedError(ErrBinary, err)
+	}
+
+	return true, nil
+}
+
+// createTarget creates the file the binary is downloaded to, in the TempDir if it is set.
+// If downloads are resumed, the partial content of a previous download is kept in a file
+// which is reused if it exists. A refresh always starts with an empty file.
+func (p *Provider) createTarget(artifactDir string, binPath string, refresh bool) (*os.File, error) {
+	dir := artifactDir
+	if p.tempDir != "" {
+		dir = p.tempDir
+		if err := os.MkdirAll(dir, p.dirMode); err != nil {
+			return nil, err
+		}
+	}
+
+	// the binary is verified before it is moved to its final path. On Windows, it can only be
+	// executed if its name has the .exe extension
+	if !p.resumeDownloads || refresh {
+		return os.CreateTemp(dir, binaryName(k6Binary+"-*.tmp", p.platform))
+	}
+
+	partialName := strings.TrimSuffix(filepath.Base(binPath), ".exe") + partialSuffix
+	if p.tempDir != "" {
+		// the TempDir can be shared by many caches, so the name must identify the binary's path
+		hash := sha256.Sum256([]byte(binPath))
+		partialName = hex.EncodeToString(hash[:8]) + partialSuffix
+	}
+	partialPath := filepath.Join(dir, binaryName(partialName, p.platform))
+
+	return os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0o600) //nolint:gosec
+}
+
+// validators are the response headers used for checking if a cached binary is up to date
+type validators struct {
+	etag         string
+	lastModified string
+}
+
+// download copies the artifact's binary from its URL into dest, verifying its
+// checksum matches the expected one. Returns the number of bytes downloaded
+// and the validators of the response.
+//
+// If the validators of a cached binary are given, the request is conditional and
+// errNotModified is returned if the binary has not been modified.
+//
+// The expected size of the binary, if known in advance (-1 otherwise), is used when
+// the response doesn't report it.
+//
+// If dest is a file, a download that fails while transferring the binary is retried.
+// The file is truncated before every attempt, so partial content is never kept, unless
+// downloads are resumed. In this case, the content in the file is kept and only the rest of
+// the binary is requested.
+//
+// Binaries referenced by file:// URLs are copied from the local file system.
+func (p *Provider) download(
+	ctx context.Context,
+	artifact k6build.Artifact,
+	cached validators,
+	expected int64,
+	dest io.Writer,
+) (int64, validators, error) {
+	from, checksum := artifact.URL, artifact.Checksum
+	progress := p.progressFunc(artifact.ID)
+
+	if path, isLocal := localPath(from); isLocal {
+		return p.copyLocal(path, checksum, cached, progress, dest)
+	}
+
+	file, resettable := dest.(*os.File)
+
+	var (
+		size    int64
+		current validators
+	)
+	err := retry(ctx, p.clock, p.retry, isRetryable, func() error {
+		offset := int64(0)
+		if resettable {
+			var err error
+			offset, err = p.resumeOffset(file)
+			if err != nil {
+				return err
+			}
+		}
+
+		digest, err := p.newDigest(checksum)
+		if err != nil {
+			return err
+		}
+
+		resp, err := p.requestDownload(ctx, from, cached, offset)
+		if err != nil {
+			return p.handleRangeError(file, offset, err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+
+		current = validators{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+
+		offset, err = seekResumed(file, offset, resp, digest)
+		if err != nil {
+			return err
+		}
+
+		var body io.Reader = resp.Body
+		if resettable {
+			body = retryableReader{reader: body}
+		}
+
+		size, err = p.transfer(ctx, resp, body, offset, expected, checksum, digest, progress, dest)
+		return err
+	})
+	if err != nil {
+		return 0, current, err
+	}
+
+	return size, current, nil
+}
+
+// resumeOffset returns the size of the content already downloaded into the file, if downloads
+// are resumed. Otherwise, discards the content of the file.
+func (p *Provider) resumeOffset(file *os.File) (int64, error) {
+	if !p.resumeDownloads {
+		return 0, resetFile(file)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// handleRangeError discards the partial content of the file if the server can't satisfy the
+// range requested for resuming the download, and marks the error as retryable, so the binary
+// is downloaded again from the start.
+func (p *Provider) handleRangeError(file *os.File, offset int64, err error) error {
+	var downloadErr *DownloadError
+	if offset == 0 || !errors.As(err, &downloadErr) ||
+		downloadErr.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return err
+	}
+
+	if resetErr := resetFile(file); resetErr != nil {
+		return resetErr
+	}
+
+	return retryableError{err: err}
+}
+
+// seekResumed prepares the file for receiving the content of the response, returning the
+// offset the content is written at.
+// If the response has the partial content requested for resuming the download, the content
+// already in the file is added to the hash and the new content is appended.
+// Otherwise, the content of the file is discarded.
+func seekResumed(file *os.File, offset int64, resp *http.Response, digest hash.Hash) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, resetFile(file)
+	}
+
+	// the response must start where the partial content ends
+	var start int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+		if resetErr := resetFile(file); resetErr != nil {
+			return 0, resetErr
+		}
+		return 0, retryableError{err: fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range"))}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(digest, file, offset); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+// requestDownload sends the request for downloading the binary.
+// Returns the response if the binary can be downloaded. Otherwise, returns an error
+// (marked as retryable if it is transient) and closes the response.
+//
+// If the offset is not zero, only the content after the offset is requested.
+func (p *Provider) requestDownload(
+	ctx context.Context,
+	from string,
+	cached validators,
+	offset int64,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, from, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = p.downloadHeaders.Clone()
+	if p.tracing {
+		injectTraceContext(ctx, req.Header)
+	}
+	if cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	injectContextHeaders(ctx, req.Header, p.contextHeaders)
+	if p.modifyDownload != nil {
+		p.modifyDownload(req)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, retryableError{err: err}
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != (validators{}) {
+		_ = resp.Body.Close()
+		return nil, errNotModified
+	}
+
+	if resp.StatusCode != http.StatusOK && (offset == 0 || resp.StatusCode != http.StatusPartialContent) {
+		err = newDownloadError(from, resp)
+		_ = resp.Body.Close()
+		if isRetryableStatus(resp.StatusCode) {
+			return nil, retryableResponseError(err, resp, p.clock.Now())
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// transfer copies the body of the response into dest, verifying its checksum.
+// If the download is resumed, the body is the content after the offset and the
+// hash includes the content before it.
+func (p *Provider) transfer(
+	ctx context.Context,
+	resp *http.Response,
+	body io.Reader,
+	offset int64,
+	expected int64,
+	checksum string,
+	digest hash.Hash,
+	progress ProgressFunc,
+	dest io.Writer,
+) (int64, error) {
+	// the size of encoded responses doesn't correspond to the size of the binary
+	total := resp.ContentLength
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding != "" && encoding != "identity" {
+		total = -1
+	}
+	if total < 0 && expected >= 0 {
+		total = expected - offset
+	}
+
+	err := checkDiskSpace(dest, total)
+	if err != nil {
+		return 0, err
+	}
+
+	if p.maxDownloadRate > 0 {
+		body = newThrottledReader(ctx, body, p.maxDownloadRate)
+	}
+	body, err = decodeBody(body, encoding)
+	if err != nil {
+		return 0, err
+	}
+	if p.maxBinarySize > 0 {
+		if total >= 0 && offset+total > p.maxBinarySize {
+			return 0, fmt.Errorf("%w of %d bytes: binary has %d bytes", errBinaryTooLarge, p.maxBinarySize, offset+total)
+		}
+		body = &limitedReader{reader: body, remaining: p.maxBinarySize - offset, limit: p.maxBinarySize}
+	}
+	if progress != nil {
+		if total >= 0 {
+			total += offset
+		}
+		body = &progressReader{reader: body, read: offset, total: total, progress: progress}
+	}
+
+	return p.copyChecked(dest, body, digest, checksum)
+}
+
+// retryableReader marks the errors reading from the underlying reader as retryable
+type retryableReader struct {
+	reader io.Reader
+}
+
+func (r retryableReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = retryableError{err: err}
+	}
+	return n, err
+}
+
+// limitedReader fails with errBinaryTooLarge if the underlying reader has more than
+// the remaining bytes. Unlike io.LimitReader, exceeding the limit is an error, so a
+// truncated binary is never mistaken for a complete one.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (r *limitedReader) Read(buf []byte) (int, error) {
+	// reading one byte more than the remaining detects when the limit is exceeded
+	if int64(len(buf)) > r.remaining+1 {
+		buf = buf[:r.remaining+1]
+	}
+
+	n, err := r.reader.Read(buf)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, fmt.Errorf("%w of %d bytes", errBinaryTooLarge, r.limit)
+	}
+	return n, err
+}
+
+// resetFile discards the content of the file
+func resetFile(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+// validateArtifactURL checks the URL of an artifact is an absolute http or https URL,
+// or a file URL for a file in the local host
+func validateArtifactURL(artifactURL string) error {
+	if artifactURL == "" {
+		return errors.New("build service returned an artifact without download URL")
+	}
+
+	parsed, err := url.Parse(artifactURL)
+	if err != nil {
+		return fmt.Errorf("build service returned an invalid artifact URL %q: %w", artifactURL, err)
+	}
+
+	if _, isLocal := localPath(artifactURL); isLocal {
+		return nil
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("build service returned an artifact URL that is not an absolute http(s) URL %q", artifactURL)
+	}
+
+	return nil
+}
+
+// k6Version returns the version of k6 in the dependencies of an artifact
+func k6Version(deps map[string]string) string {
+	return strings.TrimSpace(deps[k6Module])
+}
+
+// binaryName returns the name of the binary with the given name for the target platform
+func binaryName(name string, platform string) string {
+	if strings.HasPrefix(platform, "windows/") && !strings.HasSuffix(name, ".exe") {
+		return name + ".exe"
+	}
+	return name
+}
+
+// verifyBinary checks the checksum of a cached binary matches the one recorded in its manifest.
+// If the manifest is not available, the expected checksum is used.
+func verifyBinary(artifactDir string, binPath string, expected string) error {
+	if m, err := readManifest(artifactDir); err == nil {
+		expected = m.Checksum
+	}
+
+	return verifyFile(binPath, expected)
+}
+
+// verifyFile checks the checksum of a file matches the expected one.
+// The checksum of compressed binaries is computed on their decompressed content.
+func verifyFile(path string, expected string) error {
+	file, err := openCached(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	digest, err := newDigest(expected)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(digest, file); err != nil {
+		return err
+	}
+
+	return verifyDigest(digest, expected)
+}
+
+// withTimeout returns a context that is cancelled after the given timeout.
+// If the timeout is zero, the context is only cancelled when the parent context is.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// progressReader reports the progress of reading from the underlying reader
+type progressReader struct {
+	reader   io.Reader
+	read     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.progress(r.read, r.total)
+	}
+	return n, err
+}
+
+// buildDeps takes a set of k6 dependencies and returns a string representing
+// the version constraints for the k6 and a slice of k6build.Dependencies
+// representing the extension dependencies. The default k6 constrain is "*".
+//
+// Dependencies with the same name are merged, intersecting their constraints.
+// Returns an ErrDependency error if any dependency has an empty name, invalid constraints or
+// constraints that are mutually exclusive with those of another dependency with the same name.
+// The error reports all the invalid dependencies.
+func buildDeps(deps k6deps.Dependencies) (string, []k6build.Dependency, error) {
+	k6constraint, bdeps, errs := mergeDeps(deps)
+	if len(errs) > 0 {
+		return "", nil, NewWrappedError(ErrDependency, errors.Join(errs...))
+	}
+
+	return k6constraint, bdeps, nil
+}
+
+// mergeDeps implements buildDeps, returning the problems found in all the dependencies
+func mergeDeps(deps k6deps.Dependencies) (string, []k6build.Dependency, []error) {
+	// dependencies are processed in order so merged constraints are deterministic
+	keys := make([]string, 0, len(deps))
+	for key := range deps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := []error{}
+	merged := map[string]string{}
+	for _, key := range keys {
+		dep := deps[key]
+		if dep == nil {
+			errs = append(errs, fmt.Errorf("%q: missing dependency", key))
+			continue
+		}
+
+		name := strings.TrimSpace(dep.Name)
+		if name == "" {
+			errs = append(errs, fmt.Errorf("%q: empty dependency name", key))
+			continue
+		}
+
+		constraints := dep.GetConstraints().String()
+		if _, err := semver.NewConstraint(constraints); err != nil {
+			errs = append(errs, fmt.Errorf("%q: invalid constraints: %w", name, err))
+			continue
+		}
+
+		if previous, found := merged[name]; found {
+			var err error
+			constraints, err = mergeConstraints(previous, constraints)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%q: %w", name, err))
+				continue
+			}
+		}
+
+		merged[name] = constraints
+	}
+
+	k6constraint := "*"
+	bdeps := make([]k6build.Dependency, 0, len(merged))
+	for name, constraints := range merged {
+		if name == k6Module {
+			k6constraint = constraints
+			continue
+		}
+
+		bdeps = append(
+			bdeps,
+			k6build.Dependency{
+				Name:        name,
+				Constraints: constraints,
+			},
+		)
+	}
+
+	// sort dependencies for making build requests deterministic
+	sort.Slice(bdeps, func(i, j int) bool {
+		return bdeps[i].Name < bdeps[j].Name
+	})
+
+	return k6constraint, bdeps, errs
 }
@@ -1,16 +1,33 @@
 package k6provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
 	"github.com/grafana/k6build/pkg/builder"
 	"github.com/grafana/k6build/pkg/server"
 	"github.com/grafana/k6build/pkg/store/client"
@@ -18,6 +35,8 @@ import (
 	storesrv "github.com/grafana/k6build/pkg/store/server"
 	"github.com/grafana/k6catalog"
 	"github.com/grafana/k6deps"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // checks request has the correct Authorization header
@@ -196,3 +215,3061 @@ func Test_Provider(t *testing.T) { //nolint:paralleltest
 		})
 	}
 }
+
+// testBuildService is a fake build service that returns a fixed artifact
+type testBuildService struct {
+	artifact k6build.Artifact
+	err      error
+}
+
+func (b *testBuildService) Build(
+	_ context.Context,
+	platform string,
+	_ string,
+	_ []k6build.Dependency,
+) (k6build.Artifact, error) {
+	artifact := b.artifact
+	artifact.Platform = platform
+	return artifact, b.err
+}
+
+// newTestProvider returns a provider with the given configuration, configured for downloading the given binary content
+// from a test server, using a fake build service that returns the given checksum
+func newTestProvider(t *testing.T, config Config, content []byte, checksum string) (*Provider, *httptest.Server) {
+	t.Helper()
+
+	downloadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(downloadSrv.Close)
+
+	config.BuildServiceURL = "http://localhost"
+	config.BinDir = t.TempDir()
+	provider, err := NewProvider(config)
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+
+	// speed up retries
+	provider.retry.InitialBackoff = time.Millisecond
+	provider.retry.MaxBackoff = time.Millisecond
+
+	provider.buildSrv = &testBuildService{
+		artifact: k6build.Artifact{
+			ID:           "artifact",
+			URL:          downloadSrv.URL,
+			Dependencies: map[string]string{"k6": "v0.50.0"},
+			Checksum:     checksum,
+		},
+	}
+
+	return provider, downloadSrv
+}
+
+func sha256sum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		checksum  string
+		expectErr error
+	}{
+		{
+			title:     "checksum matches",
+			checksum:  sha256sum(content),
+			expectErr: nil,
+		},
+		{
+			title:     "uppercase checksum matches",
+			checksum:  strings.ToUpper(sha256sum(content)),
+			expectErr: nil,
+		},
+		{
+			title:     "checksum mismatch",
+			checksum:  sha256sum([]byte("another binary")),
+			expectErr: ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, content, tc.checksum)
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				// artifact dir must be removed
+				if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact")); !os.IsNotExist(err) {
+					t.Fatalf("artifact dir not removed %v", err)
+				}
+				return
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+		})
+	}
+}
+
+func TestInterruptedDownload(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	// interrupted downloads are not retried, so the partial content is discarded
+	config := Config{Retry: RetryConfig{MaxAttempts: 1}}
+	provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+	// first request is interrupted after sending part of the content
+	interrupted := false
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !interrupted {
+			interrupted = true
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			return
+		}
+		_, _ = w.Write(content)
+	})
+
+	_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if !errors.Is(err, ErrDownload) {
+		t.Fatalf("expected %v got %v", ErrDownload, err)
+	}
+
+	binPath := filepath.Join(provider.cacheDir(), "artifact", k6Binary)
+	if _, err = os.Stat(binPath); !os.IsNotExist(err) {
+		t.Fatalf("partial binary left in cache %v", err)
+	}
+
+	// simulate a partial download left by a process killed while downloading
+	err = os.MkdirAll(filepath.Dir(binPath), 0o700)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+	err = os.WriteFile(binPath+"-partial.tmp", content[:len(content)/2], 0o600)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	got, err := os.ReadFile(k6.Path)
+	if err != nil {
+		t.Fatalf("reading binary %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("expected %q got %q", content, got)
+	}
+}
+
+func TestConcurrentDownload(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	downloads := atomic.Int32{}
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		downloads.Add(1)
+		_, _ = w.Write(content)
+	})
+
+	const concurrency = 10
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, concurrency)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, content) {
+				errs <- fmt.Errorf("expected %q got %q", content, got)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if downloads.Load() != 1 {
+		t.Fatalf("expected 1 download got %d", downloads.Load())
+	}
+}
+
+func TestConcurrentGetBinary(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{VerifyOnHit: true}, content, sha256sum(content))
+	provider.buildSrv = &depsBuildService{url: downloadSrv.URL, checksum: sha256sum(content)}
+
+	mutex := sync.Mutex{}
+	downloads := map[string]int{}
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		downloads[r.URL.Query().Get("id")]++
+		mutex.Unlock()
+		_, _ = w.Write(content)
+	})
+
+	specs := []string{"k6/x/sql=*", "k6/x/kafka=*", "k6/x/sql=*;k6/x/kafka=*", ""}
+
+	const concurrency = 40
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, concurrency)
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			deps := k6deps.Dependencies{}
+			if spec := specs[i%len(specs)]; spec != "" {
+				if err := deps.UnmarshalText([]byte(spec)); err != nil {
+					errs <- err
+					return
+				}
+			}
+
+			k6, err := provider.GetBinary(context.TODO(), deps)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, content) {
+				errs <- fmt.Errorf("expected %q got %q", content, got)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if len(downloads) != len(specs) {
+		t.Fatalf("expected %d binaries got %d", len(specs), len(downloads))
+	}
+
+	for id, count := range downloads {
+		if count != 1 {
+			t.Fatalf("expected 1 download of %s got %d", id, count)
+		}
+	}
+}
+
+func TestDownloadProxy(t *testing.T) { //nolint:paralleltest
+	testCases := []struct {
+		title       string
+		proxyURL    string
+		env         string
+		expectProxy string
+	}{
+		{
+			title:       "explicit proxy",
+			proxyURL:    "http://explicit:8080",
+			env:         "http://env:8080",
+			expectProxy: "http://explicit:8080",
+		},
+		{
+			title:       "K6_DOWNLOAD_PROXY",
+			env:         "http://env:8080",
+			expectProxy: "http://env:8080",
+		},
+		{
+			title:       "standard environment variables",
+			expectProxy: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Setenv("K6_DOWNLOAD_PROXY", tc.env)
+
+			client, err := newHTTPClient(tc.proxyURL)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			transport, ok := client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("unexpected transport %T", client.Transport)
+			}
+
+			// the standard environment variables are read only once by the http package,
+			// so the use of ProxyFromEnvironment is checked instead
+			if tc.expectProxy == "" {
+				if reflect.ValueOf(transport.Proxy).Pointer() != reflect.ValueOf(http.ProxyFromEnvironment).Pointer() {
+					t.Fatalf("expected proxy from environment")
+				}
+				return
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/k6", nil)
+			proxy, err := transport.Proxy(req)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			if proxy.String() != tc.expectProxy {
+				t.Fatalf("expected proxy %s got %s", tc.expectProxy, proxy)
+			}
+		})
+	}
+}
+
+// helperEnv is the environment variable that enables TestHelperGetBinary when running as subprocess
+const helperEnv = "K6PROVIDER_TEST_HELPER"
+
+// TestHelperGetBinary is not a real test. It is executed as a subprocess by
+// TestCrossProcessDownload for obtaining a binary from a cache shared with other processes
+func TestHelperGetBinary(t *testing.T) { //nolint:paralleltest
+	if os.Getenv(helperEnv) == "" {
+		t.Skip("only executed as subprocess")
+	}
+
+	provider, err := NewProvider(Config{
+		BuildServiceURL: "http://localhost",
+		BinDir:          os.Getenv("K6PROVIDER_TEST_BINDIR"),
+	})
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+
+	provider.buildSrv = &testBuildService{
+		artifact: k6build.Artifact{
+			ID:       "artifact",
+			URL:      os.Getenv("K6PROVIDER_TEST_URL"),
+			Checksum: os.Getenv("K6PROVIDER_TEST_CHECKSUM"),
+		},
+	}
+
+	if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+}
+
+func TestCrossProcessDownload(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	downloads := atomic.Int32{}
+	downloadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		downloads.Add(1)
+		// give the other process time to wait for the lock
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(downloadSrv.Close)
+
+	binDir := t.TempDir()
+
+	const processes = 2
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, processes)
+	for range processes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestHelperGetBinary$") //nolint:gosec
+			cmd.Env = append(
+				os.Environ(),
+				helperEnv+"=1",
+				"K6PROVIDER_TEST_BINDIR="+binDir,
+				"K6PROVIDER_TEST_URL="+downloadSrv.URL,
+				"K6PROVIDER_TEST_CHECKSUM="+sha256sum(content),
+			)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs <- fmt.Errorf("%w: %s", err, out)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if downloads.Load() != 1 {
+		t.Fatalf("expected 1 download got %d", downloads.Load())
+	}
+}
+
+func TestDownloadRetry(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title          string
+		statuses       []int
+		expectErr      error
+		expectRequests int32
+	}{
+		{
+			title:          "retry on service unavailable",
+			statuses:       []int{http.StatusServiceUnavailable, http.StatusOK},
+			expectErr:      nil,
+			expectRequests: 2,
+		},
+		{
+			title:          "retry on too many requests",
+			statuses:       []int{http.StatusTooManyRequests, http.StatusOK},
+			expectErr:      nil,
+			expectRequests: 2,
+		},
+		{
+			title:          "do not retry on not found",
+			statuses:       []int{http.StatusNotFound, http.StatusOK},
+			expectErr:      ErrDownload,
+			expectRequests: 1,
+		},
+		{
+			title: "max attempts reached",
+			statuses: []int{
+				http.StatusBadGateway,
+				http.StatusBadGateway,
+				http.StatusBadGateway,
+				http.StatusOK,
+			},
+			expectErr:      ErrDownload,
+			expectRequests: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+			requests := atomic.Int32{}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				status := tc.statuses[requests.Add(1)-1]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write(content)
+				}
+			})
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if requests.Load() != tc.expectRequests {
+				t.Fatalf("expected %d requests got %d", tc.expectRequests, requests.Load())
+			}
+		})
+	}
+}
+
+func TestBuildRetry(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title          string
+		status         int
+		body           string
+		expectErr      error
+		expectRequests int32
+	}{
+		{
+			title:          "retry on service unavailable with empty body",
+			status:         http.StatusServiceUnavailable,
+			expectRequests: 2,
+		},
+		{
+			title:          "retry on bad gateway with html body",
+			status:         http.StatusBadGateway,
+			body:           "<html><body>502 Bad Gateway</body></html>",
+			expectRequests: 2,
+		},
+		{
+			title:          "do not retry on unauthorized",
+			status:         http.StatusUnauthorized,
+			body:           "<html><body>401 Unauthorized</body></html>",
+			expectErr:      ErrBuild,
+			expectRequests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+			artifact := k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)}
+			buildSrv := newTestBuildServer(t, "", "", artifact)
+			handler := buildSrv.Config.Handler
+
+			requests := atomic.Int32{}
+			buildSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte(tc.body))
+					return
+				}
+				handler.ServeHTTP(w, r)
+			})
+
+			srv, err := newBuildService(Config{BuildServiceURL: buildSrv.URL})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+			provider.buildSrv = srv
+
+			_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if requests.Load() != tc.expectRequests {
+				t.Fatalf("expected %d requests got %d", tc.expectRequests, requests.Load())
+			}
+		})
+	}
+}
+
+func TestInterruptedDownloadRetry(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	// first request is interrupted after sending part of the content
+	requests := atomic.Int32{}
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			return
+		}
+		_, _ = w.Write(content)
+	})
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if requests.Load() != 2 {
+		t.Fatalf("expected 2 requests got %d", requests.Load())
+	}
+
+	got, err := os.ReadFile(k6.Path)
+	if err != nil {
+		t.Fatalf("reading binary %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("expected %q got %q", content, got)
+	}
+}
+
+func TestResumeDownload(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary content")
+	half := len(content) / 2
+
+	// sends half of the content, interrupting the download
+	interrupt := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		_, _ = w.Write(content[:half])
+	}
+
+	// sends the requested range of the content
+	sendRange := func(w http.ResponseWriter, r *http.Request) {
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+			_, _ = w.Write(content)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[start:])
+	}
+
+	testCases := []struct {
+		title        string
+		handler      func(request int32, w http.ResponseWriter, r *http.Request)
+		expectRanges []string
+	}{
+		{
+			title: "resume with range",
+			handler: func(request int32, w http.ResponseWriter, r *http.Request) {
+				if request == 1 {
+					interrupt(w)
+					return
+				}
+				sendRange(w, r)
+			},
+			expectRanges: []string{"", fmt.Sprintf("bytes=%d-", half)},
+		},
+		{
+			title: "range not supported",
+			handler: func(request int32, w http.ResponseWriter, _ *http.Request) {
+				if request == 1 {
+					interrupt(w)
+					return
+				}
+				_, _ = w.Write(content)
+			},
+			expectRanges: []string{"", fmt.Sprintf("bytes=%d-", half)},
+		},
+		{
+			title: "range not satisfiable",
+			handler: func(request int32, w http.ResponseWriter, r *http.Request) {
+				switch request {
+				case 1:
+					interrupt(w)
+				case 2:
+					w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				default:
+					sendRange(w, r)
+				}
+			},
+			expectRanges: []string{"", fmt.Sprintf("bytes=%d-", half), ""},
+		},
+		{
+			title: "unexpected content range",
+			handler: func(request int32, w http.ResponseWriter, r *http.Request) {
+				if request == 1 {
+					interrupt(w)
+					return
+				}
+				if r.Header.Get("Range") != "" {
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+					w.WriteHeader(http.StatusPartialContent)
+				}
+				_, _ = w.Write(content)
+			},
+			expectRanges: []string{"", fmt.Sprintf("bytes=%d-", half), ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := Config{ResumeDownloads: true}
+			provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+			mu := sync.Mutex{}
+			ranges := []string{}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				request := int32(len(ranges))
+				mu.Unlock()
+
+				tc.handler(request, w, r)
+			})
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+
+			if !slices.Equal(ranges, tc.expectRanges) {
+				t.Fatalf("expected ranges %q got %q", tc.expectRanges, ranges)
+			}
+
+			partPath := filepath.Join(provider.cacheDir(), "artifact", k6Binary+partialSuffix)
+			if _, err = os.Stat(partPath); !os.IsNotExist(err) {
+				t.Fatalf("partial download left in cache %v", err)
+			}
+		})
+	}
+}
+
+func TestResumeDownloadLater(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary content")
+	half := len(content) / 2
+
+	t.Run("partial download is resumed", func(t *testing.T) {
+		t.Parallel()
+
+		config := Config{ResumeDownloads: true, Retry: RetryConfig{MaxAttempts: 1}}
+		provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+		ranges := []string{}
+		downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if len(ranges) == 1 {
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+				_, _ = w.Write(content[:half])
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[half:])
+		})
+
+		_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if !errors.Is(err, ErrDownload) {
+			t.Fatalf("expected %v got %v", ErrDownload, err)
+		}
+
+		partPath := filepath.Join(provider.cacheDir(), "artifact", k6Binary+partialSuffix)
+		partial, err := os.ReadFile(partPath)
+		if err != nil {
+			t.Fatalf("reading partial download %v", err)
+		}
+		if !bytes.Equal(partial, content[:half]) {
+			t.Fatalf("expected partial content %q got %q", content[:half], partial)
+		}
+
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		got, err := os.ReadFile(k6.Path)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+
+		expectRanges := []string{"", fmt.Sprintf("bytes=%d-", half)}
+		if !slices.Equal(ranges, expectRanges) {
+			t.Fatalf("expected ranges %q got %q", expectRanges, ranges)
+		}
+	})
+
+	t.Run("corrupted partial download is discarded", func(t *testing.T) {
+		t.Parallel()
+
+		config := Config{ResumeDownloads: true, Retry: RetryConfig{MaxAttempts: 1}}
+		provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+		downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") == "" {
+				_, _ = w.Write(content)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[half:])
+		})
+
+		partPath := filepath.Join(provider.cacheDir(), "artifact", k6Binary+partialSuffix)
+		if err := os.MkdirAll(filepath.Dir(partPath), 0o700); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+		if err := os.WriteFile(partPath, bytes.Repeat([]byte("x"), half), 0o600); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+
+		_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if !errors.Is(err, ErrDownload) {
+			t.Fatalf("expected %v got %v", ErrDownload, err)
+		}
+
+		if _, err = os.Stat(partPath); !os.IsNotExist(err) {
+			t.Fatalf("corrupted partial download left in cache %v", err)
+		}
+
+		// the next download starts from scratch
+		if _, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	})
+}
+
+func TestTempDir(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary content")
+
+	t.Run("binary is moved from temp dir", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir := t.TempDir()
+		provider, _ := newTestProvider(t, Config{TempDir: tempDir}, content, sha256sum(content))
+
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		got, err := os.ReadFile(k6.Path)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+
+		entries, err := os.ReadDir(tempDir)
+		if err != nil {
+			t.Fatalf("reading temp dir %v", err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("expected empty temp dir got %d files", len(entries))
+		}
+	})
+
+	t.Run("partial download kept in temp dir", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir := t.TempDir()
+		config := Config{TempDir: tempDir, ResumeDownloads: true, Retry: RetryConfig{MaxAttempts: 1}}
+		provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+		downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+		})
+
+		_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if !errors.Is(err, ErrDownload) {
+			t.Fatalf("expected %v got %v", ErrDownload, err)
+		}
+
+		partials, err := filepath.Glob(filepath.Join(tempDir, "*"+partialSuffix))
+		if err != nil || len(partials) != 1 {
+			t.Fatalf("expected a partial download in temp dir got %v %v", partials, err)
+		}
+
+		if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact")); !os.IsNotExist(err) {
+			t.Fatalf("artifact directory left in cache %v", err)
+		}
+	})
+}
+
+func TestMaxBinarySize(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary content")
+
+	testCases := []struct {
+		title     string
+		maxSize   int64
+		chunked   bool
+		expectErr error
+	}{
+		{
+			title:     "within limit",
+			maxSize:   int64(len(content)),
+			expectErr: nil,
+		},
+		{
+			title:     "content length exceeds limit",
+			maxSize:   int64(len(content) - 1),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "body exceeds limit",
+			maxSize:   int64(len(content) - 1),
+			chunked:   true,
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "limit disabled",
+			maxSize:   -1,
+			chunked:   true,
+			expectErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := Config{MaxBinarySize: tc.maxSize}
+			provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if !tc.chunked {
+					_, _ = w.Write(content)
+					return
+				}
+				// flushing the headers before the body forces a response without content length
+				w.(http.Flusher).Flush() //nolint:forcetypeassert
+				_, _ = w.Write(content)
+			})
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err == nil {
+				return
+			}
+
+			if !errors.Is(err, errBinaryTooLarge) {
+				t.Fatalf("expected %v got %v", errBinaryTooLarge, err)
+			}
+
+			if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact")); !os.IsNotExist(err) {
+				t.Fatalf("partial download left in cache %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("k6 binary"), 10000)
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	calls := 0
+	downloaded, total := int64(0), int64(0)
+	provider.progress = func(d int64, t int64) {
+		calls++
+		downloaded, total = d, t
+	}
+
+	_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if calls == 0 {
+		t.Fatalf("progress not reported")
+	}
+
+	if downloaded != int64(len(content)) || total != int64(len(content)) {
+		t.Fatalf("expected %d/%d got %d/%d", len(content), len(content), downloaded, total)
+	}
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+	provider.downloadTimeout = 100 * time.Millisecond
+
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		_, _ = w.Write(content)
+	})
+
+	_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if !errors.Is(err, ErrDownload) {
+		t.Fatalf("expected %v got %v", ErrDownload, err)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	logs := &bytes.Buffer{}
+	provider.logger = slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	for range 2 {
+		if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	}
+
+	for _, msg := range []string{"cache miss", "download completed", "cache hit", "artifact_id=artifact"} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Fatalf("expected %q in logs:\n%s", msg, logs.String())
+		}
+	}
+}
+
+// countingTransport counts the requests sent using the default transport
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestInsecureSkipChecksum(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	logs := &bytes.Buffer{}
+	config := Config{
+		InsecureSkipChecksum: true,
+		VerifyOnHit:          true,
+		Logger:               slog.New(slog.NewTextHandler(logs, nil)),
+	}
+	provider, _ := newTestProvider(t, config, content, "placeholder")
+
+	if !strings.Contains(logs.String(), "checksum verification is disabled") {
+		t.Fatalf("expected a warning in logs:\n%s", logs.String())
+	}
+
+	// the second time, the binary is found in the cache
+	for range 2 {
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		got, err := os.ReadFile(k6.Path)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+	}
+}
+
+func TestCustomHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	_, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	transport := &countingTransport{}
+	provider, err := NewProvider(Config{
+		BuildServiceURL:  "http://localhost",
+		BinDir:           t.TempDir(),
+		DownloadProxyURL: "http://127.0.0.1:12345",
+		HTTPClient:       &http.Client{Transport: transport},
+	})
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+	provider.buildSrv = &testBuildService{
+		artifact: k6build.Artifact{
+			ID:       "artifact",
+			URL:      downloadSrv.URL,
+			Checksum: sha256sum(content),
+		},
+	}
+
+	// download must use the custom client, ignoring the (unavailable) proxy
+	_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if transport.requests.Load() != 1 {
+		t.Fatalf("expected 1 request got %d", transport.requests.Load())
+	}
+}
+
+func TestCacheLimit(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("k"), 100)
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+	provider.pruner = NewPruner(provider.cacheDir(), 250, time.Nanosecond)
+
+	buildSrv, _ := provider.buildSrv.(*testBuildService)
+	getBinary := func(id string) {
+		t.Helper()
+		buildSrv.artifact.ID = id
+		if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	}
+	modTime := func(id string) time.Time {
+		info, err := os.Stat(filepath.Join(provider.cacheDir(), id, k6Binary))
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	waitFor := func(condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for condition")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	getBinary("binary-1")
+	getBinary("binary-2")
+
+	// use binary-1 from the cache, so binary-2 becomes the least recently used
+	getBinary("binary-1")
+	waitFor(func() bool { return modTime("binary-1").After(modTime("binary-2")) })
+
+	// exceed the limit
+	getBinary("binary-3")
+	waitFor(func() bool { return modTime("binary-2").IsZero() })
+
+	for _, id := range []string{"binary-1", "binary-3"} {
+		if modTime(id).IsZero() {
+			t.Fatalf("%s should not be pruned", id)
+		}
+	}
+}
+
+func TestBinaryName(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		platform string
+		expect   string
+	}{
+		{
+			platform: "linux/amd64",
+			expect:   "k6",
+		},
+		{
+			platform: "darwin/arm64",
+			expect:   "k6",
+		},
+		{
+			platform: "windows/amd64",
+			expect:   "k6.exe",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.platform, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{Platform: tc.platform}, content, sha256sum(content))
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if filepath.Base(k6.Path) != tc.expect {
+				t.Fatalf("expected %s got %s", tc.expect, filepath.Base(k6.Path))
+			}
+		})
+	}
+}
+
+func TestPlatformValidation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		platform  string
+		expectErr error
+	}{
+		{platform: "", expectErr: nil},
+		{platform: "linux/amd64", expectErr: nil},
+		{platform: "windows/arm64", expectErr: nil},
+		{platform: "linux/amd64 ", expectErr: ErrConfig},
+		{platform: "darwin/x86", expectErr: ErrConfig},
+		{platform: "linux", expectErr: ErrConfig},
+		{platform: "linux-amd64", expectErr: ErrConfig},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.platform, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewProvider(Config{
+				BuildServiceURL: "http://localhost",
+				BinDir:          t.TempDir(),
+				Platform:        tc.platform,
+			})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestBinaryStats(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if k6.Stats.CacheHit || k6.Stats.DownloadDuration == 0 || k6.Stats.Size != int64(len(content)) {
+		t.Fatalf("unexpected stats for download %+v", k6.Stats)
+	}
+
+	k6, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if !k6.Stats.CacheHit || k6.Stats.DownloadDuration != 0 || k6.Stats.Size != int64(len(content)) {
+		t.Fatalf("unexpected stats for cache hit %+v", k6.Stats)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	online, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	cached := k6deps.Dependencies{}
+	if err := cached.UnmarshalText([]byte("k6=v0.50.0")); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	notCached := k6deps.Dependencies{}
+	if err := notCached.UnmarshalText([]byte("k6=v0.51.0")); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	expected, err := online.GetBinary(context.TODO(), cached)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	offline, err := NewProvider(Config{
+		BuildServiceURL: "http://127.0.0.1:12345",
+		BinDir:          online.binDir,
+		Offline:         true,
+	})
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+
+	k6, err := offline.GetBinary(context.TODO(), cached)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if k6.Path != expected.Path || k6.Checksum != expected.Checksum {
+		t.Fatalf("expected %v got %v", expected, k6)
+	}
+
+	_, err = offline.GetBinary(context.TODO(), notCached)
+	if !errors.Is(err, ErrNotCached) {
+		t.Fatalf("expected %v got %v", ErrNotCached, err)
+	}
+}
+
+func TestStaleIfError(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	unavailable := k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusServiceUnavailable})
+	unauthorized := k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusUnauthorized})
+
+	testCases := []struct {
+		title       string
+		config      Config
+		cached      bool
+		buildErr    error
+		expectErr   error
+		expectStale bool
+	}{
+		{
+			title:       "build service unavailable",
+			config:      Config{StaleIfError: true},
+			cached:      true,
+			buildErr:    unavailable,
+			expectStale: true,
+		},
+		{
+			title:     "not cached",
+			config:    Config{StaleIfError: true},
+			buildErr:  unavailable,
+			expectErr: ErrBuild,
+		},
+		{
+			title:     "permanent error",
+			config:    Config{StaleIfError: true},
+			cached:    true,
+			buildErr:  unauthorized,
+			expectErr: ErrBuild,
+		},
+		{
+			title:     "disabled",
+			config:    Config{},
+			cached:    true,
+			buildErr:  unavailable,
+			expectErr: ErrBuild,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, tc.config, content, sha256sum(content))
+			provider.retry.MaxAttempts = 1
+
+			if tc.cached {
+				if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+			}
+
+			buildSrv, _ := provider.buildSrv.(*testBuildService)
+			buildSrv.err = tc.buildErr
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if !k6.Stats.Stale || !k6.Stats.CacheHit || k6.ArtifactID != "artifact" {
+				t.Fatalf("expected stale cached binary got %+v", k6)
+			}
+		})
+	}
+}
+
+func TestStaleIfErrorUnexpectedResponse(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title  string
+		status int
+		body   string
+	}{
+		{
+			title:  "bad gateway with html body",
+			status: http.StatusBadGateway,
+			body:   "<html><body>502 Bad Gateway</body></html>",
+		},
+		{
+			title:  "service unavailable with empty body",
+			status: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{StaleIfError: true}, content, sha256sum(content))
+			provider.retry.MaxAttempts = 1
+
+			if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			buildSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(buildSrv.Close)
+
+			srv, err := newBuildService(Config{BuildServiceURL: buildSrv.URL})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+			provider.buildSrv = srv
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if !k6.Stats.Stale || !k6.Stats.CacheHit {
+				t.Fatalf("expected stale cached binary got %+v", k6)
+			}
+		})
+	}
+}
+
+func TestStaleIfErrorRequiresCache(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewProvider(Config{
+		BuildServiceURL: "http://localhost",
+		NoCache:         true,
+		StaleIfError:    true,
+	})
+	if !errors.Is(err, ErrConfig) {
+		t.Fatalf("expected %v got %v", ErrConfig, err)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{Platform: "linux/amd64"}, content, sha256sum(content))
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	m, err := readManifest(filepath.Dir(k6.Path))
+	if err != nil {
+		t.Fatalf("reading manifest %v", err)
+	}
+
+	if m.ID != "artifact" || m.Platform != "linux/amd64" || m.Checksum != k6.Checksum ||
+		m.Dependencies["k6"] != "v0.50.0" || m.Downloaded.IsZero() {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	// cached binaries are described by their manifest
+	buildSrv, _ := provider.buildSrv.(*testBuildService)
+	buildSrv.artifact.Dependencies = map[string]string{"k6": "v0.51.0"}
+
+	k6, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if k6.Dependencies["k6"] != "v0.50.0" {
+		t.Fatalf("expected dependencies from manifest got %v", k6.Dependencies)
+	}
+}
+
+func TestVerifyOnHit(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title          string
+		verifyOnHit    bool
+		expectContent  []byte
+		expectRequests int32
+	}{
+		{
+			title:          "corrupted binary is downloaded again",
+			verifyOnHit:    true,
+			expectContent:  content,
+			expectRequests: 2,
+		},
+		{
+			title:          "verification disabled",
+			verifyOnHit:    false,
+			expectContent:  []byte("corrupted"),
+			expectRequests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(
+				t,
+				Config{VerifyOnHit: tc.verifyOnHit},
+				content,
+				sha256sum(content),
+			)
+
+			requests := atomic.Int32{}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+				_, _ = w.Write(content)
+			})
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			err = os.WriteFile(k6.Path, []byte("corrupted"), 0o700) //nolint:gosec
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			k6, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, tc.expectContent) {
+				t.Fatalf("expected %q got %q", tc.expectContent, got)
+			}
+
+			if requests.Load() != tc.expectRequests {
+				t.Fatalf("expected %d requests got %d", tc.expectRequests, requests.Load())
+			}
+		})
+	}
+}
+
+// newTestBuildServer returns a build service that returns the given artifact if the request
+// has the expected header
+func newTestBuildServer(t *testing.T, header string, value string, artifact k6build.Artifact) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get(header) != value {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(api.BuildResponse{
+				Error: k6build.NewWrappedError(api.ErrRequestFailed, errors.New("unauthorized")),
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.BuildResponse{Artifact: artifact})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestBuildServiceAuth(t *testing.T) { //nolint:paralleltest
+	content := []byte("k6 binary")
+	_, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+	artifact := k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)}
+
+	testCases := []struct {
+		title     string
+		config    Config
+		env       map[string]string
+		header    string
+		value     string
+		expectErr error
+	}{
+		{
+			title:  "bearer token",
+			config: Config{BuildServiceAuth: "token"},
+			header: "Authorization",
+			value:  "Bearer token",
+		},
+		{
+			title:  "custom auth type",
+			config: Config{BuildServiceAuth: "token", BuildServiceAuthType: "Token"},
+			header: "Authorization",
+			value:  "Token token",
+		},
+		{
+			title:  "token from environment",
+			env:    map[string]string{"K6_BUILD_SERVICE_AUTH": "env-token"},
+			header: "Authorization",
+			value:  "Bearer env-token",
+		},
+		{
+			title:  "custom header",
+			config: Config{BuildServiceHeaders: map[string]string{"X-Api-Key": "key"}},
+			header: "X-Api-Key",
+			value:  "key",
+		},
+		{
+			title:  "default user agent",
+			header: "User-Agent",
+			value:  "k6provider/devel",
+		},
+		{
+			title:  "custom user agent",
+			config: Config{UserAgent: "my-app/1.0"},
+			header: "User-Agent",
+			value:  "my-app/1.0",
+		},
+		{
+			title:  "user agent header",
+			config: Config{UserAgent: "my-app/1.0", BuildServiceHeaders: map[string]string{"user-agent": "custom"}},
+			header: "User-Agent",
+			value:  "custom",
+		},
+		{
+			title:     "missing token",
+			header:    "Authorization",
+			value:     "Bearer token",
+			expectErr: ErrBuild,
+		},
+	}
+
+	for _, tc := range testCases { //nolint:paralleltest
+		t.Run(tc.title, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			config := tc.config
+			config.BuildServiceURL = newTestBuildServer(t, tc.header, tc.value, artifact).URL
+			config.BinDir = t.TempDir()
+
+			provider, err := NewProvider(config)
+			if err != nil {
+				t.Fatalf("initializing provider %v", err)
+			}
+
+			_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestDownloadAuth(t *testing.T) { //nolint:paralleltest
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		config    Config
+		env       map[string]string
+		header    string
+		value     string
+		expectErr error
+	}{
+		{
+			title:  "bearer token",
+			config: Config{DownloadAuth: "token"},
+			header: "Authorization",
+			value:  "Bearer token",
+		},
+		{
+			title:  "basic auth",
+			config: Config{DownloadAuth: "dXNlcjpwYXNz", DownloadAuthType: "Basic"},
+			header: "Authorization",
+			value:  "Basic dXNlcjpwYXNz",
+		},
+		{
+			title:  "token from environment",
+			env:    map[string]string{"K6_DOWNLOAD_AUTH": "env-token"},
+			header: "Authorization",
+			value:  "Bearer env-token",
+		},
+		{
+			title:  "custom header",
+			config: Config{DownloadHeaders: map[string]string{"X-Api-Key": "key"}},
+			header: "X-Api-Key",
+			value:  "key",
+		},
+		{
+			title:  "default user agent",
+			header: "User-Agent",
+			value:  "k6provider/devel",
+		},
+		{
+			title:  "custom user agent",
+			config: Config{UserAgent: "my-app/1.0"},
+			header: "User-Agent",
+			value:  "my-app/1.0",
+		},
+		{
+			title:     "missing token",
+			header:    "Authorization",
+			value:     "Bearer token",
+			expectErr: ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases { //nolint:paralleltest
+		t.Run(tc.title, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			provider, downloadSrv := newTestProvider(t, tc.config, content, sha256sum(content))
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(tc.header) != tc.value {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write(content)
+			})
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestRequestModifier(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	// the servers record the header set by the modifier and fail the first request, so it is retried
+	downloads := []string{}
+	downloadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads = append(downloads, r.Header.Get("X-Attempt"))
+		if len(downloads) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(downloadSrv.Close)
+
+	artifact := k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)}
+	builds := []string{}
+	buildSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		builds = append(builds, r.Header.Get("X-Attempt"))
+		if len(builds) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.BuildResponse{Artifact: artifact})
+	}))
+	t.Cleanup(buildSrv.Close)
+
+	modifier := func() RequestModifier {
+		attempt := 0
+		return func(req *http.Request) {
+			attempt++
+			req.Header.Set("X-Attempt", fmt.Sprintf("%d", attempt))
+		}
+	}
+
+	provider, err := NewProvider(Config{
+		BuildServiceURL:         buildSrv.URL,
+		BinDir:                  t.TempDir(),
+		Retry:                   RetryConfig{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		BuildRequestModifier:    modifier(),
+		DownloadRequestModifier: modifier(),
+	})
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+
+	_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	expected := []string{"1", "2"}
+	if !slices.Equal(builds, expected) {
+		t.Fatalf("expected build requests %v got %v", expected, builds)
+	}
+	if !slices.Equal(downloads, expected) {
+		t.Fatalf("expected download requests %v got %v", expected, downloads)
+	}
+}
+
+// requestIDKey is the context key of the request ID in TestContextHeaders
+type requestIDKey struct{}
+
+func TestContextHeaders(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title  string
+		ctx    context.Context
+		expect string
+	}{
+		{
+			title:  "request id in context",
+			ctx:    context.WithValue(context.TODO(), requestIDKey{}, "request-id"),
+			expect: "request-id",
+		},
+		{
+			title:  "request id not in context",
+			ctx:    context.TODO(),
+			expect: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			var downloadID string
+			downloadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloadID = r.Header.Get("X-Request-ID")
+				_, _ = w.Write(content)
+			}))
+			t.Cleanup(downloadSrv.Close)
+
+			var buildID string
+			buildSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				buildID = r.Header.Get("X-Request-ID")
+				_ = json.NewEncoder(w).Encode(api.BuildResponse{
+					Artifact: k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(content)},
+				})
+			}))
+			t.Cleanup(buildSrv.Close)
+
+			provider, err := NewProvider(
+				WithBuildServiceURL(buildSrv.URL),
+				WithBinDir(t.TempDir()),
+				WithContextHeaders(map[any]string{requestIDKey{}: "X-Request-ID"}),
+			)
+			if err != nil {
+				t.Fatalf("initializing provider %v", err)
+			}
+
+			_, err = provider.GetBinary(tc.ctx, k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if buildID != tc.expect {
+				t.Fatalf("expected build request id %q got %q", tc.expect, buildID)
+			}
+			if downloadID != tc.expect {
+				t.Fatalf("expected download request id %q got %q", tc.expect, downloadID)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	if _, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{}); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if err := provider.Close(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// closing again has no effect
+	if err := provider.Close(); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected %v got %v", ErrClosed, err)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	traceID := trace.TraceID{0x01, 0x02, 0x03}
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	testCases := []struct {
+		title  string
+		config Config
+		expect string
+	}{
+		{
+			title:  "no tracer provider",
+			config: Config{},
+			expect: "",
+		},
+		{
+			title:  "trace context propagated",
+			config: Config{TracerProvider: noop.NewTracerProvider()},
+			expect: traceID.String(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, tc.config, content, sha256sum(content))
+
+			traceparent := ""
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceparent = r.Header.Get("Traceparent")
+				_, _ = w.Write(content)
+			})
+
+			ctx := trace.ContextWithRemoteSpanContext(context.TODO(), parent)
+			if _, err := provider.GetBinary(ctx, k6deps.Dependencies{}); err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if tc.expect == "" && traceparent != "" {
+				t.Fatalf("unexpected trace context %q", traceparent)
+			}
+
+			if !strings.Contains(traceparent, tc.expect) {
+				t.Fatalf("expected trace id %q in %q", tc.expect, traceparent)
+			}
+		})
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on windows")
+	}
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title      string
+		config     Config
+		expectDir  os.FileMode
+		expectFile os.FileMode
+	}{
+		{
+			title:      "default permissions",
+			config:     Config{},
+			expectDir:  0o700,
+			expectFile: 0o700,
+		},
+		{
+			title:      "group permissions",
+			config:     Config{DirMode: 0o750, FileMode: 0o750},
+			expectDir:  0o750,
+			expectFile: 0o750,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, tc.config, content, sha256sum(content))
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			dirInfo, err := os.Stat(filepath.Dir(k6.Path))
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			if dirInfo.Mode().Perm() != tc.expectDir {
+				t.Fatalf("expected dir mode %v got %v", tc.expectDir, dirInfo.Mode().Perm())
+			}
+
+			binInfo, err := os.Stat(k6.Path)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			if binInfo.Mode().Perm() != tc.expectFile {
+				t.Fatalf("expected file mode %v got %v", tc.expectFile, binInfo.Mode().Perm())
+			}
+
+			manifestInfo, err := os.Stat(filepath.Join(filepath.Dir(k6.Path), manifestFile))
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			if manifestInfo.Mode().Perm() != tc.expectFile&^0o111 {
+				t.Fatalf("expected manifest mode %v got %v", tc.expectFile&^0o111, manifestInfo.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestRepairPermissions(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on windows")
+	}
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{FileMode: 0o750}, content, sha256sum(content))
+
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// the execute bits are lost, for example, copying the cache
+	if err = os.Chmod(k6.Path, 0o640); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	k6, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if !k6.Stats.CacheHit {
+		t.Fatalf("expected cache hit")
+	}
+
+	binInfo, err := os.Stat(k6.Path)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if binInfo.Mode().Perm() != 0o750 {
+		t.Fatalf("expected file mode %v got %v", os.FileMode(0o750), binInfo.Mode().Perm())
+	}
+}
+
+func TestDefaultBinDir(t *testing.T) { //nolint:paralleltest
+	testCases := []struct {
+		title  string
+		env    map[string]string
+		expect string
+	}{
+		{
+			title:  "user cache dir",
+			env:    map[string]string{"XDG_CACHE_HOME": "/cache", "HOME": "/home/user"},
+			expect: filepath.Join("/cache", "k6provider"),
+		},
+		{
+			title:  "fallback to tmp dir",
+			env:    map[string]string{"XDG_CACHE_HOME": "", "HOME": ""},
+			expect: filepath.Join(os.TempDir(), "k6provider", "cache"),
+		},
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Skip("cache dir environment variables are only supported on linux")
+	}
+
+	for _, tc := range testCases { //nolint:paralleltest
+		t.Run(tc.title, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			if binDir := defaultBinDir(); binDir != tc.expect {
+				t.Fatalf("expected %s got %s", tc.expect, binDir)
+			}
+		})
+	}
+}
+
+func TestForceRefresh(t *testing.T) {
+	t.Parallel()
+
+	original := []byte("k6 binary")
+	modified := []byte("modified k6 binary")
+
+	testCases := []struct {
+		title         string
+		etag          string
+		content       []byte
+		status        int
+		expectContent []byte
+		expectHit     bool
+		expectErr     error
+	}{
+		{
+			title:         "not modified",
+			etag:          "v1",
+			content:       original,
+			expectContent: original,
+			expectHit:     true,
+		},
+		{
+			title:         "modified",
+			etag:          "v2",
+			content:       modified,
+			expectContent: modified,
+			expectHit:     false,
+		},
+		{
+			title:         "failed refresh keeps cached binary",
+			etag:          "v2",
+			content:       modified,
+			status:        http.StatusNotFound,
+			expectContent: original,
+			expectErr:     ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{}, original, sha256sum(original))
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("ETag", "v1")
+				_, _ = w.Write(original)
+			})
+
+			k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			// the binary is refreshed in the download server
+			provider.forceRefresh = true
+			provider.buildSrv = &testBuildService{
+				artifact: k6build.Artifact{ID: "artifact", URL: downloadSrv.URL, Checksum: sha256sum(tc.content)},
+			}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+					return
+				}
+				if r.Header.Get("If-None-Match") == tc.etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", tc.etag)
+				_, _ = w.Write(tc.content)
+			})
+
+			refreshed, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			got, err := os.ReadFile(k6.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, tc.expectContent) {
+				t.Fatalf("expected %q got %q", tc.expectContent, got)
+			}
+
+			if tc.expectErr == nil && refreshed.Stats.CacheHit != tc.expectHit {
+				t.Fatalf("expected cache hit %t got %t", tc.expectHit, refreshed.Stats.CacheHit)
+			}
+		})
+	}
+}
+
+func TestBypassCache(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{BypassCache: true}, content, sha256sum(content))
+
+	downloads := atomic.Int32{}
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		// the cached binary must not be revalidated
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", "v1")
+		_, _ = w.Write(content)
+	})
+
+	for range 2 {
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if k6.Stats.CacheHit {
+			t.Fatalf("unexpected cache hit")
+		}
+
+		// the binary is added to the cache
+		got, err := os.ReadFile(filepath.Join(provider.cacheDir(), "artifact", provider.binary))
+		if err != nil {
+			t.Fatalf("reading cached binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+	}
+
+	if downloads.Load() != 2 {
+		t.Fatalf("expected 2 downloads got %d", downloads.Load())
+	}
+
+	// a provider not bypassing the cache finds the binary
+	provider.bypassCache = false
+	k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if !k6.Stats.CacheHit {
+		t.Fatalf("expected cache hit")
+	}
+}
+
+func TestBypassCacheRequiresCache(t *testing.T) {
+	t.Parallel()
+
+	for _, config := range []Config{{NoCache: true}, {Offline: true}} {
+		config.BuildServiceURL = "http://localhost"
+		config.BypassCache = true
+		_, err := NewProvider(config)
+		if !errors.Is(err, ErrConfig) {
+			t.Fatalf("expected %v got %v", ErrConfig, err)
+		}
+	}
+}
+
+func TestArtifactInfo(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	// first call downloads the binary, the second obtains it from the cache
+	for range 2 {
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if k6.ArtifactID != "artifact" || k6.URL != downloadSrv.URL {
+			t.Fatalf("unexpected artifact %q url %q (cache hit %t)", k6.ArtifactID, k6.URL, k6.Stats.CacheHit)
+		}
+	}
+}
+
+func TestBuildDeps(t *testing.T) {
+	t.Parallel()
+
+	newDep := func(name, constraints string) *k6deps.Dependency {
+		dep, err := k6deps.NewDependency(name, constraints)
+		if err != nil {
+			t.Fatalf("creating dependency %v", err)
+		}
+		return dep
+	}
+
+	testCases := []struct {
+		title     string
+		deps      k6deps.Dependencies
+		expectK6  string
+		expect    []k6build.Dependency
+		expectErr error
+	}{
+		{
+			title:    "no dependencies",
+			deps:     k6deps.Dependencies{},
+			expectK6: "*",
+			expect:   []k6build.Dependency{},
+		},
+		{
+			title: "k6 and extensions",
+			deps: k6deps.Dependencies{
+				"k6":              newDep("k6", "v0.50.0"),
+				"k6/x/sql":        newDep("k6/x/sql", ""),
+				"k6/x/kubernetes": newDep(" k6/x/kubernetes ", ">v0.8.0"),
+			},
+			expectK6: "v0.50.0",
+			expect: []k6build.Dependency{
+				{Name: "k6/x/kubernetes", Constraints: ">v0.8.0"},
+				{Name: "k6/x/sql", Constraints: "*"},
+			},
+		},
+		{
+			title: "compatible duplicates",
+			deps: k6deps.Dependencies{
+				"k6/x/sql":  newDep("k6/x/sql", ">=v0.4.0"),
+				"k6/x/sql ": newDep("k6/x/sql ", "<v1.0.0"),
+			},
+			expectK6: "*",
+			expect: []k6build.Dependency{
+				{Name: "k6/x/sql", Constraints: ">=v0.4.0, <v1.0.0"},
+			},
+		},
+		{
+			title: "conflicting duplicates",
+			deps: k6deps.Dependencies{
+				"k6/x/sql":  newDep("k6/x/sql", "v0.4.0"),
+				"k6/x/sql ": newDep("k6/x/sql ", "v0.5.0"),
+			},
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "empty name",
+			deps:      k6deps.Dependencies{"k6/x/sql": newDep("", "*")},
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "missing dependency",
+			deps:      k6deps.Dependencies{"k6/x/sql": nil},
+			expectErr: ErrDependency,
+		},
+		{
+			title: "invalid constraints",
+			deps: k6deps.Dependencies{
+				"k6/x/sql": {Name: "k6/x/sql", Constraints: &semver.Constraints{}},
+			},
+			expectErr: ErrDependency,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			k6, deps, err := buildDeps(tc.deps)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if k6 != tc.expectK6 {
+				t.Fatalf("expected k6 %q got %q", tc.expectK6, k6)
+			}
+
+			if fmt.Sprint(deps) != fmt.Sprint(tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, deps)
+			}
+		})
+	}
+}
+
+func TestCancelledDownload(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		setup     func(t *testing.T, provider *Provider, cancel context.CancelFunc) http.HandlerFunc
+		timeout   time.Duration
+		expectErr error
+		stage     error
+	}{
+		{
+			title: "cancelled before build",
+			setup: func(_ *testing.T, _ *Provider, cancel context.CancelFunc) http.HandlerFunc {
+				cancel()
+				return nil
+			},
+			expectErr: context.Canceled,
+			stage:     ErrBuild,
+		},
+		{
+			title: "cancelled while waiting for lock",
+			setup: func(t *testing.T, provider *Provider, _ context.CancelFunc) http.HandlerFunc {
+				t.Helper()
+
+				if err := os.MkdirAll(provider.cacheDir(), 0o700); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+				lock := newArtifactLock(provider.cacheDir(), "artifact")
+				if err := lock.lock(); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+				t.Cleanup(func() { _ = lock.unlock() })
+
+				return nil
+			},
+			timeout:   100 * time.Millisecond,
+			expectErr: context.DeadlineExceeded,
+			stage:     ErrDownload,
+		},
+		{
+			title: "cancelled while downloading",
+			setup: func(_ *testing.T, _ *Provider, cancel context.CancelFunc) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+					_, _ = w.Write(content[:len(content)/2])
+					w.(http.Flusher).Flush() //nolint:forcetypeassert
+					cancel()
+					<-r.Context().Done()
+				}
+			},
+			expectErr: context.Canceled,
+			stage:     ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), tc.timeout)
+			}
+			defer cancel()
+
+			if handler := tc.setup(t, provider, cancel); handler != nil {
+				downloadSrv.Config.Handler = handler
+			}
+
+			_, err := provider.GetBinary(ctx, k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) || !errors.Is(err, tc.stage) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if _, err = os.Stat(filepath.Join(provider.cacheDir(), "artifact")); !os.IsNotExist(err) {
+				t.Fatalf("artifact directory left in cache %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title       string
+		err         error
+		expectErr   error
+		unsatisfied bool
+	}{
+		{
+			title: "unknown dependency",
+			err: k6build.NewWrappedError(
+				api.ErrBuildFailed,
+				k6build.NewWrappedError(ErrInvalidParameters, errors.New("unknown dependency : k6/x/unknown")),
+			),
+			expectErr:   ErrInvalidParameters,
+			unsatisfied: true,
+		},
+		{
+			title:       "invalid request",
+			err:         k6build.NewWrappedError(api.ErrInvalidRequest, errors.New("invalid dependency")),
+			expectErr:   api.ErrInvalidRequest,
+			unsatisfied: true,
+		},
+		{
+			title:       "service error",
+			err:         k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusServiceUnavailable}),
+			expectErr:   api.ErrRequestFailed,
+			unsatisfied: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, []byte("k6"), sha256sum([]byte("k6")))
+			provider.buildSrv = &testBuildService{err: tc.err}
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, ErrBuild) || !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if errors.Is(err, ErrBuildUnsatisfiable) != tc.unsatisfied {
+				t.Fatalf("expected unsatisfiable %t got %v", tc.unsatisfied, err)
+			}
+		})
+	}
+}
+
+func TestInvalidArtifactURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title string
+		url   string
+	}{
+		{title: "empty url", url: ""},
+		{title: "relative url", url: "/artifact/k6"},
+		{title: "unsupported scheme", url: "ftp://localhost/artifact/k6"},
+		{title: "malformed url", url: "http://local host/%zz"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, []byte("k6"), sha256sum([]byte("k6")))
+			provider.buildSrv = &testBuildService{
+				artifact: k6build.Artifact{ID: "artifact", URL: tc.url, Checksum: sha256sum([]byte("k6"))},
+			}
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, ErrBuild) {
+				t.Fatalf("expected %v got %v", ErrBuild, err)
+			}
+
+			if !strings.Contains(err.Error(), "artifact") {
+				t.Fatalf("expected a descriptive error got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidArtifactID(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title string
+		id    string
+	}{
+		{title: "empty id", id: ""},
+		{title: "parent dir", id: ".."},
+		{title: "path", id: "../artifact"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+			cached, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			// the checksum mismatch would remove the artifact's directory
+			provider.buildSrv = &testBuildService{
+				artifact: k6build.Artifact{ID: tc.id, URL: downloadSrv.URL, Checksum: sha256sum([]byte("other"))},
+			}
+
+			_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, ErrBuild) || !strings.Contains(err.Error(), "artifact id") {
+				t.Fatalf("expected %v got %v", ErrBuild, err)
+			}
+
+			if _, err = os.Stat(cached.Path); err != nil {
+				t.Fatalf("cached binary removed %v", err)
+			}
+		})
+	}
+}
+
+func TestK6Version(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+	provider.buildSrv = &testBuildService{
+		artifact: k6build.Artifact{
+			ID:           "artifact",
+			URL:          downloadSrv.URL,
+			Checksum:     sha256sum(content),
+			Dependencies: map[string]string{"k6": "v0.50.0", "k6/x/sql": "v0.4.0"},
+		},
+	}
+
+	// the second time, the binary is found in the cache
+	for range 2 {
+		k6, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+		if k6.K6Version != "v0.50.0" {
+			t.Fatalf("expected k6 version %s got %q", "v0.50.0", k6.K6Version)
+		}
+	}
+
+	k6, err := provider.Resolve(context.TODO(), k6deps.Dependencies{})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if k6.K6Version != "v0.50.0" {
+		t.Fatalf("expected k6 version %s got %q", "v0.50.0", k6.K6Version)
+	}
+}
+
+func TestDownloadError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title        string
+		status       int
+		body         string
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			title:        "forbidden",
+			status:       http.StatusForbidden,
+			body:         "access denied\n",
+			expectStatus: http.StatusForbidden,
+			expectBody:   "access denied",
+		},
+		{
+			title:        "not found without body",
+			status:       http.StatusNotFound,
+			expectStatus: http.StatusNotFound,
+			expectBody:   "",
+		},
+		{
+			title:        "body is truncated",
+			status:       http.StatusBadRequest,
+			body:         strings.Repeat("x", 2*maxErrorBodySize),
+			expectStatus: http.StatusBadRequest,
+			expectBody:   strings.Repeat("x", maxErrorBodySize),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, downloadSrv := newTestProvider(t, Config{}, []byte("k6"), sha256sum([]byte("k6")))
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			})
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, ErrDownload) {
+				t.Fatalf("expected %v got %v", ErrDownload, err)
+			}
+
+			var downloadErr *DownloadError
+			if !errors.As(err, &downloadErr) {
+				t.Fatalf("expected a DownloadError got %v", err)
+			}
+
+			if downloadErr.StatusCode != tc.expectStatus {
+				t.Fatalf("expected status %d got %d", tc.expectStatus, downloadErr.StatusCode)
+			}
+
+			if downloadErr.URL != downloadSrv.URL {
+				t.Fatalf("expected url %s got %s", downloadSrv.URL, downloadErr.URL)
+			}
+
+			if downloadErr.Body != tc.expectBody {
+				t.Fatalf("expected body %q got %q", tc.expectBody, downloadErr.Body)
+			}
+		})
+	}
+}
+
+func TestPlatformMismatch(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	t.Run("binary for other platform in cache", func(t *testing.T) {
+		t.Parallel()
+
+		provider, _ := newTestProvider(t, Config{Platform: "linux/amd64"}, content, sha256sum(content))
+
+		// simulate a binary for other platform cached with the same artifact ID
+		artifactDir := filepath.Join(provider.cacheDir(), "artifact")
+		if err := os.MkdirAll(artifactDir, 0o700); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(artifactDir, k6Binary), []byte("darwin binary"), 0o700); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+		other := newManifest(k6build.Artifact{ID: "artifact", Platform: "darwin/arm64"}, time.Now())
+		if err := writeManifest(artifactDir, other, 0o600); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+
+		binary, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if binary.Stats.CacheHit {
+			t.Fatalf("binary for other platform returned from cache")
+		}
+
+		got, err := os.ReadFile(binary.Path)
+		if err != nil {
+			t.Fatalf("reading binary %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("expected %q got %q", content, got)
+		}
+	})
+
+	t.Run("platforms sharing the cache", func(t *testing.T) {
+		t.Parallel()
+
+		linux, _ := newTestProvider(t, Config{Platform: "linux/amd64"}, content, sha256sum(content))
+		windows := linux.forPlatform("windows/amd64")
+
+		// the build service uses the same artifact ID for both platforms
+		linuxBinary, err := linux.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		windowsBinary, err := windows.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if windowsBinary.Stats.CacheHit || windowsBinary.Path == linuxBinary.Path {
+			t.Fatalf("binary for other platform returned from cache %s", windowsBinary.Path)
+		}
+	})
+}
+
+func TestNamespace(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	tenantA, _ := newTestProvider(t, Config{Namespace: "tenant-a"}, content, sha256sum(content))
+
+	tenantB, err := NewProvider(
+		WithBuildServiceURL("http://localhost"),
+		WithBinDir(filepath.Dir(tenantA.binDir)),
+		WithNamespace("tenant-b"),
+	)
+	if err != nil {
+		t.Fatalf("initializing provider %v", err)
+	}
+	tenantB.buildSrv = tenantA.buildSrv
+
+	for _, provider := range []*Provider{tenantA, tenantB} {
+		binary, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+		if binary.Stats.CacheHit {
+			t.Fatalf("binary shared across namespaces")
+		}
+	}
+
+	if _, err = tenantA.PruneCache(context.TODO(), 0); err != nil {
+		t.Fatalf("pruning cache %v", err)
+	}
+
+	cachedA, err := tenantA.ListCached(context.TODO())
+	if err != nil || len(cachedA) != 0 {
+		t.Fatalf("expected empty cache got %v %v", cachedA, err)
+	}
+
+	cachedB, err := tenantB.ListCached(context.TODO())
+	if err != nil || len(cachedB) != 1 {
+		t.Fatalf("expected 1 binary got %v %v", cachedB, err)
+	}
+}
+
+func TestValidNamespace(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		namespace string
+		expectErr bool
+	}{
+		{namespace: "tenant"},
+		{namespace: "tenant-a"},
+		{namespace: "linux-amd64-tenant"},
+		{namespace: "", expectErr: true},
+		{namespace: "..", expectErr: true},
+		{namespace: "../tenant", expectErr: true},
+		{namespace: "linux-amd64", expectErr: true},
+		{namespace: "Darwin-ARM64", expectErr: true},
+		{namespace: "windows-amd64", expectErr: true},
+		{namespace: "blobs", expectErr: true},
+		{namespace: "Blobs", expectErr: true},
+		{namespace: "tenant.json", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.namespace, func(t *testing.T) {
+			t.Parallel()
+
+			err := validNamespace(tc.namespace)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestCustomBinaryName(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		config    Config
+		expect    string
+		expectErr error
+	}{
+		{
+			title:  "custom name",
+			config: Config{Platform: "linux/amd64", BinaryName: "k6-v0.50.0"},
+			expect: "k6-v0.50.0",
+		},
+		{
+			title:  "custom name on windows",
+			config: Config{Platform: "windows/amd64", BinaryName: "myproject-k6"},
+			expect: "myproject-k6.exe",
+		},
+		{
+			title:  "custom name with suffix on windows",
+			config: Config{Platform: "windows/amd64", BinaryName: "myproject-k6.exe"},
+			expect: "myproject-k6.exe",
+		},
+		{
+			title:     "invalid name",
+			config:    Config{BinaryName: "../k6"},
+			expectErr: ErrConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.expectErr != nil {
+				config := tc.config
+				config.BuildServiceURL = "http://localhost"
+				if _, err := NewProvider(config); !errors.Is(err, tc.expectErr) {
+					t.Fatalf("expected %v got %v", tc.expectErr, err)
+				}
+				return
+			}
+
+			provider, _ := newTestProvider(t, tc.config, content, sha256sum(content))
+
+			binary, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if filepath.Base(binary.Path) != tc.expect {
+				t.Fatalf("expected %s got %s", tc.expect, filepath.Base(binary.Path))
+			}
+
+			cached, err := provider.ListCached(context.TODO())
+			if err != nil || len(cached) != 1 || cached[0].Path != binary.Path {
+				t.Fatalf("expected %s in cache got %v %v", binary.Path, cached, err)
+			}
+		})
+	}
+}
+
+// countingBuildService counts the builds and delays them, so concurrent builds overlap
+type countingBuildService struct {
+	testBuildService
+	builds atomic.Int32
+	delay  time.Duration
+}
+
+func (b *countingBuildService) Build(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	b.builds.Add(1)
+	select {
+	case <-ctx.Done():
+		return k6build.Artifact{}, ctx.Err()
+	case <-time.After(b.delay):
+	}
+	return b.testBuildService.Build(ctx, platform, k6Constrains, deps)
+}
+
+func TestConcurrentBuilds(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+	buildSrv := &countingBuildService{
+		testBuildService: *provider.buildSrv.(*testBuildService), //nolint:forcetypeassert
+		delay:            100 * time.Millisecond,
+	}
+	provider.buildSrv = buildSrv
+
+	downloads := atomic.Int32{}
+	handler := downloadSrv.Config.Handler
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		handler.ServeHTTP(w, r)
+	})
+
+	const callers = 10
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+	}
+
+	if buildSrv.builds.Load() != 1 {
+		t.Fatalf("expected 1 build got %d", buildSrv.builds.Load())
+	}
+
+	if downloads.Load() != 1 {
+		t.Fatalf("expected 1 download got %d", downloads.Load())
+	}
+}
+
+func TestCancelledSharedBuild(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+	buildSrv := &countingBuildService{
+		testBuildService: *provider.buildSrv.(*testBuildService), //nolint:forcetypeassert
+		delay:            100 * time.Millisecond,
+	}
+	provider.buildSrv = buildSrv
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := provider.GetBinary(ctx, k6deps.Dependencies{})
+		first <- err
+	}()
+
+	// wait for the first build to start and cancel it after the second caller joins
+	for buildSrv.builds.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v got %v", context.Canceled, err)
+	}
+
+	if err := <-second; err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+}
+
+func TestBeforeDownload(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	errPolicy := errors.New("extension not allowed")
+
+	testCases := []struct {
+		title           string
+		hookErr         error
+		expectErr       error
+		expectDownloads int32
+	}{
+		{
+			title:           "artifact accepted",
+			expectDownloads: 1,
+		},
+		{
+			title:           "artifact rejected",
+			hookErr:         errPolicy,
+			expectErr:       ErrRejected,
+			expectDownloads: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			checked := atomic.Value{}
+			config := Config{
+				BeforeDownload: func(artifact k6build.Artifact) error {
+					checked.Store(artifact.ID)
+					return tc.hookErr
+				},
+			}
+			provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+
+			downloads := atomic.Int32{}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				downloads.Add(1)
+				_, _ = w.Write(content)
+			})
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.hookErr != nil && !errors.Is(err, tc.hookErr) {
+				t.Fatalf("expected %v got %v", tc.hookErr, err)
+			}
+
+			if checked.Load() != "artifact" {
+				t.Fatalf("expected artifact to be checked got %v", checked.Load())
+			}
+
+			if downloads.Load() != tc.expectDownloads {
+				t.Fatalf("expected %d downloads got %d", tc.expectDownloads, downloads.Load())
+			}
+		})
+	}
+}
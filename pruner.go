@@ -1,6 +1,7 @@
 package k6provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -16,9 +17,12 @@ type Pruner struct {
 	pruneLock     sync.Mutex
 	dirLock       *dirLock
 	dir           string
+	binary        string
 	hwm           int64
 	pruneInterval time.Duration
 	lastPrune     time.Time
+	clock         clock
+	events        EventFunc
 }
 
 type pruneTarget struct {
@@ -30,11 +34,34 @@ type pruneTarget struct {
 // NewPruner creates a [Pruner] given its high-water-mark limit, and the
 // prune interval
 func NewPruner(dir string, hwm int64, pruneInterval time.Duration) *Pruner {
+	return newPruner(dir, k6Binary, hwm, pruneInterval, realClock{}, nil)
+}
+
+// newPruner creates a [Pruner] for binaries with the given name, reporting the binaries
+// evicted to the EventFunc, if not nil
+func newPruner(
+	dir string,
+	binary string,
+	hwm int64,
+	pruneInterval time.Duration,
+	clock clock,
+	events EventFunc,
+) *Pruner {
 	return &Pruner{
 		dirLock:       newFileLock(dir),
 		dir:           dir,
+		binary:        binary,
 		hwm:           hwm,
 		pruneInterval: pruneInterval,
+		clock:         clock,
+		events:        events,
+	}
+}
+
+// evicted reports the artifact was removed from the cache, freeing the given bytes
+func (p *Pruner) evicted(artifactDir string, freed int64) {
+	if p.events != nil {
+		p.events(Event{Kind: EventEvicted, ArtifactID: filepath.Base(artifactDir), Bytes: freed})
 	}
 }
 
@@ -43,7 +70,8 @@ func (p *Pruner) Touch(binPath string) {
 	if p.hwm > 0 {
 		p.pruneLock.Lock()
 		defer p.pruneLock.Unlock()
-		_ = os.Chtimes(binPath, time.Now(), time.Now())
+		now := p.clock.Now()
+		_ = os.Chtimes(binPath, now, now)
 	}
 }
 
@@ -59,10 +87,10 @@ func (p *Pruner) Prune() error {
 	}
 	defer p.pruneLock.Unlock()
 
-	if time.Since(p.lastPrune) < p.pruneInterval {
+	if p.clock.Since(p.lastPrune) < p.pruneInterval {
 		return nil
 	}
-	p.lastPrune = time.Now()
+	p.lastPrune = p.clock.Now()
 
 	// prevent concurrent prune to the directory
 	err := p.dirLock.lock()
@@ -74,7 +102,7 @@ func (p *Pruner) Prune() error {
 		return fmt.Errorf("%w: %w", ErrPruningCache, err)
 	}
 	defer func() {
-		_ = p.dirLock.unlock()
+		_ = p.dirLock.release()
 	}()
 
 	binaries, err := os.ReadDir(p.dir)
@@ -91,7 +119,7 @@ func (p *Pruner) Prune() error {
 			continue
 		}
 
-		binPath := filepath.Join(p.dir, binDir.Name(), k6Binary)
+		binPath := filepath.Join(p.dir, binDir.Name(), p.binary)
 		binInfo, err := os.Stat(binPath)
 		if err != nil {
 			errs = append(errs, err)
@@ -116,10 +144,15 @@ func (p *Pruner) Prune() error {
 	})
 
 	for _, target := range pruneTargets {
-		if err := os.RemoveAll(target.path); err != nil {
+		removed, err := p.removeUnlocked(target.path)
+		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
+		if !removed {
+			continue
+		}
+		p.evicted(target.path, target.size)
 
 		cacheSize -= target.size
 		if cacheSize <= p.hwm {
@@ -129,3 +162,129 @@ func (p *Pruner) Prune() error {
 
 	return fmt.Errorf("%w cache could not be pruned", errors.Join(errs...))
 }
+
+// removeUnlocked removes the artifact's directory unless it is locked, for example,
+// because the binary is being downloaded. Returns if the directory was removed.
+func (p *Pruner) removeUnlocked(artifactDir string) (bool, error) {
+	lock := newArtifactLock(p.dir, filepath.Base(artifactDir))
+	err := lock.lock()
+	if errors.Is(err, errLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = lock.release()
+	}()
+
+	if err = os.RemoveAll(artifactDir); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PruneOlderThan removes the binaries that were not used in the given period and returns
+// the number of bytes freed. Passing zero removes all binaries.
+// Binaries being downloaded are skipped.
+func (p *Pruner) PruneOlderThan(ctx context.Context, olderThan time.Duration) (int64, error) {
+	p.pruneLock.Lock()
+	defer p.pruneLock.Unlock()
+
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%w: %w", ErrPruningCache, err)
+	}
+
+	errs := []error{}
+	freed := int64(0)
+	threshold := p.clock.Now().Add(-olderThan)
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		// skip any spurious file, each binary is in a directory
+		if !entry.IsDir() {
+			continue
+		}
+
+		size, err := p.pruneArtifact(entry.Name(), threshold)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		freed += size
+	}
+
+	if len(errs) > 0 {
+		return freed, fmt.Errorf("%w: %w", ErrPruningCache, errors.Join(errs...))
+	}
+
+	return freed, nil
+}
+
+// pruneArtifact removes the artifact's directory if it was last used before the threshold
+// and it is not locked by a download. Returns the number of bytes freed.
+func (p *Pruner) pruneArtifact(id string, threshold time.Time) (int64, error) {
+	lock := newArtifactLock(p.dir, id)
+	err := lock.lock()
+	if errors.Is(err, errLocked) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = lock.release()
+	}()
+
+	artifactDir := filepath.Join(p.dir, id)
+	binInfo, err := os.Stat(filepath.Join(artifactDir, p.binary))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	// directories without binary are leftovers of failed downloads
+	if err == nil && !binInfo.ModTime().Before(threshold) {
+		return 0, nil
+	}
+
+	size, err := dirSize(artifactDir)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.RemoveAll(artifactDir); err != nil {
+		return 0, err
+	}
+	p.evicted(artifactDir, size)
+
+	return size, nil
+}
+
+// dirSize returns the size of the files in a directory
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(dir, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
@@ -1,6 +1,7 @@
 package k6provider
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -113,6 +114,110 @@ func TestPruner(t *testing.T) {
 					t.Fatal(err)
 				}
 			}
+
+			locks, err := filepath.Glob(filepath.Join(tmpDir, "*.lock"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(locks) > 0 {
+				t.Fatalf("expected no lock files got %v", locks)
+			}
+		})
+	}
+}
+
+func TestPruneOlderThan(t *testing.T) {
+	t.Parallel()
+
+	binaries := map[string]time.Time{
+		"binary-1": time.Now(),
+		"binary-2": time.Now().Add(-2 * time.Hour),
+		"binary-3": time.Now().Add(-time.Hour),
+		"binary-4": time.Now().Add(-3 * time.Hour),
+	}
+
+	testCases := []struct {
+		title       string
+		olderThan   time.Duration
+		expectFreed int64
+		expect      []string
+		expectGone  []string
+	}{
+		{
+			title:       "prune old binaries",
+			olderThan:   90 * time.Minute,
+			expectFreed: 256,
+			expect:      []string{"binary-1", "binary-3", "binary-4"},
+			expectGone:  []string{"binary-2"},
+		},
+		{
+			title:       "prune all binaries",
+			olderThan:   0,
+			expectFreed: 256 * 3,
+			expect:      []string{"binary-4"},
+			expectGone:  []string{"binary-1", "binary-2", "binary-3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			tmpDir := t.TempDir()
+			for path, modTime := range binaries {
+				err := os.MkdirAll(filepath.Join(tmpDir, path), 0o750)
+				if err != nil {
+					t.Fatalf("test setup: creating dir %v", err)
+				}
+				err = os.WriteFile(filepath.Join(tmpDir, path, k6Binary), make([]byte, 256), 0o600)
+				if err != nil {
+					t.Fatalf("test setup writing file %v", err)
+				}
+				err = os.Chtimes(filepath.Join(tmpDir, path, k6Binary), modTime, modTime)
+				if err != nil {
+					t.Fatalf("test setup changing mod timestamp %v", err)
+				}
+			}
+
+			// binary-4 is locked by a download in progress
+			lock := newArtifactLock(tmpDir, "binary-4")
+			if err := lock.lock(); err != nil {
+				t.Fatalf("test setup locking binary %v", err)
+			}
+			t.Cleanup(func() {
+				_ = lock.unlock()
+			})
+
+			pruner := NewPruner(tmpDir, 0, 0)
+			freed, err := pruner.PruneOlderThan(context.TODO(), tc.olderThan)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if freed != tc.expectFreed {
+				t.Fatalf("expected %d bytes freed got %d", tc.expectFreed, freed)
+			}
+
+			for _, binary := range tc.expect {
+				if _, err = os.Stat(filepath.Join(tmpDir, binary)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, binary := range tc.expectGone {
+				if _, err = os.Stat(filepath.Join(tmpDir, binary)); !os.IsNotExist(err) {
+					t.Fatalf("%s should be pruned", binary)
+				}
+			}
+
+			// only the lock of the download in progress is left
+			locks, err := filepath.Glob(filepath.Join(tmpDir, "*.lock"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(locks) != 1 || filepath.Base(locks[0]) != "binary-4.lock" {
+				t.Fatalf("expected only binary-4.lock got %v", locks)
+			}
 		})
 	}
 }
@@ -0,0 +1,133 @@
+package k6provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+)
+
+// ErrNotCached is returned in offline mode when the binary for a set of dependencies is not cached
+var ErrNotCached = errors.New("binary not cached")
+
+// Resolve requests the build service a binary that satisfies the given dependencies, without
+// downloading it. The returned K6Binary has the resolved dependencies, the checksum and the URL of
+// the binary, but an empty Path. It can be used for checking if a set of dependencies can be built.
+//
+// In offline mode, only the dependencies of cached binaries can be resolved.
+// Otherwise, an [ErrNotCached] error is returned.
+func (p *Provider) Resolve(ctx context.Context, deps k6deps.Dependencies) (K6Binary, error) {
+	if p.closed.Load() {
+		return K6Binary{}, ErrClosed
+	}
+
+	start := p.clock.Now()
+	artifact, stale, err := p.resolve(ctx, deps)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	return K6Binary{
+		Dependencies: artifact.Dependencies,
+		K6Version:    k6Version(artifact.Dependencies),
+		Checksum:     artifact.Checksum,
+		ArtifactID:   artifact.ID,
+		URL:          artifact.URL,
+		Stats:        BinaryStats{BuildDuration: p.clock.Since(start), Stale: stale},
+	}, nil
+}
+
+// Fingerprint returns a stable identifier for obtaining a binary for the platform (in the os/arch form)
+// and dependencies. The dependencies are canonicalized in the same way they are for requesting a
+// build: names are trimmed, duplicates are merged and they are sorted. Therefore, equivalent sets of
+// dependencies have the same fingerprint regardless of their order.
+//
+// Returns an [ErrDependency] error if the dependencies are not valid.
+func Fingerprint(platform string, deps k6deps.Dependencies) (string, error) {
+	k6Constrains, buildDeps, err := buildDeps(deps)
+	if err != nil {
+		return "", err
+	}
+
+	return fingerprint(platform, k6Constrains, buildDeps), nil
+}
+
+// fingerprint returns an unique identifier for a build request. Requests for the same platform
+// and dependencies have the same fingerprint regardless of the order of the dependencies.
+func fingerprint(platform string, k6Constrains string, deps []k6build.Dependency) string {
+	sorted := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		sorted = append(sorted, fmt.Sprintf("%s:%q", dep.Name, dep.Constraints))
+	}
+	sort.Strings(sorted)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "platform:%q;k6:%q;%s", platform, k6Constrains, strings.Join(sorted, ";"))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// resolutionPath returns the path to the file that records the artifact resolved
+// for a build request
+func resolutionPath(dir string, fingerprint string) string {
+	return filepath.Join(dir, fingerprint+".json")
+}
+
+// saveResolution records the artifact resolved for a build request, so it can be
+// obtained without requesting the build service. The file is written atomically so
+// concurrent readers never see a partial file.
+func saveResolution(dir string, fingerprint string, artifact k6build.Artifact, dirMode, fileMode os.FileMode) error {
+	err := os.MkdirAll(dir, dirMode)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, fingerprint+"-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(fileMode)
+	}
+	_ = tmp.Close()
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), resolutionPath(dir, fingerprint))
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// loadResolution returns the artifact previously resolved for a build request
+func loadResolution(dir string, fingerprint string) (k6build.Artifact, error) {
+	data, err := os.ReadFile(resolutionPath(dir, fingerprint))
+	if err != nil {
+		return k6build.Artifact{}, err
+	}
+
+	artifact := k6build.Artifact{}
+	err = json.Unmarshal(data, &artifact)
+
+	return artifact, err
+}
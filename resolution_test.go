@@ -0,0 +1,133 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6deps"
+)
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	deps := []k6build.Dependency{
+		{Name: "k6/x/kubernetes", Constraints: "v0.9.0"},
+		{Name: "k6/x/sql", Constraints: "*"},
+	}
+	reversed := []k6build.Dependency{deps[1], deps[0]}
+
+	if fingerprint("linux/amd64", "v0.50.0", deps) != fingerprint("linux/amd64", "v0.50.0", reversed) {
+		t.Fatalf("fingerprint depends on the order of dependencies")
+	}
+
+	if fingerprint("linux/amd64", "v0.50.0", deps) == fingerprint("linux/arm64", "v0.50.0", deps) {
+		t.Fatalf("fingerprint does not depend on platform")
+	}
+
+	if fingerprint("linux/amd64", "v0.50.0", deps) == fingerprint("linux/amd64", "v0.51.0", deps) {
+		t.Fatalf("fingerprint does not depend on k6 version")
+	}
+
+	if fingerprint("linux/amd64", "v0.50.0", deps) == fingerprint("linux/amd64", "v0.50.0", deps[:1]) {
+		t.Fatalf("fingerprint does not depend on dependencies")
+	}
+}
+
+func TestExportedFingerprint(t *testing.T) {
+	t.Parallel()
+
+	parse := func(t *testing.T, text string) k6deps.Dependencies {
+		t.Helper()
+
+		deps := k6deps.Dependencies{}
+		if err := deps.UnmarshalText([]byte(text)); err != nil {
+			t.Fatalf("parsing %q: %v", text, err)
+		}
+		return deps
+	}
+
+	fp := func(t *testing.T, platform string, deps k6deps.Dependencies) string {
+		t.Helper()
+
+		fingerprint, err := Fingerprint(platform, deps)
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+		return fingerprint
+	}
+
+	deps := parse(t, "k6=v0.50.0;k6/x/kafka>v0.1.0;k6/x/sql=*")
+	expected := fp(t, "linux/amd64", deps)
+
+	reordered := parse(t, "k6/x/sql=*;k6=v0.50.0;k6/x/kafka>v0.1.0")
+	if fp(t, "linux/amd64", reordered) != expected {
+		t.Fatalf("fingerprint depends on the order of dependencies")
+	}
+
+	padded := k6deps.Dependencies{}
+	for name, dep := range deps {
+		padded[name] = &k6deps.Dependency{Name: " " + dep.Name + " ", Constraints: dep.Constraints}
+	}
+	if fp(t, "linux/amd64", padded) != expected {
+		t.Fatalf("fingerprint depends on surrounding whitespace")
+	}
+
+	if fp(t, "linux/arm64", deps) == expected {
+		t.Fatalf("fingerprint does not depend on platform")
+	}
+
+	if fp(t, "linux/amd64", parse(t, "k6=v0.50.0;k6/x/kafka>v0.2.0;k6/x/sql=*")) == expected {
+		t.Fatalf("fingerprint does not depend on constraints")
+	}
+
+	if _, err := Fingerprint("linux/amd64", k6deps.Dependencies{"k6/x/sql": nil}); !errors.Is(err, ErrDependency) {
+		t.Fatalf("expected %v got %v", ErrDependency, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	t.Run("resolve without downloading", func(t *testing.T) {
+		t.Parallel()
+
+		provider, downloadSrv := newTestProvider(t, Config{}, content, sha256sum(content))
+
+		downloads := atomic.Int32{}
+		downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			downloads.Add(1)
+			_, _ = w.Write(content)
+		})
+
+		k6, err := provider.Resolve(context.TODO(), k6deps.Dependencies{})
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if k6.Path != "" || k6.URL != downloadSrv.URL || k6.Checksum != sha256sum(content) {
+			t.Fatalf("unexpected binary %v", k6)
+		}
+
+		if downloads.Load() != 0 {
+			t.Fatalf("expected no downloads got %d", downloads.Load())
+		}
+	})
+
+	t.Run("build failed", func(t *testing.T) {
+		t.Parallel()
+
+		provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+		provider.buildSrv = &testBuildService{err: k6build.NewWrappedError(api.ErrBuildFailed, errors.New("failed"))}
+
+		if _, err := provider.Resolve(context.TODO(), k6deps.Dependencies{}); !errors.Is(err, ErrBuild) {
+			t.Fatalf("expected %v got %v", ErrBuild, err)
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build/pkg/api"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMaxQueueWait   = 10 * time.Minute
+)
+
+// RetryConfig defines how failed requests to the build service and downloads are retried.
+// Only network errors and 5xx or 429 responses are retried.
+// If a 429 or 503 response from the build service or the download server has a Retry-After header,
+// the delay it requests is waited instead of the backoff, up to the deadline of the request's context.
+type RetryConfig struct {
+	// MaxAttempts maximum number of attempts, including the first one. Defaults to 3.
+	// Setting it to 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff time to wait before the first retry. Defaults to 1s.
+	// The backoff is doubled after every retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper limit for the backoff between retries. Defaults to 10s
+	MaxBackoff time.Duration
+	// MaxQueueWait is the maximum time waiting for a build queued by the build service
+	// to be ready. Defaults to 10m. When exceeded, the build fails with ErrBuildQueued.
+	MaxQueueWait time.Duration
+}
+
+// withDefaults returns a copy of the RetryConfig with the default values applied
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = c.InitialBackoff
+	}
+	if c.MaxQueueWait <= 0 {
+		c.MaxQueueWait = defaultMaxQueueWait
+	}
+	return c
+}
+
+// retryableError marks an error as transient, so the operation that produced it can be retried.
+// If after is set, it is the time to wait before retrying, instead of the backoff.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryableError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable returns true if the error was marked as retryable
+func isRetryable(err error) bool {
+	return errors.As(err, &retryableError{})
+}
+
+// isRetryableStatus returns true if the status code signals a transient error
+func isRetryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// retryableResponseError marks the error of a response with a transient status as retryable,
+// honoring the delay requested by its Retry-After header, if any
+func retryableResponseError(err error, resp *http.Response, now time.Time) error {
+	return retryableError{err: err, after: retryAfter(resp, now)}
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a 429 or 503 response, or
+// a 202 response for a queued build, either as delay-seconds or as an HTTP-date.
+// Returns 0 if there is no valid Retry-After header.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusAccepted:
+	default:
+		return 0
+	}
+
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 || seconds > math.MaxInt64/int64(time.Second) {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
+// retryDelay returns the time to wait before retrying the error: the delay requested by
+// the server, if any, capped by the deadline of the context. Otherwise, the backoff.
+func retryDelay(ctx context.Context, now time.Time, err error, backoff time.Duration) time.Duration {
+	delay := requestedDelay(err)
+	if delay <= 0 {
+		return backoff
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		delay = min(delay, max(deadline.Sub(now), 0))
+	}
+
+	return delay
+}
+
+// requestedDelay returns the delay requested by the server for retrying the error, if any.
+// It is set for retryable errors and the unexpected responses from the build service.
+func requestedDelay(err error) time.Duration {
+	retryable := retryableError{}
+	if errors.As(err, &retryable) {
+		return retryable.after
+	}
+
+	statusErr := &buildStatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.retryAfter
+	}
+
+	return 0
+}
+
+// isRetryableBuildError returns true if the build failed due to a network error, or
+// the build service returned a 5xx or 429 status
+func isRetryableBuildError(err error) bool {
+	if !errors.Is(err, api.ErrRequestFailed) {
+		return false
+	}
+
+	urlErr := &url.Error{}
+	if errors.As(err, &urlErr) {
+		return true
+	}
+
+	status, ok := buildErrorStatus(err)
+	return ok && isRetryableStatus(status)
+}
+
+// isTransientBuildError returns true if the build failed because the build service was not
+// available: a network error, a 5xx or 429 response, the BuildTimeout expired or the build
+// was queued for longer than the MaxQueueWait. Builds cancelled by the caller are not transient.
+func isTransientBuildError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || !errors.Is(err, ErrBuild) || errors.Is(err, ErrBuildUnsatisfiable) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrBuildQueued) {
+		return true
+	}
+
+	cause := errors.Unwrap(err)
+	return cause != nil && isRetryableBuildError(cause)
+}
+
+// isUnsatisfiableBuildError returns true if the build service rejected the request because
+// the dependencies can't be satisfied (e.g. unknown extension or version) or the request is invalid.
+// These errors are permanent and retrying the build won't help.
+func isUnsatisfiableBuildError(err error) bool {
+	if errors.Is(err, ErrInvalidParameters) || errors.Is(err, api.ErrInvalidRequest) {
+		return true
+	}
+
+	if !errors.Is(err, api.ErrRequestFailed) {
+		return false
+	}
+
+	status, ok := buildErrorStatus(err)
+	return ok && (status == http.StatusBadRequest ||
+		status == http.StatusNotFound ||
+		status == http.StatusUnprocessableEntity)
+}
+
+// isBuildQueued returns true if the build service accepted the build request but the build
+// is not ready yet (202 Accepted), for example, because the build service builds asynchronously
+func isBuildQueued(err error) bool {
+	if !errors.Is(err, api.ErrRequestFailed) {
+		return false
+	}
+
+	status, ok := buildErrorStatus(err)
+	return ok && status == http.StatusAccepted
+}
+
+// buildErrorStatus returns the status of an unexpected response from the build service,
+// reported by the build service client as a buildStatusError
+func buildErrorStatus(err error) (int, bool) {
+	statusErr := &buildStatusError{}
+	if !errors.As(err, &statusErr) {
+		return 0, false
+	}
+
+	return statusErr.status, true
+}
+
+// retry executes the operation until it succeeds, it returns a non retryable error
+// or the maximum number of attempts is reached, waiting an exponential backoff
+// between attempts, or the delay requested by the server (see retryDelay).
+// The waits use the given clock. If the context is cancelled, returns the context error
+// wrapping the last error.
+func retry(
+	ctx context.Context,
+	clock clock,
+	config RetryConfig,
+	retryable func(error) bool,
+	op func() error,
+) error {
+	backoff := config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= config.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-clock.After(retryDelay(ctx, clock.Now(), err, backoff)):
+		}
+
+		backoff = min(2*backoff, config.MaxBackoff)
+	}
+}
+
+// poll executes the operation until it returns an error that is not pending or the
+// context is cancelled, waiting an exponential backoff between attempts, or the delay
+// requested by the server (see retryDelay). Unlike retry, the number of attempts is not
+// limited, but if waiting for the next attempt would exceed the MaxQueueWait, if set, polling
+// stops with ErrBuildQueued. The wait function is called before each wait with the time to wait.
+// The waits use the given clock.
+func poll(
+	ctx context.Context,
+	clock clock,
+	config RetryConfig,
+	pending func(error) bool,
+	wait func(time.Duration),
+	op func() error,
+) error {
+	backoff := config.InitialBackoff
+	start := clock.Now()
+	for {
+		err := op()
+		if err == nil || !pending(err) {
+			return err
+		}
+
+		delay := retryDelay(ctx, clock.Now(), err, backoff)
+		if config.MaxQueueWait > 0 && clock.Since(start)+delay > config.MaxQueueWait {
+			return NewWrappedError(ErrBuildQueued, err)
+		}
+		if wait != nil {
+			wait(delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-clock.After(delay):
+		}
+
+		backoff = min(2*backoff, config.MaxBackoff)
+	}
+}
@@ -0,0 +1,426 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+)
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	errTransient := retryableError{err: errors.New("transient")}
+	errPermanent := errors.New("permanent")
+
+	config := RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	}
+
+	testCases := []struct {
+		title          string
+		errs           []error
+		expectErr      error
+		expectAttempts int
+	}{
+		{
+			title:          "success",
+			errs:           []error{nil},
+			expectErr:      nil,
+			expectAttempts: 1,
+		},
+		{
+			title:          "success after retry",
+			errs:           []error{errTransient, nil},
+			expectErr:      nil,
+			expectAttempts: 2,
+		},
+		{
+			title:          "permanent error is not retried",
+			errs:           []error{errPermanent},
+			expectErr:      errPermanent,
+			expectAttempts: 1,
+		},
+		{
+			title:          "max attempts reached",
+			errs:           []error{errTransient, errTransient, errTransient, nil},
+			expectErr:      errTransient,
+			expectAttempts: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			attempts := 0
+			err := retry(context.TODO(), realClock{}, config, isRetryable, func() error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if attempts != tc.expectAttempts {
+				t.Fatalf("expected %d attempts got %d", tc.expectAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	config := RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	err := retry(ctx, realClock{}, config, isRetryable, func() error {
+		return retryableError{err: errors.New("transient")}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v got %v", context.Canceled, err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		title  string
+		status int
+		header string
+		expect time.Duration
+	}{
+		{
+			title:  "delay seconds",
+			status: http.StatusTooManyRequests,
+			header: "120",
+			expect: 2 * time.Minute,
+		},
+		{
+			title:  "http date",
+			status: http.StatusTooManyRequests,
+			header: now.Add(30 * time.Second).Format(http.TimeFormat),
+			expect: 30 * time.Second,
+		},
+		{
+			title:  "service unavailable",
+			status: http.StatusServiceUnavailable,
+			header: "5",
+			expect: 5 * time.Second,
+		},
+		{
+			title:  "build queued",
+			status: http.StatusAccepted,
+			header: "10",
+			expect: 10 * time.Second,
+		},
+		{
+			title:  "date in the past",
+			status: http.StatusTooManyRequests,
+			header: now.Add(-time.Minute).Format(http.TimeFormat),
+			expect: 0,
+		},
+		{
+			title:  "invalid value",
+			status: http.StatusTooManyRequests,
+			header: "soon",
+			expect: 0,
+		},
+		{
+			title:  "negative delay",
+			status: http.StatusTooManyRequests,
+			header: "-5",
+			expect: 0,
+		},
+		{
+			title:  "no header",
+			status: http.StatusTooManyRequests,
+			expect: 0,
+		},
+		{
+			title:  "ignored for other status",
+			status: http.StatusInternalServerError,
+			header: "120",
+			expect: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+			if tc.header != "" {
+				resp.Header.Set("Retry-After", tc.header)
+			}
+
+			if got := retryAfter(resp, now); got != tc.expect {
+				t.Fatalf("expected %v got %v", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	config := RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	delay := time.Minute
+
+	clock := &testClock{now: time.Now()}
+	start := clock.Now()
+	attempts := 0
+	err := retry(context.TODO(), clock, config, isRetryable, func() error {
+		attempts++
+		if attempts == 1 {
+			return retryableError{err: errors.New("rate limited"), after: delay}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if waited := clock.Since(start); waited != delay {
+		t.Fatalf("expected to wait %v got %v", delay, waited)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	config := RetryConfig{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+
+	clock := &testClock{now: time.Now()}
+	start := clock.Now()
+	err := retry(context.TODO(), clock, config, isRetryable, func() error {
+		return retryableError{err: errors.New("transient")}
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// backoff of 1s, 2s and 3s (capped by the max backoff)
+	if waited := clock.Since(start); waited != 6*time.Second {
+		t.Fatalf("expected to wait %v got %v", 6*time.Second, waited)
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	t.Parallel()
+
+	config := RetryConfig{InitialBackoff: time.Second, MaxBackoff: 2 * time.Second}
+	errPending := errors.New("pending")
+
+	clock := &testClock{now: time.Now()}
+	start := clock.Now()
+	waits := []time.Duration{}
+	attempts := 0
+	err := poll(
+		context.TODO(),
+		clock,
+		config,
+		func(err error) bool { return errors.Is(err, errPending) },
+		func(wait time.Duration) { waits = append(waits, wait) },
+		func() error {
+			attempts++
+			if attempts < 4 {
+				return errPending
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	expect := []time.Duration{time.Second, 2 * time.Second, 2 * time.Second}
+	if !slices.Equal(waits, expect) {
+		t.Fatalf("expected waits %v got %v", expect, waits)
+	}
+
+	if waited := clock.Since(start); waited != 5*time.Second {
+		t.Fatalf("expected to wait %v got %v", 5*time.Second, waited)
+	}
+}
+
+func TestPollMaxQueueWait(t *testing.T) {
+	t.Parallel()
+
+	config := RetryConfig{InitialBackoff: time.Second, MaxBackoff: 2 * time.Second, MaxQueueWait: 4 * time.Second}
+	errPending := errors.New("pending")
+
+	clock := &testClock{now: time.Now()}
+	start := clock.Now()
+	attempts := 0
+	err := poll(
+		context.TODO(),
+		clock,
+		config,
+		func(err error) bool { return errors.Is(err, errPending) },
+		nil,
+		func() error {
+			attempts++
+			return errPending
+		},
+	)
+	if !errors.Is(err, ErrBuildQueued) {
+		t.Fatalf("expected %v got %v", ErrBuildQueued, err)
+	}
+
+	// waits 1s and 2s, the next wait would exceed the limit
+	if attempts != 3 {
+		t.Fatalf("expected %d attempts got %d", 3, attempts)
+	}
+
+	if waited := clock.Since(start); waited != 3*time.Second {
+		t.Fatalf("expected to wait %v got %v", 3*time.Second, waited)
+	}
+}
+
+func TestRetryAfterCappedByDeadline(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	config := RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	start := time.Now()
+	err := retry(ctx, realClock{}, config, isRetryable, func() error {
+		return retryableError{err: errors.New("rate limited"), after: time.Hour}
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the wait to be capped by the deadline, waited %v", elapsed)
+	}
+}
+
+func TestIsRetryableBuildError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		err    error
+		expect bool
+	}{
+		{
+			title:  "network error",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &url.Error{Op: "Post", Err: errors.New("refused")}),
+			expect: true,
+		},
+		{
+			title:  "service unavailable",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusServiceUnavailable}),
+			expect: true,
+		},
+		{
+			title:  "too many requests",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusTooManyRequests}),
+			expect: true,
+		},
+		{
+			title:  "unauthorized",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusUnauthorized}),
+			expect: false,
+		},
+		{
+			title:  "invalid request",
+			err:    k6build.NewWrappedError(api.ErrInvalidRequest, errors.New("invalid dependency")),
+			expect: false,
+		},
+		{
+			title:  "build failed",
+			err:    k6build.NewWrappedError(api.ErrBuildFailed, errors.New("compilation error")),
+			expect: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isRetryableBuildError(tc.err); got != tc.expect {
+				t.Fatalf("expected %t got %t", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestIsUnsatisfiableBuildError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		err    error
+		expect bool
+	}{
+		{
+			title: "unknown dependency",
+			err: k6build.NewWrappedError(
+				api.ErrBuildFailed,
+				k6build.NewWrappedError(ErrInvalidParameters, errors.New("unknown dependency : k6/x/unknown")),
+			),
+			expect: true,
+		},
+		{
+			title:  "invalid request",
+			err:    k6build.NewWrappedError(api.ErrInvalidRequest, errors.New("invalid dependency")),
+			expect: true,
+		},
+		{
+			title:  "not found",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusNotFound}),
+			expect: true,
+		},
+		{
+			title:  "service unavailable",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusServiceUnavailable}),
+			expect: false,
+		},
+		{
+			title:  "unauthorized",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &buildStatusError{status: http.StatusUnauthorized}),
+			expect: false,
+		},
+		{
+			title:  "network error",
+			err:    k6build.NewWrappedError(api.ErrRequestFailed, &url.Error{Op: "Post", Err: errors.New("refused")}),
+			expect: false,
+		},
+		{
+			title:  "build failed",
+			err:    k6build.NewWrappedError(api.ErrBuildFailed, errors.New("compilation error")),
+			expect: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isUnsatisfiableBuildError(tc.err); got != tc.expect {
+				t.Fatalf("expected %t got %t", tc.expect, got)
+			}
+		})
+	}
+}
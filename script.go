@@ -0,0 +1,186 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/grafana/k6deps"
+)
+
+// ErrScript indicates an error reading or analyzing a test script
+var ErrScript = errors.New("analyzing script")
+
+// GetBinaryFromScript returns a custom k6 binary that satisfies the dependencies
+// of the given test script.
+//
+// The dependencies are obtained by analyzing the script and the modules it imports,
+// including the version constraints defined using "use k6 with ..." pragmas.
+//
+// If the script can't be read or analyzed, an [ErrScript] error is returned.
+// Otherwise, it behaves as [Provider.GetBinary].
+func (p *Provider) GetBinaryFromScript(ctx context.Context, scriptPath string) (K6Binary, error) {
+	deps, err := scriptDeps(scriptPath)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	return p.GetBinary(ctx, deps)
+}
+
+// scriptDeps returns the dependencies of the given script
+func scriptDeps(scriptPath string) (k6deps.Dependencies, error) {
+	if _, err := os.Stat(scriptPath); err != nil {
+		return nil, NewWrappedError(ErrScript, fmt.Errorf("reading script: %w", err))
+	}
+
+	deps, err := k6deps.Analyze(&k6deps.Options{
+		Script:   k6deps.Source{Name: scriptPath},
+		Manifest: k6deps.Source{Ignore: true},
+		Env:      k6deps.Source{Ignore: true},
+	})
+	if err != nil {
+		return nil, NewWrappedError(ErrScript, err)
+	}
+
+	return deps, nil
+}
+
+// defaultScriptGlobs are the patterns of the scripts analyzed by GetBinaryFromDir if none is given
+var defaultScriptGlobs = []string{"*.js", "*.mjs", "*.ts"} //nolint:gochecknoglobals
+
+// GetBinaryFromDir returns a custom k6 binary that satisfies the dependencies of all the test
+// scripts in the given directory and its subdirectories, for example, for using the same binary
+// for all the tests in a repository.
+//
+// The scripts are the files matching any of the glob patterns, using the syntax of [path.Match].
+// Patterns without a "/" are matched against the name of the files. Otherwise, against their path
+// relative to the directory (e.g. "tests/*.js"). Defaults to "*.js", "*.mjs" and "*.ts".
+// Hidden directories and node_modules are skipped.
+//
+// The constraints of the dependencies in the scripts are intersected. If the constraints of two
+// scripts are mutually exclusive, an [ErrDependency] error reporting all the conflicts is returned.
+// If the directory has no scripts, or they can't be read or analyzed, an [ErrScript] error is returned.
+// Otherwise, it behaves as [Provider.GetBinary].
+func (p *Provider) GetBinaryFromDir(ctx context.Context, dir string, globs ...string) (K6Binary, error) {
+	deps, err := dirDeps(dir, globs)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	return p.GetBinary(ctx, deps)
+}
+
+// dirDeps returns the merged dependencies of the scripts in the directory matching the globs
+func dirDeps(dir string, globs []string) (k6deps.Dependencies, error) {
+	if len(globs) == 0 {
+		globs = defaultScriptGlobs
+	}
+
+	scripts, err := findScripts(dir, globs)
+	if err != nil {
+		return nil, NewWrappedError(ErrScript, err)
+	}
+	if len(scripts) == 0 {
+		return nil, NewWrappedError(ErrScript, fmt.Errorf("no scripts matching %s in %s", strings.Join(globs, ", "), dir))
+	}
+
+	// constraints merged so far and the script that introduced them, for reporting conflicts
+	merged := map[string]string{}
+	origin := map[string]string{}
+	errs := []error{}
+	for _, script := range scripts {
+		deps, err := scriptDeps(script)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dep := range deps.Sorted() {
+			constraints := dep.GetConstraints().String()
+			previous, found := merged[dep.Name]
+			if !found {
+				merged[dep.Name] = constraints
+				origin[dep.Name] = script
+				continue
+			}
+
+			intersection, err := mergeConstraints(previous, constraints)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(
+					"%q: %w: %s in %s and %s in %s",
+					dep.Name, errConflictingConstraints, previous, origin[dep.Name], constraints, script,
+				))
+				continue
+			}
+			if intersection != previous {
+				origin[dep.Name] = script
+			}
+			merged[dep.Name] = intersection
+		}
+	}
+	if len(errs) > 0 {
+		return nil, NewWrappedError(ErrDependency, errors.Join(errs...))
+	}
+
+	deps := k6deps.Dependencies{}
+	for name, constraints := range merged {
+		dep, err := k6deps.NewDependency(name, constraints)
+		if err != nil {
+			return nil, NewWrappedError(ErrDependency, fmt.Errorf("%q: %w", name, err))
+		}
+		deps[name] = dep
+	}
+
+	return deps, nil
+}
+
+// findScripts returns the files in the directory and its subdirectories matching any of the globs,
+// in lexical order. Hidden directories and node_modules are skipped.
+func findScripts(dir string, globs []string) ([]string, error) {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid script pattern %q: %w", glob, err)
+		}
+	}
+
+	scripts := []string{}
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			name := entry.Name()
+			if file != dir && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		for _, glob := range globs {
+			target := rel
+			if !strings.Contains(glob, "/") {
+				target = path.Base(rel)
+			}
+			if matched, _ := path.Match(glob, target); matched {
+				scripts = append(scripts, file)
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return scripts, err
+}
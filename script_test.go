@@ -0,0 +1,223 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScriptDeps(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		script    string
+		expect    map[string]string
+		expectErr error
+	}{
+		{
+			title:  "script with imports",
+			script: filepath.Join("testdata", "scripts", "main.js"),
+			expect: map[string]string{
+				"k6":         ">=v0.50",
+				"k6/x/faker": "*",
+				"k6/x/sql":   "*",
+			},
+		},
+		{
+			title:     "missing script",
+			script:    filepath.Join("testdata", "scripts", "missing.js"),
+			expectErr: ErrScript,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			deps, err := scriptDeps(tc.script)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(deps) != len(tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, deps)
+			}
+
+			for name, constraints := range tc.expect {
+				dep, found := deps[name]
+				if !found {
+					t.Fatalf("missing dependency %s in %v", name, deps)
+				}
+				if dep.GetConstraints().String() != constraints {
+					t.Fatalf("expected %s %s got %s", name, constraints, dep.GetConstraints())
+				}
+			}
+		})
+	}
+}
+
+func TestGetBinaryFromScript(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	binary, err := provider.GetBinaryFromScript(context.TODO(), filepath.Join("testdata", "scripts", "main.js"))
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if binary.Path == "" {
+		t.Fatalf("expected binary path")
+	}
+}
+
+func TestDirDeps(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		scripts   map[string]string
+		globs     []string
+		expect    map[string]string
+		expectErr error
+	}{
+		{
+			title: "constraints are intersected",
+			scripts: map[string]string{
+				"a.js":                "\"use k6 >= v0.50\";\nimport sql from \"k6/x/sql\";\n",
+				"tests/b.js":          "\"use k6 < v0.55\";\nimport faker from \"k6/x/faker\";\n",
+				"node_modules/lib.js": "import kafka from \"k6/x/kafka\";\n",
+				"README.md":           "import kafka from \"k6/x/kafka\";\n",
+			},
+			expect: map[string]string{
+				"k6":         ">=v0.50 <v0.55",
+				"k6/x/faker": "*",
+				"k6/x/sql":   "*",
+			},
+		},
+		{
+			title: "globs select the scripts",
+			scripts: map[string]string{
+				"a.js":       "import sql from \"k6/x/sql\";\n",
+				"tests/b.js": "import faker from \"k6/x/faker\";\n",
+			},
+			globs: []string{"tests/*.js"},
+			expect: map[string]string{
+				"k6/x/faker": "*",
+			},
+		},
+		{
+			title: "conflicting constraints",
+			scripts: map[string]string{
+				"a.js": "\"use k6 < v0.50\";\n",
+				"b.js": "\"use k6 > v0.55\";\n",
+			},
+			expectErr: ErrDependency,
+		},
+		{
+			title: "no scripts",
+			scripts: map[string]string{
+				"README.md": "no scripts",
+			},
+			expectErr: ErrScript,
+		},
+		{
+			title: "invalid glob",
+			scripts: map[string]string{
+				"a.js": "import sql from \"k6/x/sql\";\n",
+			},
+			globs:     []string{"[a-"},
+			expectErr: ErrScript,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			for name, content := range tc.scripts {
+				file := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+				if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+			}
+
+			deps, err := dirDeps(dir, tc.globs)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(deps) != len(tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, deps)
+			}
+
+			for name, constraints := range tc.expect {
+				dep, found := deps[name]
+				if !found {
+					t.Fatalf("missing dependency %s in %v", name, deps)
+				}
+				if dep.GetConstraints().String() != constraints {
+					t.Fatalf("expected %s %s got %s", name, constraints, dep.GetConstraints())
+				}
+			}
+		})
+	}
+}
+
+func TestDirDepsReportsConflictingScripts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.js": "\"use k6 < v0.50\";\n",
+		"b.js": "\"use k6 > v0.55\";\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+	}
+
+	_, err := dirDeps(dir, nil)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	for _, script := range []string{"a.js", "b.js"} {
+		if !strings.Contains(err.Error(), filepath.Join(dir, script)) {
+			t.Fatalf("expected %s to be reported in %v", script, err)
+		}
+	}
+}
+
+func TestGetBinaryFromDir(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+	binary, err := provider.GetBinaryFromDir(context.TODO(), filepath.Join("testdata", "scripts"))
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if binary.Path == "" {
+		t.Fatalf("expected binary path")
+	}
+}
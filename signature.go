@@ -0,0 +1,247 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// minisignSuffix is the suffix of the URL of minisign signatures, relative to the binary's URL
+	minisignSuffix = ".minisig"
+	// maxSignatureSize limits the size of the signatures downloaded
+	maxSignatureSize = 4096
+	// trustedCommentPrefix is the prefix of the trusted comment line in minisign signatures
+	trustedCommentPrefix = "trusted comment: "
+	// untrustedCommentPrefix is the prefix of the untrusted comment line in minisign keys and signatures
+	untrustedCommentPrefix = "untrusted comment: "
+)
+
+// errInvalidSignature is returned when the signature of a downloaded binary can't be verified
+var errInvalidSignature = errors.New("signature verification failed")
+
+// SignatureVerifier verifies the cryptographic signature of the downloaded binaries, as a protection
+// against tampered binaries in addition to their checksum.
+//
+// After a binary is downloaded, its signature is downloaded from the URL returned by SignatureURL,
+// using the same settings as the download, and the binary is verified with it. If the signature can't
+// be downloaded or is not valid, the binary is rejected.
+//
+// Implementations must be safe for concurrent use.
+type SignatureVerifier interface {
+	// SignatureURL returns the URL of the signature of the binary with the given URL
+	SignatureURL(binaryURL string) string
+	// Verify checks the signature of the binary. Returns an error if it is not valid
+	Verify(binary io.Reader, signature []byte) error
+}
+
+// minisignVerifier verifies minisign signatures using a public key.
+// See https://jedisct1.github.io/minisign/ for the format of the keys and signatures
+type minisignVerifier struct {
+	keyID     []byte
+	publicKey ed25519.PublicKey
+}
+
+// NewMinisignVerifier returns a [SignatureVerifier] for the signatures created with minisign using the
+// secret key of the given public key. The public key can be either the content of the key file
+// (e.g. "minisign.pub") or only the key (e.g. "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3").
+// Both the pre-hashed signatures (the default in recent versions of minisign) and the legacy signatures
+// are supported.
+//
+// The signature of each binary is expected at the binary's URL with the ".minisig" suffix added to its
+// path, keeping its query. The trusted comment of the signature is verified, but not checked.
+func NewMinisignVerifier(publicKey string) (SignatureVerifier, error) {
+	key, err := decodeMinisign(publicKey, 2+8+ed25519.PublicKeySize)
+	if err != nil {
+		return nil, NewWrappedError(ErrConfig, fmt.Errorf("invalid minisign public key: %w", err))
+	}
+
+	if string(key[:2]) != "Ed" {
+		return nil, NewWrappedError(ErrConfig, fmt.Errorf("unsupported minisign key algorithm %q", key[:2]))
+	}
+
+	return &minisignVerifier{keyID: key[2:10], publicKey: ed25519.PublicKey(key[10:])}, nil
+}
+
+// SignatureURL returns the URL of the signature of the binary with the given URL, adding the
+// ".minisig" suffix to its path. The query is kept, for example, for authenticating with a token,
+// but the fragment is removed. Invalid URLs get the suffix appended.
+func (v *minisignVerifier) SignatureURL(binaryURL string) string {
+	u, err := url.Parse(binaryURL)
+	if err != nil {
+		return binaryURL + minisignSuffix
+	}
+
+	u.Path += minisignSuffix
+	if u.RawPath != "" {
+		u.RawPath += minisignSuffix
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String()
+}
+
+// Verify checks the signature of the binary and the signature of its trusted comment
+func (v *minisignVerifier) Verify(binary io.Reader, signature []byte) error {
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(string(signature)), "\r\n", "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		return errors.New("invalid minisign signature format")
+	}
+
+	sig, err := decodeMinisign(lines[1], 2+8+ed25519.SignatureSize)
+	if err != nil {
+		return fmt.Errorf("invalid minisign signature: %w", err)
+	}
+
+	if !bytes.Equal(sig[2:10], v.keyID) {
+		return fmt.Errorf("signed with another key (key ID %s)", minisignKeyID(sig[2:10]))
+	}
+
+	var message []byte
+	switch string(sig[:2]) {
+	case "ED":
+		digest, _ := blake2b.New512(nil)
+		if _, err = io.Copy(digest, binary); err != nil {
+			return err
+		}
+		message = digest.Sum(nil)
+	case "Ed":
+		if message, err = io.ReadAll(binary); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", sig[:2])
+	}
+
+	if !ed25519.Verify(v.publicKey, message, sig[10:]) {
+		return errors.New("invalid signature")
+	}
+
+	globalSig, err := decodeMinisign(lines[3], ed25519.SignatureSize)
+	if err != nil {
+		return fmt.Errorf("invalid minisign trusted comment signature: %w", err)
+	}
+
+	// the trusted comment is signed together with the signature of the binary
+	trustedComment := strings.TrimPrefix(lines[2], trustedCommentPrefix)
+	signed := append(bytes.Clone(sig[10:]), trustedComment...)
+	if !ed25519.Verify(v.publicKey, signed, globalSig) {
+		return errors.New("invalid trusted comment signature")
+	}
+
+	return nil
+}
+
+// decodeMinisign decodes a base64 encoded minisign key or signature of the given size. The untrusted
+// comment that precedes them in their files is ignored.
+func decodeMinisign(encoded string, size int) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(encoded), "\n")
+	if len(lines) == 2 && strings.HasPrefix(lines[0], untrustedCommentPrefix) {
+		lines = lines[1:]
+	}
+	if len(lines) != 1 {
+		return nil, errors.New("invalid format")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != size {
+		return nil, fmt.Errorf("expected %d bytes got %d", size, len(decoded))
+	}
+
+	return decoded, nil
+}
+
+// minisignKeyID returns the key ID as shown by minisign
+func minisignKeyID(id []byte) string {
+	reversed := make([]byte, len(id))
+	for i, b := range id {
+		reversed[len(id)-1-i] = b
+	}
+	return fmt.Sprintf("%X", reversed)
+}
+
+// checkSignature verifies the signature of the binary in the given path, downloaded from the
+// artifact's URL, if a SignatureVerifier is configured
+func (p *Provider) checkSignature(ctx context.Context, path string, binaryURL string) error {
+	if p.sigVerifier == nil {
+		return nil
+	}
+
+	signature, err := p.fetchSignature(ctx, p.sigVerifier.SignatureURL(binaryURL))
+	if err != nil {
+		return fmt.Errorf("%w: downloading signature: %w", errInvalidSignature, err)
+	}
+
+	binary, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer binary.Close() //nolint:errcheck
+
+	if err = p.sigVerifier.Verify(binary, signature); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSignature, err)
+	}
+
+	return nil
+}
+
+// fetchSignature downloads the signature from the given URL, retrying transient failures.
+// Signatures referenced by file:// URLs are read from the local file system.
+func (p *Provider) fetchSignature(ctx context.Context, from string) ([]byte, error) {
+	if path, isLocal := localPath(from); isLocal {
+		return os.ReadFile(path) //nolint:gosec
+	}
+
+	var signature []byte
+	err := retry(ctx, p.clock, p.retry, isRetryable, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, from, nil)
+		if err != nil {
+			return err
+		}
+		req.Header = p.downloadHeaders.Clone()
+		if p.tracing {
+			injectTraceContext(ctx, req.Header)
+		}
+		injectContextHeaders(ctx, req.Header, p.contextHeaders)
+		if p.modifyDownload != nil {
+			p.modifyDownload(req)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return retryableError{err: err}
+		}
+		defer resp.Body.Close() //nolint:errcheck
+
+		if resp.StatusCode != http.StatusOK {
+			err = newDownloadError(from, resp)
+			if isRetryableStatus(resp.StatusCode) {
+				return retryableResponseError(err, resp, p.clock.Now())
+			}
+			return err
+		}
+
+		signature, err = io.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+		if err != nil {
+			return retryableError{err: err}
+		}
+
+		return nil
+	})
+
+	return signature, err
+}
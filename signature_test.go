@@ -0,0 +1,380 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignKey is a minisign key pair for testing
+type minisignKey struct {
+	id      []byte
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+func newMinisignKey(t *testing.T, id string) minisignKey {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	return minisignKey{id: []byte(id), public: public, private: private}
+}
+
+// publicKey returns the content of the public key file
+func (k minisignKey) publicKey() string {
+	key := append([]byte("Ed"), k.id...)
+	key = append(key, k.public...)
+
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(key) + "\n"
+}
+
+// sign returns the signature of the content using the given algorithm ("ED" for pre-hashed signatures)
+func (k minisignKey) sign(content []byte, algorithm string, trustedComment string) string {
+	message := content
+	if algorithm == "ED" {
+		digest := blake2b.Sum512(content)
+		message = digest[:]
+	}
+
+	sig := append([]byte(algorithm), k.id...)
+	sig = append(sig, ed25519.Sign(k.private, message)...)
+	globalSig := ed25519.Sign(k.private, append(sig[10:], trustedComment...))
+
+	return fmt.Sprintf(
+		"untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig),
+	)
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	key := newMinisignKey(t, "key-id-1")
+	otherKey := newMinisignKey(t, "key-id-2")
+
+	testCases := []struct {
+		title     string
+		signature string
+		status    int
+		noCache   bool
+		expectErr error
+	}{
+		{
+			title:     "pre-hashed signature",
+			signature: key.sign(content, "ED", "timestamp:1700000000"),
+		},
+		{
+			title:     "legacy signature",
+			signature: key.sign(content, "Ed", "timestamp:1700000000"),
+		},
+		{
+			title:     "tampered binary",
+			signature: key.sign([]byte("other binary"), "ED", "timestamp:1700000000"),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "signed with another key",
+			signature: otherKey.sign(content, "ED", "timestamp:1700000000"),
+			expectErr: ErrDownload,
+		},
+		{
+			title: "tampered trusted comment",
+			signature: strings.Replace(
+				key.sign(content, "ED", "timestamp:1700000000"), "1700000000", "1800000000", 1,
+			),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "invalid signature",
+			signature: "not a signature",
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "tampered uncached binary",
+			signature: key.sign([]byte("other binary"), "ED", "timestamp:1700000000"),
+			noCache:   true,
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "missing signature",
+			status:    http.StatusNotFound,
+			expectErr: ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			verifier, err := NewMinisignVerifier(key.publicKey())
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			storageDir := t.TempDir()
+			config := Config{SignatureVerifier: verifier, Storage: NewFileStorage(storageDir), NoCache: tc.noCache}
+			provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+			provider.buildSrv = &testBuildService{
+				artifact: k6build.Artifact{ID: "artifact", URL: downloadSrv.URL + "/k6", Checksum: sha256sum(content)},
+			}
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/k6" {
+					_, _ = w.Write(content)
+					return
+				}
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+					return
+				}
+				_, _ = w.Write([]byte(tc.signature))
+			})
+
+			_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			// rejected binaries are not uploaded to the storage
+			_, err = os.Stat(filepath.Join(storageDir, "artifact"))
+			if stored := err == nil; stored != (tc.expectErr == nil) {
+				t.Fatalf("expected stored %t got %v", tc.expectErr == nil, err)
+			}
+
+			if tc.noCache {
+				return
+			}
+
+			// rejected binaries are not added to the cache
+			cached, err := provider.ListCached(context.TODO())
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			expected := 1
+			if tc.expectErr != nil {
+				expected = 0
+			}
+			if len(cached) != expected {
+				t.Fatalf("expected %d cached binaries got %v", expected, cached)
+			}
+		})
+	}
+}
+
+func TestSignatureDownloadTimeout(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+	key := newMinisignKey(t, "key-id-1")
+
+	for _, noCache := range []bool{false, true} {
+		verifier, err := NewMinisignVerifier(key.publicKey())
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		config := Config{SignatureVerifier: verifier, DownloadTimeout: 100 * time.Millisecond, NoCache: noCache}
+		provider, downloadSrv := newTestProvider(t, config, content, sha256sum(content))
+		provider.buildSrv = &testBuildService{
+			artifact: k6build.Artifact{ID: "artifact", URL: downloadSrv.URL + "/k6", Checksum: sha256sum(content)},
+		}
+
+		// the signature server hangs past the download timeout
+		downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/k6" {
+				_, _ = w.Write(content)
+				return
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			_, _ = w.Write([]byte(key.sign(content, "ED", "timestamp:1700000000")))
+		})
+
+		start := time.Now()
+		_, err = provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+		if !errors.Is(err, ErrDownload) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected the signature download to time out, waited %v", elapsed)
+		}
+	}
+}
+
+func TestNewMinisignVerifier(t *testing.T) {
+	t.Parallel()
+
+	key := newMinisignKey(t, "key-id-1")
+	encoded := strings.Split(strings.TrimSpace(key.publicKey()), "\n")[1]
+
+	testCases := []struct {
+		title     string
+		publicKey string
+		expectErr error
+	}{
+		{
+			title:     "key file",
+			publicKey: key.publicKey(),
+		},
+		{
+			title:     "key only",
+			publicKey: encoded,
+		},
+		{
+			title:     "invalid encoding",
+			publicKey: "not a key",
+			expectErr: ErrConfig,
+		},
+		{
+			title:     "invalid size",
+			publicKey: base64.StdEncoding.EncodeToString([]byte("Ed")),
+			expectErr: ErrConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewMinisignVerifier(tc.publicKey)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSignatureURL(t *testing.T) {
+	t.Parallel()
+
+	verifier, err := NewMinisignVerifier(newMinisignKey(t, "key-id-1").publicKey())
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	testCases := []struct {
+		title  string
+		url    string
+		expect string
+	}{
+		{
+			title:  "path",
+			url:    "https://example.com/artifacts/id/k6",
+			expect: "https://example.com/artifacts/id/k6.minisig",
+		},
+		{
+			title:  "query",
+			url:    "https://bucket.example.com/k6?X-Amz-Expires=3600&X-Amz-Signature=abc",
+			expect: "https://bucket.example.com/k6.minisig?X-Amz-Expires=3600&X-Amz-Signature=abc",
+		},
+		{
+			title:  "fragment",
+			url:    "https://example.com/k6#fragment",
+			expect: "https://example.com/k6.minisig",
+		},
+		{
+			title:  "escaped path",
+			url:    "https://example.com/k6%2Fbinary",
+			expect: "https://example.com/k6%2Fbinary.minisig",
+		},
+		{
+			title:  "file url",
+			url:    "file:///tmp/k6",
+			expect: "file:///tmp/k6.minisig",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			if got := verifier.SignatureURL(tc.url); got != tc.expect {
+				t.Fatalf("expected %s got %s", tc.expect, got)
+			}
+		})
+	}
+}
+
+// TestMinisignReference verifies signatures created with the minisign tool, which are
+// in the testdata/minisign directory together with the public key and the signed file
+func TestMinisignReference(t *testing.T) {
+	t.Parallel()
+
+	publicKey, err := os.ReadFile(filepath.Join("testdata", "minisign", "minisign.pub"))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	verifier, err := NewMinisignVerifier(string(publicKey))
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	testCases := []struct {
+		title     string
+		signature string
+		content   string
+		expectErr bool
+	}{
+		{
+			title:     "pre-hashed signature",
+			signature: "test.minisig",
+		},
+		{
+			title:     "legacy signature",
+			signature: "test.legacy.minisig",
+		},
+		{
+			title:     "tampered binary",
+			signature: "test.minisig",
+			content:   "tampered",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			signature, err := os.ReadFile(filepath.Join("testdata", "minisign", tc.signature))
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join("testdata", "minisign", "test"))
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+			if tc.content != "" {
+				content = []byte(tc.content)
+			}
+
+			err = verifier.Verify(bytes.NewReader(content), signature)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package k6provider
+
+import (
+	"context"
+)
+
+// GetBinaryFromSpecs returns a custom k6 binary that satisfies the dependencies given as
+// name:version strings (e.g. "k6:v0.50.0", "k6/x/kubernetes:>v0.9.0"), as they are usually
+// received from command line flags. The version can be an exact version, a version constraint
+// or "latest". If the version is omitted, any version is accepted.
+//
+// If any of the specs is malformed, an [ErrDependency] error is returned.
+// Otherwise, it behaves as [Provider.GetBinary].
+func (p *Provider) GetBinaryFromSpecs(ctx context.Context, specs []string) (K6Binary, error) {
+	deps, err := parseSpecs(specs)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	return p.GetBinary(ctx, deps)
+}
@@ -0,0 +1,60 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetBinaryFromSpecs(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		specs     []string
+		expectErr error
+	}{
+		{
+			title: "no specs",
+			specs: nil,
+		},
+		{
+			title: "valid specs",
+			specs: []string{"k6:v0.50.0", "k6/x/kubernetes:>v0.9.0", "k6/x/sql:latest", "k6/x/faker"},
+		},
+		{
+			title:     "empty spec",
+			specs:     []string{"k6:v0.50.0", ""},
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "invalid version",
+			specs:     []string{"k6/x/kubernetes:not-a-version"},
+			expectErr: ErrDependency,
+		},
+		{
+			title:     "duplicated dependency",
+			specs:     []string{"k6:v0.50.0", "k6:v0.51.0"},
+			expectErr: ErrDependency,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, Config{}, content, sha256sum(content))
+
+			binary, err := provider.GetBinaryFromSpecs(context.TODO(), tc.specs)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err == nil && binary.Path == "" {
+				t.Fatalf("expected binary path")
+			}
+		})
+	}
+}
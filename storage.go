@@ -0,0 +1,228 @@
+package k6provider
+
+import (
+	"context"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/grafana/k6build"
+)
+
+// Storage is a store of binaries shared by multiple providers, for example, using a bucket in
+// S3 or GCS. It allows ephemeral runners to reuse the binaries downloaded by other runners.
+//
+// When a binary is not found in the BinDir cache, [Provider.GetBinary] copies it from the Storage
+// if available. Otherwise, it is downloaded from the build service and, once it is verified (checksum,
+// and format, signature and execution if enabled), uploaded to the Storage.
+// Binaries obtained from the Storage are verified using their checksum.
+//
+// Errors accessing the Storage are logged and don't fail the download.
+//
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Exists returns true if the binary with the given ID is in the storage
+	Exists(ctx context.Context, id string) (bool, error)
+	// Open returns the content of the binary with the given ID
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// Create returns a writer for storing the binary with the given ID.
+	// The binary must not be available until the writer is closed. If the upload fails,
+	// ctx is cancelled before closing the writer and the content must be discarded.
+	Create(ctx context.Context, id string) (io.WriteCloser, error)
+}
+
+// fileStorage is a Storage that keeps the binaries in a directory, for example,
+// in a shared network filesystem
+type fileStorage struct {
+	dir string
+}
+
+// NewFileStorage returns a [Storage] that stores each binary as a file in the given directory
+func NewFileStorage(dir string) Storage {
+	return &fileStorage{dir: dir}
+}
+
+func (s *fileStorage) Exists(_ context.Context, id string) (bool, error) {
+	if err := validCacheID(id); err != nil {
+		return false, err
+	}
+
+	_, err := os.Stat(filepath.Join(s.dir, id))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *fileStorage) Open(_ context.Context, id string) (io.ReadCloser, error) {
+	if err := validCacheID(id); err != nil {
+		return nil, err
+	}
+
+	return os.Open(filepath.Join(s.dir, id)) //nolint:gosec
+}
+
+func (s *fileStorage) Create(ctx context.Context, id string) (io.WriteCloser, error) {
+	if err := validCacheID(id); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.dir, defaultDirMode); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStorageWriter{ctx: ctx, File: tmp, path: filepath.Join(s.dir, id)}, nil
+}
+
+// fileStorageWriter writes a binary to a temporary file and moves it to its
+// final path when it is closed, unless the context was cancelled
+type fileStorageWriter struct {
+	*os.File
+	ctx  context.Context //nolint:containedctx
+	path string
+}
+
+func (w *fileStorageWriter) Close() error {
+	defer os.Remove(w.Name()) //nolint:errcheck
+
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(w.Name(), w.path)
+}
+
+// fetch copies the binary into the target file from the storage, if it is available there.
+// Otherwise, the binary is downloaded. The returned bool is true if the downloaded binary must be
+// uploaded to the storage, which is done by the caller using uploadStored once the binary is verified,
+// so a rejected binary is never shared with other providers.
+func (p *Provider) fetch(
+	ctx context.Context,
+	log *slog.Logger,
+	artifact k6build.Artifact,
+	cached validators,
+	expected int64,
+	target *os.File,
+) (int64, validators, bool, error) {
+	if p.storage == nil {
+		size, current, err := p.download(ctx, artifact, cached, expected, target)
+		return size, current, false, err
+	}
+
+	// refreshing a cached binary or bypassing the cache requires checking the download server
+	if cached == (validators{}) && !p.bypassCache {
+		if size, found := p.fetchStored(ctx, log, artifact, target); found {
+			log.Debug("binary copied from storage")
+			return size, validators{}, false, nil
+		}
+	}
+
+	size, current, err := p.download(ctx, artifact, cached, expected, target)
+
+	return size, current, err == nil, err
+}
+
+// fetchStored copies the binary from the storage into the target file, verifying its checksum.
+// Returns false if the binary was not copied. In this case, the target file is left empty.
+func (p *Provider) fetchStored(
+	ctx context.Context,
+	log *slog.Logger,
+	artifact k6build.Artifact,
+	target *os.File,
+) (int64, bool) {
+	found, err := p.storage.Exists(ctx, artifact.ID)
+	if err != nil {
+		log.Warn("checking binary in storage", slog.String("error", err.Error()))
+		return 0, false
+	}
+	if !found {
+		return 0, false
+	}
+
+	size, err := p.copyStored(ctx, artifact, target)
+	if err == nil {
+		return size, true
+	}
+
+	log.Warn("copying binary from storage", slog.String("error", err.Error()))
+
+	// discard any partial content
+	if err = resetFile(target); err != nil {
+		log.Warn("discarding binary from storage", slog.String("error", err.Error()))
+	}
+
+	return 0, false
+}
+
+// copyStored copies the binary from the storage to dest verifying its checksum
+func (p *Provider) copyStored(ctx context.Context, artifact k6build.Artifact, dest io.Writer) (int64, error) {
+	content, err := p.storage.Open(ctx, artifact.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close() //nolint:errcheck
+
+	digest, err := p.newDigest(artifact.Checksum)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.copyChecked(dest, content, digest, artifact.Checksum)
+}
+
+// copyChecked copies the content to dest verifying its checksum as copyHashed does,
+// unless InsecureSkipChecksum is enabled
+func (p *Provider) copyChecked(dest io.Writer, content io.Reader, digest hash.Hash, checksum string) (int64, error) {
+	if p.skipChecksum {
+		return io.Copy(dest, content)
+	}
+
+	return copyHashed(dest, content, digest, checksum)
+}
+
+// uploadStored uploads the downloaded binary in the given path to the storage.
+func (p *Provider) uploadStored(ctx context.Context, log *slog.Logger, artifact k6build.Artifact, path string) {
+	source, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		log.Warn("uploading binary to storage", slog.String("error", err.Error()))
+		return
+	}
+	defer source.Close() //nolint:errcheck
+
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dest, err := p.storage.Create(uploadCtx, artifact.ID)
+	if err != nil {
+		log.Warn("uploading binary to storage", slog.String("error", err.Error()))
+		return
+	}
+
+	_, err = io.Copy(dest, source)
+	if err != nil {
+		// signal the storage to discard the content
+		cancel()
+	}
+
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Warn("uploading binary to storage", slog.String("error", err.Error()))
+		return
+	}
+
+	log.Debug("binary uploaded to storage")
+}
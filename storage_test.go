@@ -0,0 +1,149 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestFileStorage(t *testing.T) {
+	t.Parallel()
+
+	storage := NewFileStorage(filepath.Join(t.TempDir(), "storage"))
+	content := []byte("k6 binary")
+
+	found, err := storage.Exists(context.TODO(), "artifact")
+	if err != nil || found {
+		t.Fatalf("expected binary not found got %t %v", found, err)
+	}
+
+	// an upload with a cancelled context must be discarded
+	ctx, cancel := context.WithCancel(context.Background())
+	writer, err := storage.Create(ctx, "artifact")
+	if err != nil {
+		t.Fatalf("creating binary %v", err)
+	}
+	_, _ = writer.Write(content)
+	cancel()
+	if err = writer.Close(); err == nil {
+		t.Fatalf("expected error closing cancelled upload")
+	}
+
+	found, err = storage.Exists(context.TODO(), "artifact")
+	if err != nil || found {
+		t.Fatalf("expected binary not found got %t %v", found, err)
+	}
+
+	writer, err = storage.Create(context.TODO(), "artifact")
+	if err != nil {
+		t.Fatalf("creating binary %v", err)
+	}
+	if _, err = writer.Write(content); err != nil {
+		t.Fatalf("writing binary %v", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("closing binary %v", err)
+	}
+
+	found, err = storage.Exists(context.TODO(), "artifact")
+	if err != nil || !found {
+		t.Fatalf("expected binary found got %t %v", found, err)
+	}
+
+	reader, err := storage.Open(context.TODO(), "artifact")
+	if err != nil {
+		t.Fatalf("opening binary %v", err)
+	}
+	defer reader.Close() //nolint:errcheck
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading binary %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("expected %q got %q", content, got)
+	}
+}
+
+func TestGetBinaryFromStorage(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title           string
+		stored          []byte
+		expectDownloads int32
+	}{
+		{
+			title:           "binary not in storage",
+			expectDownloads: 1,
+		},
+		{
+			title:           "binary in storage",
+			stored:          content,
+			expectDownloads: 0,
+		},
+		{
+			title:           "corrupted binary in storage",
+			stored:          []byte("corrupted"),
+			expectDownloads: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			storageDir := t.TempDir()
+			if tc.stored != nil {
+				if err := os.WriteFile(filepath.Join(storageDir, "artifact"), tc.stored, 0o600); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+			}
+
+			storage := NewFileStorage(storageDir)
+			provider, downloadSrv := newTestProvider(t, Config{Storage: storage}, content, sha256sum(content))
+
+			downloads := atomic.Int32{}
+			handler := downloadSrv.Config.Handler
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloads.Add(1)
+				handler.ServeHTTP(w, r)
+			})
+
+			binary, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if downloads.Load() != tc.expectDownloads {
+				t.Fatalf("expected %d downloads got %d", tc.expectDownloads, downloads.Load())
+			}
+
+			got, err := os.ReadFile(binary.Path)
+			if err != nil {
+				t.Fatalf("reading binary %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("expected %q got %q", content, got)
+			}
+
+			// downloaded binaries are uploaded to the storage
+			stored, err := os.ReadFile(filepath.Join(storageDir, "artifact"))
+			if err != nil {
+				t.Fatalf("reading stored binary %v", err)
+			}
+			if tc.expectDownloads > 0 && !bytes.Equal(stored, content) {
+				t.Fatalf("expected %q got %q", content, stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6deps"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GetBinaryStream obtains a custom k6 binary that satisfies the given dependencies and writes it
+// to dest, without storing it in the BinDir cache. The checksum of the binary is verified while it is
+// written. If a [Cache] is configured, the binary is obtained from it if available. Otherwise, it is
+// stored in the [Cache] while it is downloaded. A cached binary that doesn't match the checksum is
+// downloaded again, replacing it in the [Cache].
+//
+// The returned K6Binary has an empty Path. If an error is returned, any content already written
+// to dest must be discarded.
+//
+// Streaming binaries requires the build service, therefore it is not supported in offline mode.
+func (p *Provider) GetBinaryStream(
+	ctx context.Context,
+	deps k6deps.Dependencies,
+	dest io.Writer,
+) (K6Binary, error) {
+	ctx, span := p.tracer.Start(
+		ctx,
+		"k6provider.GetBinaryStream",
+		trace.WithAttributes(attrPlatform.String(p.platform)),
+	)
+
+	binary, err := p.getBinaryStream(ctx, deps, dest)
+	if err == nil {
+		span.SetAttributes(attrBytes.Int64(binary.Stats.Size))
+	}
+	endSpan(span, err)
+
+	return binary, err
+}
+
+// getBinaryStream implements GetBinaryStream
+func (p *Provider) getBinaryStream(
+	ctx context.Context,
+	deps k6deps.Dependencies,
+	dest io.Writer,
+) (K6Binary, error) {
+	if p.closed.Load() {
+		return K6Binary{}, ErrClosed
+	}
+
+	if p.offline {
+		return K6Binary{}, NewWrappedError(ErrConfig, errors.New("streaming binaries is not supported in offline mode"))
+	}
+
+	buildStart := p.clock.Now()
+	k6Constrains, bdeps, err := p.checkedDeps(deps)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	artifact, err := p.sharedBuild(ctx, k6Constrains, bdeps)
+	if err != nil {
+		return K6Binary{}, err
+	}
+
+	stats := BinaryStats{BuildDuration: p.clock.Since(buildStart)}
+
+	if err = p.checkArtifact(artifact); err != nil {
+		return K6Binary{}, err
+	}
+
+	downloadCtx, cancel := withTimeout(ctx, p.downloadTimeout)
+	defer cancel()
+
+	log := p.logger.With(slog.String("artifact_id", artifact.ID), slog.String("url", artifact.URL))
+
+	if p.cache != nil {
+		size, found, cacheErr := p.streamCached(ctx, log, artifact, dest)
+		if found {
+			if cacheErr != nil {
+				return K6Binary{}, NewWrappedError(ErrBinary, cacheErr)
+			}
+			log.Debug("cache hit")
+			p.metrics.IncCacheHit()
+			stats.CacheHit = true
+			stats.Size = size
+			p.emit(Event{Kind: EventCacheHit, ArtifactID: artifact.ID, Bytes: size})
+			return streamedBinary(artifact, stats), nil
+		}
+		log.Debug("cache miss")
+		p.metrics.IncCacheMiss()
+	}
+
+	log.Debug("streaming started")
+	p.emit(Event{Kind: EventDownloadStarted, ArtifactID: artifact.ID})
+	downloadStart := p.clock.Now()
+
+	size, err := p.streamDownload(downloadCtx, log, artifact, dest)
+	p.downloadCompleted(artifact.ID, size, p.clock.Since(downloadStart), err)
+	if err != nil {
+		log.Error("streaming binary", slog.String("error", err.Error()))
+		return K6Binary{}, NewWrappedError(ErrDownload, err)
+	}
+
+	stats.DownloadDuration = p.clock.Since(downloadStart)
+	stats.Size = size
+	p.metrics.ObserveDownloadDuration(stats.DownloadDuration)
+	p.metrics.AddDownloadedBytes(size)
+
+	log.Info("streaming completed", slog.Int64("bytes", size), slog.Duration("duration", stats.DownloadDuration))
+
+	return streamedBinary(artifact, stats), nil
+}
+
+// streamedBinary returns the K6Binary for a streamed artifact
+func streamedBinary(artifact k6build.Artifact, stats BinaryStats) K6Binary {
+	return K6Binary{
+		Dependencies: artifact.Dependencies,
+		K6Version:    k6Version(artifact.Dependencies),
+		Checksum:     artifact.Checksum,
+		ArtifactID:   artifact.ID,
+		URL:          artifact.URL,
+		Stats:        stats,
+	}
+}
+
+// streamCached copies the binary from the cache to dest, verifying its checksum.
+// Returns false if the binary is not in the cache. Errors reading the cache are
+// logged and handled as a cache miss.
+//
+// The binary is verified before anything is written to dest, so a corrupted binary is also
+// handled as a cache miss, and it is replaced in the cache when the binary is downloaded.
+func (p *Provider) streamCached(
+	ctx context.Context,
+	log *slog.Logger,
+	artifact k6build.Artifact,
+	dest io.Writer,
+) (int64, bool, error) {
+	if !p.skipChecksum {
+		err := p.checkStreamCached(ctx, artifact)
+		if errors.Is(err, errChecksumMismatch) {
+			log.Warn("discarding corrupted binary in cache", slog.String("error", err.Error()))
+			return 0, false, nil
+		}
+		if err != nil {
+			if !errors.Is(err, ErrNotCached) {
+				log.Warn("reading binary from cache", slog.String("error", err.Error()))
+			}
+			return 0, false, nil
+		}
+	}
+
+	content, err := p.cache.Get(ctx, artifact.ID)
+	if err != nil {
+		if !errors.Is(err, ErrNotCached) {
+			log.Warn("reading binary from cache", slog.String("error", err.Error()))
+		}
+		return 0, false, nil
+	}
+	defer content.Close() //nolint:errcheck
+
+	digest, err := p.newDigest(artifact.Checksum)
+	if err != nil {
+		return 0, true, err
+	}
+
+	// the binary is verified again, as it could be replaced in the cache after it was checked
+	size, err := p.copyChecked(dest, content, digest, artifact.Checksum)
+	return size, true, err
+}
+
+// checkStreamCached verifies the checksum of the binary in the Cache
+func (p *Provider) checkStreamCached(ctx context.Context, artifact k6build.Artifact) error {
+	digest, err := p.newDigest(artifact.Checksum)
+	if err != nil {
+		return err
+	}
+
+	content, err := p.cache.Get(ctx, artifact.ID)
+	if err != nil {
+		return err
+	}
+	defer content.Close() //nolint:errcheck
+
+	_, err = copyHashed(io.Discard, content, digest, artifact.Checksum)
+	return err
+}
+
+// streamDownload downloads the binary to dest. If a cache is configured, the binary is
+// stored in the cache at the same time. Failing to store the binary doesn't fail the download.
+func (p *Provider) streamDownload(
+	ctx context.Context,
+	log *slog.Logger,
+	artifact k6build.Artifact,
+	dest io.Writer,
+) (int64, error) {
+	if p.cache == nil {
+		size, _, err := p.download(ctx, artifact, validators{}, -1, dest)
+		return size, err
+	}
+
+	reader, writer := io.Pipe()
+	stored := make(chan error, 1)
+	go func() {
+		err := p.cache.Put(ctx, artifact.ID, reader)
+		// unblock the download if the cache didn't read all the content
+		_ = reader.CloseWithError(err)
+		stored <- err
+	}()
+
+	cacheWriter := &discardOnError{writer: writer}
+	size, _, err := p.download(ctx, artifact, validators{}, -1, io.MultiWriter(dest, cacheWriter))
+
+	// an error prevents the cache from storing an incomplete or corrupted binary
+	_ = writer.CloseWithError(err)
+	if putErr := <-stored; putErr != nil && err == nil {
+		log.Warn("storing binary in cache", slog.String("error", putErr.Error()))
+	}
+
+	return size, err
+}
+
+// discardOnError is a writer that discards the content after the first error writing it
+type discardOnError struct {
+	writer io.Writer
+	err    error
+}
+
+func (d *discardOnError) Write(b []byte) (int, error) {
+	if d.err == nil {
+		_, d.err = d.writer.Write(b)
+	}
+	return len(b), nil
+}
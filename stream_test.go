@@ -0,0 +1,187 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+func TestGetBinaryStream(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		config    Config
+		checksum  string
+		expectErr error
+	}{
+		{
+			title:    "stream binary",
+			checksum: sha256sum(content),
+		},
+		{
+			title:     "checksum mismatch",
+			checksum:  sha256sum([]byte("other binary")),
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "offline mode",
+			config:    Config{Offline: true},
+			checksum:  sha256sum(content),
+			expectErr: ErrConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			provider, _ := newTestProvider(t, tc.config, content, tc.checksum)
+
+			dest := &bytes.Buffer{}
+			binary, err := provider.GetBinaryStream(context.TODO(), k6deps.Dependencies{}, dest)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if !bytes.Equal(dest.Bytes(), content) {
+				t.Fatalf("expected %q got %q", content, dest.Bytes())
+			}
+
+			if binary.Path != "" || binary.Stats.Size != int64(len(content)) {
+				t.Fatalf("unexpected binary %v", binary)
+			}
+
+			// nothing is written to the cache
+			entries, err := os.ReadDir(provider.binDir)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatalf("reading cache %v", err)
+			}
+			if len(entries) != 0 {
+				t.Fatalf("expected empty cache got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestGetBinaryStreamCache(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	testCases := []struct {
+		title     string
+		checksum  string
+		expectErr error
+		expectHit bool
+	}{
+		{
+			title:     "binary is cached",
+			checksum:  sha256sum(content),
+			expectHit: true,
+		},
+		{
+			title:     "corrupted binary is not cached",
+			checksum:  sha256sum([]byte("other binary")),
+			expectErr: ErrDownload,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			cache := NewMemoryCache()
+			provider, downloadSrv := newTestProvider(t, Config{Cache: cache}, content, tc.checksum)
+
+			binary, err := provider.GetBinaryStream(context.TODO(), k6deps.Dependencies{}, &bytes.Buffer{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if binary.Stats.CacheHit {
+				t.Fatalf("expected cache miss")
+			}
+
+			// the binary must be obtained from the cache
+			downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+
+			dest := &bytes.Buffer{}
+			binary, err = provider.GetBinaryStream(context.TODO(), k6deps.Dependencies{}, dest)
+			if !tc.expectHit {
+				if !errors.Is(err, ErrDownload) {
+					t.Fatalf("expected %v got %v", ErrDownload, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if !binary.Stats.CacheHit {
+				t.Fatalf("expected cache hit")
+			}
+
+			if !bytes.Equal(dest.Bytes(), content) {
+				t.Fatalf("expected %q got %q", content, dest.Bytes())
+			}
+		})
+	}
+}
+
+func TestGetBinaryStreamCorruptedCache(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("k6 binary")
+
+	cache := NewMemoryCache()
+	if err := cache.Put(context.TODO(), "artifact", bytes.NewReader([]byte("corrupted"))); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	provider, downloadSrv := newTestProvider(t, Config{Cache: cache}, content, sha256sum(content))
+
+	// the corrupted binary is handled as a cache miss, without writing it to dest
+	dest := &bytes.Buffer{}
+	binary, err := provider.GetBinaryStream(context.TODO(), k6deps.Dependencies{}, dest)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if binary.Stats.CacheHit {
+		t.Fatalf("expected cache miss")
+	}
+
+	if !bytes.Equal(dest.Bytes(), content) {
+		t.Fatalf("expected %q got %q", content, dest.Bytes())
+	}
+
+	// the corrupted binary is replaced in the cache by the downloaded one
+	downloadSrv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	dest = &bytes.Buffer{}
+	binary, err = provider.GetBinaryStream(context.TODO(), k6deps.Dependencies{}, dest)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if !binary.Stats.CacheHit || !bytes.Equal(dest.Bytes(), content) {
+		t.Fatalf("expected cache hit with %q got %q", content, dest.Bytes())
+	}
+}
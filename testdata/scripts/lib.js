@@ -0,0 +1,6 @@
+import sql from "k6/x/sql";
+
+export function greeting(name) {
+  sql.open("sqlite3", ":memory:");
+  return `hello ${name}`;
+}
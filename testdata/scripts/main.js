@@ -0,0 +1,8 @@
+"use k6 >= v0.50";
+
+import faker from "k6/x/faker";
+import { greeting } from "./lib.js";
+
+export default function () {
+  console.log(greeting(faker.person.firstName()));
+}
@@ -0,0 +1,46 @@
+package k6provider
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// maxThrottleBurst limits the bytes read at once from a throttled reader
+const maxThrottleBurst = 64 * 1024
+
+// throttledReader limits the rate of reading from the underlying reader
+type throttledReader struct {
+	ctx     context.Context //nolint:containedctx
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+// newThrottledReader returns a reader that reads at most bytesPerSec bytes per second
+func newThrottledReader(ctx context.Context, reader io.Reader, bytesPerSec int64) *throttledReader {
+	burst := int(min(bytesPerSec, int64(maxThrottleBurst)))
+	return &throttledReader{
+		ctx:     ctx,
+		reader:  reader,
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+	}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	// a read can't exceed the burst, otherwise it would never be allowed
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+
+	n, err := r.reader.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+
+	return n, err
+}
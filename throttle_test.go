@@ -0,0 +1,49 @@
+package k6provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottledReader(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("k"), 2000)
+
+	t.Run("limits rate", func(t *testing.T) {
+		t.Parallel()
+
+		// the first 1000 bytes are allowed immediately (burst), the rest takes ~1s
+		reader := newThrottledReader(context.TODO(), bytes.NewReader(content), 1000)
+
+		start := time.Now()
+		got, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected %v", err)
+		}
+
+		if !bytes.Equal(got, content) {
+			t.Fatalf("content doesn't match")
+		}
+
+		if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+			t.Fatalf("expected read to be throttled, took %s", elapsed)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		reader := newThrottledReader(ctx, bytes.NewReader(content), 1000)
+		if _, err := io.ReadAll(reader); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v got %v", context.Canceled, err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package k6provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = modulePath
+
+// span attributes
+const (
+	attrPlatform   = attribute.Key("k6provider.platform")
+	attrArtifactID = attribute.Key("k6provider.artifact_id")
+	attrCacheHit   = attribute.Key("k6provider.cache_hit")
+	attrBytes      = attribute.Key("k6provider.bytes")
+)
+
+// newTracer returns the tracer for the provider's spans.
+// If no TracerProvider is given, a no-op tracer is returned.
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// endSpan records the error (if any) in the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTraceContext adds the trace context from ctx to the request headers
+func injectTraceContext(ctx context.Context, header http.Header) {
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// injectContextHeaders sets the request headers mapped to the keys in ctx (see Config.ContextHeaders)
+func injectContextHeaders(ctx context.Context, header http.Header, headers map[any]string) {
+	for key, name := range headers {
+		switch value := ctx.Value(key).(type) {
+		case string:
+			header.Set(name, value)
+		case fmt.Stringer:
+			header.Set(name, value.String())
+		}
+	}
+}
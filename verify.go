@@ -0,0 +1,74 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// verifyExecutableTimeout limits the time for running the binary for verifying it
+const verifyExecutableTimeout = 10 * time.Second
+
+// errVerificationFailed is returned when a binary fails or doesn't report the expected version
+var errVerificationFailed = errors.New("binary verification failed")
+
+// reK6Version matches the version of k6 in the output of the version command. e.g. "k6 v0.50.0 (go1.22.1, linux/amd64)"
+var reK6Version = regexp.MustCompile(`\bk6 (v?\d+\.\d+\.\d+[^\s,()]*)`) //nolint:gochecknoglobals
+
+// checkExecutable runs the "version" command of the binary in the given path, checking it executes
+// and reports the expected version of k6, if any. Binaries for a platform other than the host's
+// can't be executed and are not checked. If the binary can't be started at all, for example,
+// because its filesystem is mounted with noexec, it returns ErrCannotExecute.
+func checkExecutable(ctx context.Context, path string, platform string, expected string) error {
+	if platform != runtime.GOOS+"/"+runtime.GOARCH {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyExecutableTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "version").Output() //nolint:gosec
+	if err != nil {
+		exitErr := &exec.ExitError{}
+		if !errors.As(err, &exitErr) {
+			return NewWrappedError(ErrCannotExecute, err)
+		}
+		if len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("%w: %w: %s", errVerificationFailed, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("%w: %w", errVerificationFailed, err)
+	}
+
+	if expected == "" {
+		return nil
+	}
+
+	match := reK6Version.FindStringSubmatch(string(output))
+	if match == nil {
+		return fmt.Errorf("%w: version not reported: %q", errVerificationFailed, strings.TrimSpace(string(output)))
+	}
+
+	reported, err := semver.NewVersion(match[1])
+	if err != nil {
+		return fmt.Errorf("%w: invalid version %q: %w", errVerificationFailed, match[1], err)
+	}
+
+	// a dependency without exact version can't be compared
+	want, err := semver.NewVersion(expected)
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	if !reported.Equal(want) {
+		return fmt.Errorf("%w: expected k6 %s got %s", errVerificationFailed, expected, match[1])
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package k6provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6deps"
+)
+
+// TestVerifyExecutable is not parallel because executing a binary written by the test can fail
+// with "text file busy" if other tests fork processes while it is open for writing
+func TestVerifyExecutable(t *testing.T) { //nolint:paralleltest
+	if runtime.GOOS == "windows" {
+		t.Skip("test binaries are shell scripts")
+	}
+
+	hostPlatform := runtime.GOOS + "/" + runtime.GOARCH
+
+	testCases := []struct {
+		title     string
+		config    Config
+		script    string
+		expectErr error
+	}{
+		{
+			title:  "expected version",
+			config: Config{VerifyExecutable: true, Platform: hostPlatform},
+			script: "#!/bin/sh\necho 'k6 v0.50.0 (go1.22.1, linux/amd64)'\n",
+		},
+		{
+			title:     "unexpected version",
+			config:    Config{VerifyExecutable: true, Platform: hostPlatform},
+			script:    "#!/bin/sh\necho 'k6 v0.51.0 (go1.22.1, linux/amd64)'\n",
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "version not reported",
+			config:    Config{VerifyExecutable: true, Platform: hostPlatform},
+			script:    "#!/bin/sh\necho 'hello'\n",
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "fails to execute",
+			config:    Config{VerifyExecutable: true, Platform: hostPlatform},
+			script:    "#!/bin/sh\necho 'broken' >&2\nexit 1\n",
+			expectErr: ErrDownload,
+		},
+		{
+			title:     "can't be executed",
+			config:    Config{VerifyExecutable: true, Platform: hostPlatform},
+			script:    "not an executable\n",
+			expectErr: ErrCannotExecute,
+		},
+		{
+			title:     "uncached binary",
+			config:    Config{VerifyExecutable: true, Platform: hostPlatform, NoCache: true},
+			script:    "#!/bin/sh\nexit 1\n",
+			expectErr: ErrDownload,
+		},
+		{
+			title:  "other platform is not verified",
+			config: Config{VerifyExecutable: true, Platform: "windows/amd64"},
+			script: "#!/bin/sh\nexit 1\n",
+		},
+		{
+			title:  "disabled",
+			config: Config{Platform: hostPlatform},
+			script: "#!/bin/sh\nexit 1\n",
+		},
+	}
+
+	for _, tc := range testCases { //nolint:paralleltest
+		t.Run(tc.title, func(t *testing.T) {
+			storageDir := t.TempDir()
+			tc.config.Storage = NewFileStorage(storageDir)
+
+			content := []byte(tc.script)
+			provider, _ := newTestProvider(t, tc.config, content, sha256sum(content))
+
+			_, err := provider.GetBinary(context.TODO(), k6deps.Dependencies{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			// binaries that fail to execute are not uploaded to the storage
+			_, err = os.Stat(filepath.Join(storageDir, "artifact"))
+			if stored := err == nil; stored != (tc.expectErr == nil) {
+				t.Fatalf("expected stored %t got %v", tc.expectErr == nil, err)
+			}
+		})
+	}
+}
+
+func TestDownloadTargetExecutableName(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title    string
+		platform string
+		resume   bool
+		expect   string
+	}{
+		{
+			title:    "temporary file",
+			platform: "windows/amd64",
+			expect:   ".tmp.exe",
+		},
+		{
+			title:    "partial file",
+			platform: "windows/amd64",
+			resume:   true,
+			expect:   partialSuffix + ".exe",
+		},
+		{
+			title:    "not windows",
+			platform: "linux/amd64",
+			expect:   ".tmp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := Config{Platform: tc.platform, ResumeDownloads: tc.resume}
+			provider, _ := newTestProvider(t, config, nil, "")
+
+			artifactDir := t.TempDir()
+			target, err := provider.createTarget(artifactDir, filepath.Join(artifactDir, provider.binary), false)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			_ = target.Close()
+
+			// the binary is executed with this name when it is verified
+			if !strings.HasSuffix(target.Name(), tc.expect) {
+				t.Fatalf("expected suffix %q got %q", tc.expect, target.Name())
+			}
+		})
+	}
+}